@@ -16,6 +16,9 @@ import (
 	"github.com/scaranin/go-svc-short-url/internal/auth"
 	"github.com/scaranin/go-svc-short-url/internal/config"
 	"github.com/scaranin/go-svc-short-url/internal/handlers"
+	"github.com/scaranin/go-svc-short-url/internal/logger"
+	"github.com/scaranin/go-svc-short-url/internal/tracing"
+	"go.uber.org/zap"
 )
 
 var (
@@ -75,13 +78,20 @@ func startServer(cfg *config.ShortenerConfig, router *chi.Mux) error {
 	if err != nil {
 		return err
 	} else {
-		log.Println("Server is stopped!")
+		zap.L().Info("server is stopped")
 	}
 
 	return err
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "storage-migrate" {
+		if err := runStorageMigrate(os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	buildOut()
 
 	cfg, err := config.CreateConfig()
@@ -89,6 +99,25 @@ func main() {
 		log.Fatal(err)
 	}
 
+	zapLogger, err := logger.New(cfg.LogLevel, cfg.LogFormat)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer zapLogger.Sync()
+	zap.ReplaceGlobals(zapLogger)
+
+	shutdownTracing, err := tracing.Setup(context.Background(), tracing.Options{
+		ServiceName:    "shortener",
+		ServiceVersion: buildVersion,
+		Exporter:       cfg.TraceExporter,
+		OTLPEndpoint:   cfg.OTLPEndpoint,
+		File:           cfg.TraceFile,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer shutdownTracing(context.Background())
+
 	store, err := config.CreateStore(cfg)
 	if err != nil {
 		log.Fatal(err)
@@ -98,9 +127,15 @@ func main() {
 
 	h := handlers.CreateHandle(cfg, store, auth)
 
-	mux := api.InitRoute(&h)
+	h.Policy, err = config.CreatePolicy(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	mux := api.InitRoute(&h, cfg, zapLogger)
 
 	startServer(&cfg, mux)
+	h.Deletes.Close()
 
 	if err != nil {
 		log.Fatal(err)
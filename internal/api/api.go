@@ -4,31 +4,60 @@ import (
 	"net/http/pprof"
 
 	"github.com/go-chi/chi"
+	"github.com/scaranin/go-svc-short-url/internal/config"
 	"github.com/scaranin/go-svc-short-url/internal/handlers"
+	"github.com/scaranin/go-svc-short-url/internal/metrics"
 	"github.com/scaranin/go-svc-short-url/internal/middleware"
+	"github.com/scaranin/go-svc-short-url/internal/ratelimit"
+	"go.uber.org/zap"
 )
 
 // InitRoute initializes and configures the router with all application routes and middleware.
 // It sets up:
-// - Logging and compression middleware
+// - Tracing, request ID, logging, metrics, compression and panic recovery middleware
 // - Core URL shortening routes (JSON and plaintext)
 // - User-specific routes
-// - Health check endpoint
+// - Health check, liveness and readiness endpoints
+// - Per-user and per-IP rate limits on the create, redirect and delete routes
+// - Body size limits on the create and delete routes
+// - Prometheus metrics endpoint
 // - Debug/profiling endpoints
+// Access log entries are written to logger, sampled as configured in cfg.
 // Returns a configured chi.Mux router ready for use.
-func InitRoute(h *handlers.URLHandler) *chi.Mux {
+func InitRoute(h *handlers.URLHandler, cfg config.ShortenerConfig, logger *zap.Logger) *chi.Mux {
 	mux := chi.NewRouter()
-	mux.Use(middleware.WithLogging, middleware.GzipMiddleware)
+	mux.Use(
+		middleware.WithTracing,
+		middleware.WithRequestID,
+		middleware.WithLogging(logger, cfg.LogRedirectSampling),
+		middleware.WithMetrics,
+		middleware.GzipMiddleware,
+		middleware.WithRecovery,
+	)
+
+	limitCreate := middleware.WithRateLimit(newLimiter(cfg.RateLimitCreate, cfg.RateLimitCreateBurst), h.Auth)
+	limitRedirect := middleware.WithRateLimit(newLimiter(cfg.RateLimitRedirect, cfg.RateLimitRedirectBurst), h.Auth)
+	limitDelete := middleware.WithRateLimit(newLimiter(cfg.RateLimitDelete, cfg.RateLimitDeleteBurst), h.Auth)
+
+	bodyLimit := middleware.WithBodyLimit(cfg.MaxBodyBytes)
 
 	mux.Route("/", func(mux chi.Router) {
-		mux.Post("/", h.PostHandle)
-		mux.Post("/api/shorten", h.PostHandleJSON)
-		mux.Post("/api/shorten/batch", h.PostHandleJSONBatch)
+		mux.With(limitCreate, bodyLimit).Post("/", h.PostHandle)
+		mux.With(limitCreate, bodyLimit).Post("/api/shorten", h.PostHandleJSON)
+		mux.With(limitCreate, middleware.WithBodyLimit(cfg.MaxBatchBodyBytes)).Post("/api/shorten/batch", h.PostHandleJSONBatch)
 		mux.Get("/api/user/urls", h.GetUserURLs)
+		mux.Get("/api/user/urls/{shortURL}/variants", h.GetVariants)
+		mux.With(limitCreate, bodyLimit).Put("/api/user/urls/{shortURL}/variants", h.UpdateVariants)
 		mux.Get("/ping", h.PingHandle)
-		mux.Get("/{shortURL}", h.GetHandle)
+		mux.Get("/healthz", h.HealthzHandle)
+		mux.Get("/readyz", h.ReadyzHandle)
+		mux.Method("GET", "/metrics", metrics.Handler())
+		mux.With(limitRedirect).Get("/{shortURL}", h.GetHandle)
+		mux.With(limitRedirect).Head("/{shortURL}", h.GetHandle)
+		mux.With(limitRedirect, bodyLimit).Post("/{shortURL}", h.GetHandle)
+		mux.With(limitRedirect).Get("/{shortURL}/qr", h.QRHandle)
 		mux.Get("/api/internal/stats", h.GetStats)
-		mux.Delete("/api/user/urls", h.DeleteHandle)
+		mux.With(limitDelete, middleware.WithBodyLimit(cfg.MaxDeleteBodyBytes)).Delete("/api/user/urls", h.DeleteHandle)
 
 		mux.Get("/debug/pprof", pprof.Index)
 		mux.Get("/debug/profile", pprof.Profile)
@@ -38,3 +67,12 @@ func InitRoute(h *handlers.URLHandler) *chi.Mux {
 
 	return mux
 }
+
+// newLimiter creates a rate limiter for the given configuration, or returns
+// nil if the limit is disabled by a negative rate.
+func newLimiter(perSecond float64, burst int) *ratelimit.Limiter {
+	if perSecond < 0 {
+		return nil
+	}
+	return ratelimit.New(perSecond, burst)
+}
@@ -110,3 +110,49 @@ func (auth *AuthConfig) FillUserReturnCookie(incomeCookie *http.Cookie) (*http.C
 	}
 	return cookie, err
 }
+
+// ParseUserID returns the UserID of a signed, unexpired token. Unlike
+// FillUserReturnCookie it never issues a new token and does not modify auth,
+// so it is safe to use from middleware shared by concurrent requests. ok is
+// false if the token is not valid.
+func (auth AuthConfig) ParseUserID(token string) (userID string, ok bool) {
+	claims := &Claims{}
+	parsed, err := jwt.ParseWithClaims(token, claims, func(t *jwt.Token) (interface{}, error) {
+		if _, isHMAC := t.Method.(*jwt.SigningMethodHMAC); !isHMAC {
+			return nil, jwt.ErrSignatureInvalid
+		}
+		return []byte(auth.SecretKey), nil
+	})
+	if err != nil || !parsed.Valid || len(claims.UserID) == 0 {
+		return "", false
+	}
+	return claims.UserID, true
+}
+
+// linkTokenIssuer marks tokens that unlock a password-protected short URL, so
+// they cannot be mistaken for user tokens.
+const linkTokenIssuer = "link-access"
+
+// BuildLinkToken returns a token proving that the password of shortURL was
+// given. It is signed with SecretKey and expires after ttl.
+func (auth AuthConfig) BuildLinkToken(shortURL string, ttl time.Duration) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
+		Issuer:    linkTokenIssuer,
+		Subject:   shortURL,
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(ttl)),
+	})
+	return token.SignedString([]byte(auth.SecretKey))
+}
+
+// ParseLinkToken reports whether token is a signed, unexpired token built by
+// BuildLinkToken for shortURL.
+func (auth AuthConfig) ParseLinkToken(token string, shortURL string) bool {
+	claims := &jwt.RegisteredClaims{}
+	parsed, err := jwt.ParseWithClaims(token, claims, func(t *jwt.Token) (interface{}, error) {
+		if _, isHMAC := t.Method.(*jwt.SigningMethodHMAC); !isHMAC {
+			return nil, jwt.ErrSignatureInvalid
+		}
+		return []byte(auth.SecretKey), nil
+	})
+	return err == nil && parsed.Valid && claims.Issuer == linkTokenIssuer && claims.Subject == shortURL
+}
@@ -7,8 +7,8 @@ It centralizes loading settings from multiple sources with a clear priority:
 3. Hard-coded Defaults
 
 This package also includes a factory function, `CreateStore`, which selects and
-initializes the appropriate storage backend (database, file, or in-memory) based
-on the final configuration.
+initializes the appropriate storage backend (database, embedded key-value store,
+file, or in-memory) based on the final configuration.
 */
 
 package config
@@ -2,32 +2,22 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
-)
-
-// DelBatch processes short URLs for deletion from a channel. It acts as a worker
-// that consumes short URL strings from the provided channel. For each URL received,
-// it calls the `DeleteBulk` method of the storage layer, associating the deletion
-// with the `UserID` from the handler's context. This function is designed to run
-// in a separate goroutine to handle deletion tasks asynchronously.
-func (h *URLHandler) DelBatch(shortURLchan <-chan string) {
-	var shortURLs []string
-	for req := range shortURLchan {
-		shortURLs = append(shortURLs, req)
 
-		h.Storage.DeleteBulk(h.Auth.UserID, shortURLs)
-		shortURLs = nil
-	}
-}
+	"github.com/scaranin/go-svc-short-url/internal/logger"
+	"github.com/scaranin/go-svc-short-url/internal/middleware"
+	"github.com/scaranin/go-svc-short-url/internal/models"
+)
 
 // DeleteHandle is an HTTP handler for asynchronously deleting a batch of user-owned URLs.
 // It expects a JSON request body containing an array of short URL strings to be deleted.
-// The handler sets up a worker to process deletions in the background. It reads the
-// short URLs from the request, places them onto a channel, and launches a goroutine
-// (`DelBatch`) to perform the deletion.
+// The short URLs are placed onto the bounded DeleteQueue together with the
+// requesting user's ID, and its workers perform the deletion in the background.
 //
 // Crucially, it responds immediately with an HTTP 202 Accepted status, indicating that
 // the deletion requests have been received and will be processed without blocking the client.
+// If the queue is full, it responds with HTTP 503 Service Unavailable instead.
 // It also handles user authentication cookies as part of the request-response cycle.
 func (h *URLHandler) DeleteHandle(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", contentTypeApJSON)
@@ -37,36 +27,33 @@ func (h *URLHandler) DeleteHandle(w http.ResponseWriter, r *http.Request) {
 	)
 	cookieR, err := r.Cookie(h.Auth.CookieName)
 	if err != nil {
-		w.WriteHeader(http.StatusUnauthorized)
-		w.Write([]byte(err.Error()))
+		middleware.WriteProblem(w, r, http.StatusUnauthorized, models.CodeUnauthorized, err.Error())
 		return
 	}
 
 	cookieW, err = h.Auth.FillUserReturnCookie(cookieR)
+	if errors.Is(err, http.ErrNoCookie) {
+		middleware.WriteProblem(w, r, http.StatusUnauthorized, models.CodeUnauthorized, "invalid auth token")
+		return
+	}
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte(err.Error()))
+		middleware.WriteProblem(w, r, http.StatusInternalServerError, models.CodeInternal, err.Error())
 		return
 	}
+	logger.SetUserID(r.Context(), h.Auth.UserID)
 
 	var shortURLs []string
 	if err := json.NewDecoder(r.Body).Decode(&shortURLs); err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write([]byte(err.Error()))
+		writeBodyError(w, r, err)
 		return
 	}
 	defer r.Body.Close()
 
-	finalCh := make(chan string, len(shortURLs))
-	go func(shortURLs []string) {
-		defer close(finalCh)
-		for _, shortURL := range shortURLs {
-			finalCh <- shortURL
-
-		}
-	}(shortURLs)
-
-	go h.DelBatch(finalCh)
+	if !h.Deletes.Enqueue(r.Context(), h.Auth.UserID, shortURLs) {
+		w.Header().Set("Retry-After", "1")
+		middleware.WriteProblem(w, r, http.StatusServiceUnavailable, models.CodeOverloaded, "delete queue is full")
+		return
+	}
 
 	http.SetCookie(w, cookieW)
 	w.WriteHeader(http.StatusAccepted)
@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"context"
+	"runtime/debug"
+	"sync"
+
+	"github.com/scaranin/go-svc-short-url/internal/logger"
+	"github.com/scaranin/go-svc-short-url/internal/metrics"
+	"github.com/scaranin/go-svc-short-url/internal/models"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+// deleteJob is a bulk deletion requested by a user.
+type deleteJob struct {
+	ctx       context.Context
+	userID    string
+	shortURLs []string
+}
+
+// DeleteQueue is a bounded queue of bulk deletions processed by a fixed number
+// of background workers. It lets DeleteHandle answer immediately without
+// starting goroutines per request, and its fill level is reported by the
+// readiness endpoint.
+type DeleteQueue struct {
+	store models.Storage
+	jobs  chan deleteJob
+	wg    sync.WaitGroup
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+// NewDeleteQueue creates a queue holding up to size deletions and starts
+// workers goroutines applying them to store. Values below one are raised to one.
+func NewDeleteQueue(store models.Storage, size int, workers int) *DeleteQueue {
+	q := &DeleteQueue{
+		store: store,
+		jobs:  make(chan deleteJob, max(size, 1)),
+	}
+	for i := 0; i < max(workers, 1); i++ {
+		q.wg.Add(1)
+		go q.work()
+	}
+	return q
+}
+
+// work applies queued deletions until the queue is closed and drained.
+func (q *DeleteQueue) work() {
+	defer q.wg.Done()
+	for job := range q.jobs {
+		metrics.DeleteQueueDepth.Dec()
+		q.delete(job)
+	}
+}
+
+// delete applies a single queued deletion. A panic in the storage is logged
+// and does not stop the worker.
+func (q *DeleteQueue) delete(job deleteJob) {
+	ctx, span := tracer.Start(job.ctx, "DeleteQueue.DeleteBulk",
+		trace.WithAttributes(attribute.Int("shortener.urls", len(job.shortURLs))))
+	defer span.End()
+	defer func() {
+		if rec := recover(); rec != nil {
+			logger.FromContext(job.ctx).Error("panic recovered in delete worker",
+				zap.Any("panic", rec), zap.ByteString("stack", debug.Stack()))
+		}
+	}()
+
+	if err := q.store.DeleteBulk(ctx, job.userID, job.shortURLs); err != nil {
+		span.RecordError(err)
+		logger.FromContext(job.ctx).Error("delete failed",
+			zap.Int("urls", len(job.shortURLs)), zap.String("user_id", job.userID), zap.Error(err))
+	}
+}
+
+// Enqueue queues the deletion of shortURLs owned by userID. It never blocks and
+// returns false if the queue is full or closed. The deletion keeps the values
+// of ctx, such as its trace, but not its cancellation, because it outlives the request.
+func (q *DeleteQueue) Enqueue(ctx context.Context, userID string, shortURLs []string) bool {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	if q.closed {
+		return false
+	}
+	select {
+	case q.jobs <- deleteJob{ctx: context.WithoutCancel(ctx), userID: userID, shortURLs: shortURLs}:
+		metrics.DeleteQueueDepth.Inc()
+		return true
+	default:
+		return false
+	}
+}
+
+// Len returns the number of deletions waiting for a worker.
+func (q *DeleteQueue) Len() int {
+	return len(q.jobs)
+}
+
+// Cap returns the maximum number of waiting deletions.
+func (q *DeleteQueue) Cap() int {
+	return cap(q.jobs)
+}
+
+// Saturated reports whether the queue is full, so new deletions are rejected.
+func (q *DeleteQueue) Saturated() bool {
+	return q.Len() >= q.Cap()
+}
+
+// Close stops accepting deletions and waits until the queued ones are applied.
+func (q *DeleteQueue) Close() {
+	q.mu.Lock()
+	if !q.closed {
+		q.closed = true
+		close(q.jobs)
+	}
+	q.mu.Unlock()
+	q.wg.Wait()
+}
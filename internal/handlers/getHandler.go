@@ -1,50 +1,163 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
+	"time"
 
-	"github.com/go-chi/chi"
+	"github.com/scaranin/go-svc-short-url/internal/logger"
+	"github.com/scaranin/go-svc-short-url/internal/metrics"
+	"github.com/scaranin/go-svc-short-url/internal/middleware"
+	"github.com/scaranin/go-svc-short-url/internal/models"
+	"github.com/scaranin/go-svc-short-url/internal/policy"
+	"go.uber.org/zap"
 
 	"encoding/json"
-	"log"
 )
 
-// GetHandle handles GET requests for short URLs, redirecting clients to the original URL.
+// GetHandle handles GET, HEAD and POST requests for short URLs, redirecting clients to the original URL.
 // It extracts the `shortURL` from the path parameter.
-//   - On success, it performs an HTTP 307 Temporary Redirect to the original URL.
-//   - If the storage indicates the URL was deleted (by returning a "ROW_IS_DELETED" error),
+//   - On success, it redirects to the original URL with the status chosen for
+//     the link, else RedirectStatus, else 307 Temporary Redirect. Permanent
+//     redirects may be cached for RedirectMaxAge, temporary ones are not
+//     stored. The query string is passed on to the original URL if the link or
+//     ForwardQuery asks for it.
+//   - For a link with targets, the destination is the URL of the first target
+//     matching the platform in User-Agent and the language in Accept-Language.
+//     Otherwise, for a link with A/B variants, it is the variant the client
+//     was assigned, remembered in a cookie; the redirect is counted for the
+//     variant and logged with it. Otherwise it is the original URL (see
+//     destination).
+//   - For a password-protected link, it asks for the password first (see
+//     unlock). A request posting the password form is redirected with HTTP
+//     303 See Other, so the password is not posted to the original URL.
+//   - For `/{shortURL}+`, `?preview=1` and links with AlwaysPreview, it renders
+//     an HTML page showing the destination, title and description with a
+//     link to continue instead of redirecting.
+//   - If the short URL is unknown, it responds with HTTP 404 Not Found.
+//   - If the storage indicates the URL was deleted (by returning models.ErrDeleted),
 //     it responds with an HTTP 410 Gone status.
+//   - A redirect through a link with MaxClicks is counted atomically by the
+//     storage; once the clicks are exhausted it responds with HTTP 410 Gone.
+//     HEAD requests, preview pages and password forms are not counted.
+//   - Before the NotBefore time of the link, it answers with the "coming soon"
+//     response (see writeComingSoon); after its ExpiresAt time, with HTTP 410
+//     Gone.
+//   - If the destination has been blocked since the URL was shortened, it
+//     responds with HTTP 451 Unavailable For Legal Reasons, or with HTTP 403
+//     Forbidden for a private address.
+//   - If the storage is unavailable and the URL is not cached (models.ErrUnavailable),
+//     it responds with an HTTP 503 Service Unavailable status.
 //   - For any other lookup errors, it returns an HTTP 500 Internal Server Error.
 //   - If the `shortURL` parameter is missing, it returns an HTTP 400 Bad Request.
 func (h *URLHandler) GetHandle(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("content-type", contentTypeTextPlain)
-	shortURL := chi.URLParam(r, "shortURL")
-	var originalURL string
+	shortURL, preview, rawQuery := previewRequest(r)
+	var link models.URL
+	var dest, variant string
 	var err error
 	if len(shortURL) != 0 {
-		originalURL, err = h.Load(shortURL)
+		link, err = h.LoadURL(r.Context(), shortURL)
+		if err == nil {
+			err = linkSchedule(link, time.Now())
+		}
+		if err == nil {
+			dest, variant = destination(w, r, link)
+			err = h.Policy.CheckRedirect(dest)
+		}
+		countRedirect(err)
 		if err != nil {
-			if err.Error() == "ROW_IS_DELETED" {
-				w.WriteHeader(http.StatusGone)
-				return
-			} else {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-				return
+			switch {
+			case errors.Is(err, models.ErrNotFound):
+				middleware.WriteProblem(w, r, http.StatusNotFound, models.CodeNotFound, "short URL not found")
+			case errors.Is(err, models.ErrDeleted):
+				middleware.WriteProblem(w, r, http.StatusGone, models.CodeURLDeleted, "short URL has been deleted")
+			case errors.Is(err, models.ErrClicksExhausted):
+				writeClicksExhausted(w, r)
+			case errors.Is(err, errNotYetActive):
+				h.writeComingSoon(w, r, link)
+			case errors.Is(err, errExpired):
+				middleware.WriteProblem(w, r, http.StatusGone, models.CodeURLExpired, "short URL has expired")
+			case errors.Is(err, policy.ErrBlocked):
+				middleware.WriteProblem(w, r, http.StatusUnavailableForLegalReasons, models.CodeDestinationBlocked, err.Error())
+			case errors.Is(err, policy.ErrPrivate):
+				middleware.WriteProblem(w, r, http.StatusForbidden, models.CodeDestinationPrivate, err.Error())
+			default:
+				writeStorageError(w, r, err)
 			}
+			return
 		}
 	} else {
-		http.Error(w, "Empty value", http.StatusBadRequest)
+		middleware.WriteProblem(w, r, http.StatusBadRequest, models.CodeInvalidRequest, "short URL is empty")
+		return
+	}
+	if len(link.PasswordHash) > 0 && !h.unlock(w, r, link) {
 		return
 	}
-	w.Header().Add("Location", originalURL)
-	w.WriteHeader(http.StatusTemporaryRedirect)
+	target := h.redirectTarget(link, dest, rawQuery)
+	if preview || link.AlwaysPreview {
+		writePreview(w, r, link, dest, target)
+		return
+	}
+	if len(variant) > 0 {
+		logger.With(r.Context(), zap.String("variant", variant))
+	}
+	if (link.MaxClicks > 0 || len(variant) > 0) && r.Method != http.MethodHead {
+		if err = h.Storage.RecordClick(r.Context(), shortURL, variant); err != nil {
+			if errors.Is(err, models.ErrClicksExhausted) {
+				writeClicksExhausted(w, r)
+				return
+			}
+			writeStorageError(w, r, err)
+			return
+		}
+	}
+	status := h.redirectStatus(link)
+	if r.Method == http.MethodPost {
+		status = http.StatusSeeOther
+	}
+	w.Header().Set("Cache-Control", h.cacheControl(link, status))
+	if len(variant) > 0 {
+		// A cached redirect would neither be counted nor follow new weights.
+		w.Header().Set("Cache-Control", "no-store")
+	}
+	w.Header().Add("Location", target)
+	w.WriteHeader(status)
+}
+
+// writeClicksExhausted replies that a click-limited short URL has expired.
+func writeClicksExhausted(w http.ResponseWriter, r *http.Request) {
+	middleware.WriteProblem(w, r, http.StatusGone, models.CodeClicksExhausted, "short URL has reached its click limit")
+}
+
+// countRedirect records the outcome of a short URL lookup in metrics.Redirects.
+func countRedirect(err error) {
+	switch {
+	case errors.Is(err, models.ErrDeleted):
+		metrics.Redirects.WithLabelValues("deleted").Inc()
+	case errors.Is(err, models.ErrClicksExhausted):
+		metrics.Redirects.WithLabelValues("exhausted").Inc()
+	case errors.Is(err, errNotYetActive):
+		metrics.Redirects.WithLabelValues("scheduled").Inc()
+	case errors.Is(err, errExpired):
+		metrics.Redirects.WithLabelValues("expired").Inc()
+	case errors.Is(err, policy.ErrBlocked), errors.Is(err, policy.ErrPrivate):
+		metrics.Redirects.WithLabelValues("blocked").Inc()
+	case errors.Is(err, models.ErrNotFound):
+		metrics.Redirects.WithLabelValues("miss").Inc()
+	case err == nil:
+		metrics.Redirects.WithLabelValues("hit").Inc()
+	default:
+		metrics.Redirects.WithLabelValues("error").Inc()
+	}
 }
 
 // GetUserURLs is an HTTP handler that retrieves all URLs created by the currently authenticated user.
 // It authenticates the user via a cookie. If the user is not authenticated, it responds with
 // an appropriate status (e.g., 401 Unauthorized). If the user is authenticated but has no URLs,
 // it responds with HTTP 204 No Content.
-// On success, it prepends the service's BaseURL to each short URL identifier, marshals the
+// On success, it prepends the service's BaseURL to each short URL identifier, adds the URL
+// of its QR code, marshals the
 // list into a JSON array, and sends it back to the client with an HTTP 200 OK status.
 func (h *URLHandler) GetUserURLs(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", contentTypeApJSON)
@@ -54,21 +167,23 @@ func (h *URLHandler) GetUserURLs(w http.ResponseWriter, r *http.Request) {
 	)
 	cookieR, err := r.Cookie(h.Auth.CookieName)
 	if err != nil {
-		log.Print(err.Error())
+		logger.FromContext(r.Context()).Debug("no auth cookie", zap.Error(err))
 	}
 	cookieW, err = h.Auth.FillUserReturnCookie(cookieR)
 	if err != nil {
-		log.Print(err.Error())
+		logger.FromContext(r.Context()).Debug("auth cookie rejected", zap.Error(err))
+	} else {
+		logger.SetUserID(r.Context(), h.Auth.UserID)
 	}
 	if err == http.ErrNoCookie {
 		w.WriteHeader(http.StatusNoContent)
 		return
 	}
 	if err != nil {
-		w.WriteHeader(http.StatusUnauthorized)
+		middleware.WriteProblem(w, r, http.StatusUnauthorized, models.CodeUnauthorized, err.Error())
 		return
 	}
-	URLList, err := h.Storage.GetUserURLList(h.Auth.UserID)
+	URLList, err := h.Storage.GetUserURLList(r.Context(), h.Auth.UserID)
 
 	if err != nil || len(URLList) == 0 {
 		http.SetCookie(w, cookieW)
@@ -77,6 +192,7 @@ func (h *URLHandler) GetUserURLs(w http.ResponseWriter, r *http.Request) {
 	}
 
 	for i := range URLList {
+		URLList[i].QRURL = h.qrURL(URLList[i].ShortURL)
 		URLList[i].ShortURL = h.BaseURL + URLList[i].ShortURL
 	}
 
@@ -1,17 +1,26 @@
 package handlers
 
 import (
+	"context"
+	"encoding/json"
 	"log"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/go-chi/chi"
 	"github.com/scaranin/go-svc-short-url/internal/auth"
 	"github.com/scaranin/go-svc-short-url/internal/config"
+	"github.com/scaranin/go-svc-short-url/internal/middleware"
+	"github.com/scaranin/go-svc-short-url/internal/models"
 	"github.com/scaranin/go-svc-short-url/internal/storage"
+	"github.com/scaranin/go-svc-short-url/internal/targeting"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestURLHandler_GetHandle(t *testing.T) {
@@ -81,6 +90,125 @@ func TestURLHandler_GetHandle(t *testing.T) {
 
 }
 
+func TestURLHandler_GetHandleUnknown(t *testing.T) {
+	tests := []struct {
+		name  string
+		store func(t *testing.T) models.Storage
+	}{
+		{
+			name: "file",
+			store: func(t *testing.T) models.Storage {
+				store, err := storage.CreateStoreFile("")
+				require.NoError(t, err)
+				return store
+			},
+		},
+		{
+			name: "bolt",
+			store: func(t *testing.T) models.Storage {
+				store, err := storage.CreateStoreBolt(filepath.Join(t.TempDir(), "links.db"))
+				require.NoError(t, err)
+				t.Cleanup(store.Close)
+				return store
+			},
+		},
+		{
+			name: "cached",
+			store: func(t *testing.T) models.Storage {
+				store, err := storage.CreateStoreFile("")
+				require.NoError(t, err)
+				return storage.NewCachedStorage(store, 10, time.Minute, time.Minute)
+			},
+		},
+		{
+			name: "postgres",
+			store: func(t *testing.T) models.Storage {
+				dsn := os.Getenv("DATABASE_DSN")
+				if len(dsn) == 0 {
+					t.Skip("DATABASE_DSN is not set")
+				}
+				store, err := storage.CreateStoreDB(dsn)
+				require.NoError(t, err)
+				t.Cleanup(store.Close)
+				return store
+			},
+		},
+		{
+			name: "not found error",
+			store: func(t *testing.T) models.Storage {
+				return notFoundStorage{}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := URLHandler{Storage: tt.store(t)}
+			router := chi.NewRouter()
+			router.Get("/{shortURL}", h.GetHandle)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/unknown", nil))
+
+			assert.Equal(t, http.StatusNotFound, w.Code)
+			assert.Empty(t, w.Header().Get("Location"))
+			var problem models.Problem
+			require.NoError(t, json.NewDecoder(w.Body).Decode(&problem))
+			assert.Equal(t, models.CodeNotFound, problem.Code)
+		})
+	}
+}
+
+// notFoundStorage reports every short URL as unknown with models.ErrNotFound,
+// the way DBStorage does.
+type notFoundStorage struct {
+	models.Storage
+}
+
+func (notFoundStorage) LoadURL(ctx context.Context, shortURL string) (models.URL, error) {
+	return models.URL{ShortURL: shortURL}, models.ErrNotFound
+}
+
+func TestURLHandler_GetHandleRequestID(t *testing.T) {
+	store, err := storage.CreateStoreFile("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := URLHandler{Storage: store}
+	handler := middleware.WithRequestID(http.HandlerFunc(h.GetHandle))
+
+	tests := []struct {
+		name      string
+		requestID string
+		generated bool
+	}{
+		{name: "client request ID is kept", requestID: "client-42"},
+		{name: "missing request ID is generated", generated: true},
+		{name: "invalid request ID is replaced", requestID: "bad\nid", generated: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if len(tt.requestID) > 0 {
+				req.Header.Set(middleware.RequestIDHeader, tt.requestID)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			id := w.Header().Get(middleware.RequestIDHeader)
+			if tt.generated {
+				assert.Len(t, id, 32)
+			} else {
+				assert.Equal(t, tt.requestID, id)
+			}
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+			assert.Equal(t, "application/problem+json", w.Header().Get("Content-Type"))
+			var problem models.Problem
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &problem))
+			assert.Equal(t, models.CodeInvalidRequest, problem.Code)
+			assert.Equal(t, id, problem.RequestID)
+		})
+	}
+}
+
 func BenchmarkGetHandle(b *testing.B) {
 	cfg, err := config.CreateConfig()
 	if err != nil {
@@ -119,3 +247,395 @@ func BenchmarkGetHandle(b *testing.B) {
 	}
 
 }
+
+func TestURLHandler_GetHandleRedirect(t *testing.T) {
+	store, err := storage.CreateStoreFile("")
+	require.NoError(t, err)
+	passwordHash, err := hashPassword("secret")
+	require.NoError(t, err)
+	expiresAt, expiresSoon := time.Now().Add(10*time.Minute+30*time.Second+500*time.Millisecond), time.Now().Add(500*time.Millisecond)
+	links := []models.URL{
+		{ShortURL: "default", OriginalURL: "https://a.example/page"},
+		{ShortURL: "permanent", OriginalURL: "https://a.example/page", LinkOptions: models.LinkOptions{RedirectStatus: http.StatusMovedPermanently}},
+		{ShortURL: "forward", OriginalURL: "https://a.example/page?ref=1#top", LinkOptions: models.LinkOptions{ForwardQuery: true}},
+		{ShortURL: "limited", OriginalURL: "https://a.example/page", LinkOptions: models.LinkOptions{RedirectStatus: http.StatusPermanentRedirect, MaxClicks: 100}},
+		{ShortURL: "expiring", OriginalURL: "https://a.example/page", LinkOptions: models.LinkOptions{RedirectStatus: http.StatusMovedPermanently, ExpiresAt: &expiresAt}},
+		{ShortURL: "expiring-soon", OriginalURL: "https://a.example/page", LinkOptions: models.LinkOptions{RedirectStatus: http.StatusMovedPermanently, ExpiresAt: &expiresSoon}},
+		{ShortURL: "protected", OriginalURL: "https://a.example/page", PasswordHash: passwordHash, LinkOptions: models.LinkOptions{RedirectStatus: http.StatusMovedPermanently}},
+	}
+	for _, link := range links {
+		_, err = store.Save(context.Background(), &link)
+		require.NoError(t, err)
+	}
+
+	tests := []struct {
+		name         string
+		handler      URLHandler
+		method       string
+		target       string
+		password     string
+		statusCode   int
+		location     string
+		cacheControl string
+	}{
+		{
+			name:         "default is a temporary redirect",
+			method:       http.MethodGet,
+			target:       "/default?utm_source=x",
+			statusCode:   http.StatusTemporaryRedirect,
+			location:     "https://a.example/page",
+			cacheControl: "no-store",
+		},
+		{
+			name:         "global status",
+			handler:      URLHandler{RedirectStatus: http.StatusPermanentRedirect, RedirectMaxAge: time.Hour},
+			method:       http.MethodGet,
+			target:       "/default",
+			statusCode:   http.StatusPermanentRedirect,
+			location:     "https://a.example/page",
+			cacheControl: "public, max-age=3600",
+		},
+		{
+			name:         "link status wins",
+			handler:      URLHandler{RedirectStatus: http.StatusFound, RedirectMaxAge: time.Minute},
+			method:       http.MethodGet,
+			target:       "/permanent",
+			statusCode:   http.StatusMovedPermanently,
+			location:     "https://a.example/page",
+			cacheControl: "public, max-age=60",
+		},
+		{
+			name:         "permanent caching disabled",
+			handler:      URLHandler{RedirectMaxAge: -1},
+			method:       http.MethodGet,
+			target:       "/permanent",
+			statusCode:   http.StatusMovedPermanently,
+			location:     "https://a.example/page",
+			cacheControl: "no-store",
+		},
+		{
+			name:         "link forwards the query",
+			method:       http.MethodGet,
+			target:       "/forward?utm_source=x",
+			statusCode:   http.StatusTemporaryRedirect,
+			location:     "https://a.example/page?ref=1&utm_source=x#top",
+			cacheControl: "no-store",
+		},
+		{
+			name:         "global query forwarding",
+			handler:      URLHandler{ForwardQuery: true},
+			method:       http.MethodGet,
+			target:       "/default?utm_source=x",
+			statusCode:   http.StatusTemporaryRedirect,
+			location:     "https://a.example/page?utm_source=x",
+			cacheControl: "no-store",
+		},
+		{
+			name:         "unlocked permanent redirect is not stored",
+			handler:      URLHandler{RedirectMaxAge: time.Hour},
+			method:       http.MethodGet,
+			target:       "/protected",
+			password:     "secret",
+			statusCode:   http.StatusMovedPermanently,
+			location:     "https://a.example/page",
+			cacheControl: "private, no-store",
+		},
+		{
+			name:         "click-limited permanent redirect is not stored",
+			handler:      URLHandler{RedirectMaxAge: time.Hour},
+			method:       http.MethodGet,
+			target:       "/limited",
+			statusCode:   http.StatusPermanentRedirect,
+			location:     "https://a.example/page",
+			cacheControl: "no-store",
+		},
+		{
+			name:         "expiring link is cached until it expires",
+			handler:      URLHandler{RedirectMaxAge: time.Hour},
+			method:       http.MethodGet,
+			target:       "/expiring",
+			statusCode:   http.StatusMovedPermanently,
+			location:     "https://a.example/page",
+			cacheControl: "public, max-age=630",
+		},
+		{
+			name:         "link expiring within a second is not stored",
+			handler:      URLHandler{RedirectMaxAge: time.Hour},
+			method:       http.MethodGet,
+			target:       "/expiring-soon",
+			statusCode:   http.StatusMovedPermanently,
+			location:     "https://a.example/page",
+			cacheControl: "no-store",
+		},
+		{
+			name:         "head",
+			method:       http.MethodHead,
+			target:       "/default",
+			statusCode:   http.StatusTemporaryRedirect,
+			location:     "https://a.example/page",
+			cacheControl: "no-store",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := tt.handler
+			h.Storage = store
+			router := chi.NewRouter()
+			router.Get("/{shortURL}", h.GetHandle)
+			router.Head("/{shortURL}", h.GetHandle)
+
+			req := httptest.NewRequest(tt.method, tt.target, nil)
+			if len(tt.password) > 0 {
+				req.Header.Set(PasswordHeader, tt.password)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.statusCode, w.Code)
+			assert.Equal(t, tt.location, w.Header().Get("Location"))
+			assert.Equal(t, tt.cacheControl, w.Header().Get("Cache-Control"))
+		})
+	}
+}
+
+func TestURLHandler_GetHandlePreview(t *testing.T) {
+	store, err := storage.CreateStoreFile("")
+	require.NoError(t, err)
+	links := []models.URL{
+		{ShortURL: "docs", OriginalURL: "https://docs.example/guide", LinkOptions: models.LinkOptions{
+			Title: "Guide", Description: "<script>alert(1)</script>", ForwardQuery: true,
+		}},
+		{ShortURL: "warn", OriginalURL: "https://warn.example/", LinkOptions: models.LinkOptions{AlwaysPreview: true}},
+		{ShortURL: "app", OriginalURL: "https://app.example/", LinkOptions: models.LinkOptions{Targets: []targeting.Rule{
+			{Platform: targeting.PlatformIOS, URL: "https://apps.apple.com/app/id1"},
+		}}},
+		{ShortURL: "ab", OriginalURL: "https://ab.example/", LinkOptions: models.LinkOptions{Variants: []models.Variant{
+			{Name: "a", URL: "https://a.example/landing", Weight: 0},
+			{Name: "b", URL: "https://b.example/landing", Weight: 1},
+		}}},
+	}
+	for _, link := range links {
+		_, err = store.Save(context.Background(), &link)
+		require.NoError(t, err)
+	}
+	h := URLHandler{Storage: store}
+	router := chi.NewRouter()
+	router.Get("/{shortURL}", h.GetHandle)
+
+	tests := []struct {
+		name         string
+		target       string
+		userAgent    string
+		statusCode   int
+		wantContains []string
+	}{
+		{name: "plus suffix", target: "/docs+", statusCode: http.StatusOK, wantContains: []string{"Guide", "&lt;script&gt;", `href="https://docs.example/guide"`}},
+		{name: "preview parameter", target: "/docs?preview=1&ref=x", statusCode: http.StatusOK, wantContains: []string{`href="https://docs.example/guide?ref=x"`}},
+		{name: "always preview", target: "/warn", statusCode: http.StatusOK, wantContains: []string{"Check the address", "warn.example"}},
+		{name: "matching target", target: "/app+", userAgent: "Mozilla/5.0 (iPhone; CPU iPhone OS 17_4 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.4 Mobile/15E148 Safari/604.1", statusCode: http.StatusOK, wantContains: []string{
+			"<code>https://apps.apple.com/app/id1</code>", `href="https://apps.apple.com/app/id1"`, "Continue to apps.apple.com",
+		}},
+		{name: "no matching target", target: "/app+", statusCode: http.StatusOK, wantContains: []string{
+			"<code>https://app.example/</code>", `href="https://app.example/"`, "Continue to app.example",
+		}},
+		{name: "variant", target: "/ab+", statusCode: http.StatusOK, wantContains: []string{
+			"<code>https://b.example/landing</code>", `href="https://b.example/landing"`, "Continue to b.example",
+		}},
+		{name: "redirect without preview", target: "/docs", statusCode: http.StatusTemporaryRedirect},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			req.Header.Set("User-Agent", tt.userAgent)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.statusCode, w.Code)
+			body := w.Body.String()
+			assert.NotContains(t, body, "<script>")
+			for _, want := range tt.wantContains {
+				assert.Contains(t, body, want)
+			}
+			if tt.statusCode == http.StatusOK {
+				assert.Equal(t, "text/html; charset=utf-8", w.Header().Get("Content-Type"))
+				assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+			}
+		})
+	}
+}
+
+func TestURLHandler_GetHandlePassword(t *testing.T) {
+	store, err := storage.CreateStoreFile("")
+	require.NoError(t, err)
+	h := URLHandler{Storage: store, Auth: auth.NewAuthConfig()}
+	shortURL, err := h.Save(context.Background(), "https://docs.example/secret", "", models.LinkOptions{Password: "s3cret"})
+	require.NoError(t, err)
+	otherURL, err := h.Save(context.Background(), "https://docs.example/other", "", models.LinkOptions{Password: "other"})
+	require.NoError(t, err)
+
+	link, err := store.LoadURL(context.Background(), shortURL)
+	require.NoError(t, err)
+	assert.Empty(t, link.Password, "the password must not be stored")
+	assert.NotEmpty(t, link.PasswordHash)
+	assert.NotContains(t, link.PasswordHash, "s3cret")
+
+	router := chi.NewRouter()
+	router.Get("/{shortURL}", h.GetHandle)
+	router.Post("/{shortURL}", h.GetHandle)
+	serve := func(req *http.Request) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	form := func(target, password string) *http.Request {
+		req := httptest.NewRequest(http.MethodPost, target, strings.NewReader("password="+password))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		return req
+	}
+
+	w := serve(httptest.NewRequest(http.MethodGet, "/"+shortURL, nil))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Contains(t, w.Body.String(), `<form method="post">`)
+	assert.NotContains(t, w.Body.String(), "docs.example", "the destination must not leak")
+
+	req := httptest.NewRequest(http.MethodGet, "/"+shortURL, nil)
+	req.Header.Set(PasswordHeader, "wrong")
+	assert.Equal(t, http.StatusUnauthorized, serve(req).Code)
+	req.Header.Set(PasswordHeader, "s3cret")
+	w = serve(req)
+	assert.Equal(t, http.StatusTemporaryRedirect, w.Code)
+	assert.Equal(t, "https://docs.example/secret", w.Header().Get("Location"))
+
+	w = serve(form("/"+shortURL, "wrong"))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Contains(t, w.Body.String(), "wrong")
+	assert.Empty(t, w.Result().Cookies())
+
+	w = serve(form("/"+shortURL, "s3cret"))
+	assert.Equal(t, http.StatusSeeOther, w.Code)
+	assert.Equal(t, "https://docs.example/secret", w.Header().Get("Location"))
+	cookies := w.Result().Cookies()
+	require.Len(t, cookies, 1)
+	assert.Equal(t, "/"+shortURL, cookies[0].Path)
+
+	req = httptest.NewRequest(http.MethodGet, "/"+shortURL, nil)
+	req.AddCookie(cookies[0])
+	assert.Equal(t, http.StatusTemporaryRedirect, serve(req).Code, "the cookie unlocks the link")
+
+	req = httptest.NewRequest(http.MethodGet, "/"+otherURL, nil)
+	req.AddCookie(cookies[0])
+	assert.Equal(t, http.StatusUnauthorized, serve(req).Code, "the cookie is bound to its short URL")
+}
+
+func TestURLHandler_GetHandleMaxClicks(t *testing.T) {
+	store, err := storage.CreateStoreFile("")
+	require.NoError(t, err)
+	h := URLHandler{Storage: storage.NewCachedStorage(store, 10, time.Minute, time.Minute)}
+	shortURL, err := h.Save(context.Background(), "https://invite.example/", "", models.LinkOptions{MaxClicks: 1})
+	require.NoError(t, err)
+
+	router := chi.NewRouter()
+	router.Get("/{shortURL}", h.GetHandle)
+	router.Head("/{shortURL}", h.GetHandle)
+	serve := func(method string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(method, "/"+shortURL, nil))
+		return w
+	}
+
+	assert.Equal(t, http.StatusTemporaryRedirect, serve(http.MethodHead).Code, "HEAD is not counted")
+	assert.Equal(t, http.StatusTemporaryRedirect, serve(http.MethodGet).Code)
+	w := serve(http.MethodGet)
+	assert.Equal(t, http.StatusGone, w.Code)
+	var problem models.Problem
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&problem))
+	assert.Equal(t, models.CodeClicksExhausted, problem.Code)
+}
+
+func TestURLHandler_GetHandleSchedule(t *testing.T) {
+	path := t.TempDir() + "/links.json"
+	store, err := storage.CreateStoreFile(path)
+	require.NoError(t, err)
+	h := URLHandler{Storage: store}
+	now := time.Now()
+	later, end, earlier := now.Add(time.Hour), now.Add(2*time.Hour), now.Add(-time.Hour)
+	scheduled, err := h.Save(context.Background(), "https://campaign.example/", "", models.LinkOptions{NotBefore: &later, ExpiresAt: &end})
+	require.NoError(t, err)
+	live, err := h.Save(context.Background(), "https://campaign.example/live", "", models.LinkOptions{NotBefore: &earlier})
+	require.NoError(t, err)
+	expired, err := h.Save(context.Background(), "https://campaign.example/over", "", models.LinkOptions{ExpiresAt: &earlier})
+	require.NoError(t, err)
+
+	router := chi.NewRouter()
+	router.Get("/{shortURL}", h.GetHandle)
+	serve := func(shortURL string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/"+shortURL, nil))
+		return w
+	}
+	problemCode := func(w *httptest.ResponseRecorder) string {
+		var problem models.Problem
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&problem))
+		return problem.Code
+	}
+
+	w := serve(scheduled)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, models.CodeNotYetActive, problemCode(w))
+	assert.Equal(t, "3600", w.Header().Get("Retry-After"))
+	assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+
+	h.ComingSoonURL = "https://example.com/soon"
+	w = serve(scheduled)
+	assert.Equal(t, http.StatusFound, w.Code)
+	assert.Equal(t, "https://example.com/soon", w.Header().Get("Location"))
+
+	assert.Equal(t, http.StatusTemporaryRedirect, serve(live).Code)
+
+	w = serve(expired)
+	assert.Equal(t, http.StatusGone, w.Code)
+	assert.Equal(t, models.CodeURLExpired, problemCode(w))
+
+	reopened, err := storage.CreateStoreFile(path)
+	require.NoError(t, err)
+	link, err := reopened.LoadURL(context.Background(), scheduled)
+	require.NoError(t, err)
+	require.NotNil(t, link.NotBefore)
+	require.NotNil(t, link.ExpiresAt)
+	assert.True(t, link.NotBefore.Equal(later))
+	assert.True(t, link.ExpiresAt.Equal(end))
+}
+
+func TestURLHandler_GetHandleTargets(t *testing.T) {
+	store, err := storage.CreateStoreFile("")
+	require.NoError(t, err)
+	h := URLHandler{Storage: store}
+	shortURL, err := h.Save(context.Background(), "https://app.example/", "", models.LinkOptions{Targets: []targeting.Rule{
+		{Platform: targeting.PlatformIOS, URL: "https://apps.apple.com/app/id1"},
+		{Platform: targeting.PlatformAndroid, URL: "https://play.google.com/store/apps/details?id=app"},
+	}})
+	require.NoError(t, err)
+
+	router := chi.NewRouter()
+	router.Get("/{shortURL}", h.GetHandle)
+	tests := []struct {
+		name      string
+		userAgent string
+		location  string
+	}{
+		{name: "iOS", userAgent: "Mozilla/5.0 (iPhone; CPU iPhone OS 17_4 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.4 Mobile/15E148 Safari/604.1", location: "https://apps.apple.com/app/id1"},
+		{name: "Android", userAgent: "Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.6367.82 Mobile Safari/537.36", location: "https://play.google.com/store/apps/details?id=app"},
+		{name: "desktop", userAgent: "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36", location: "https://app.example/"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/"+shortURL, nil)
+			req.Header.Set("User-Agent", tt.userAgent)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			assert.Equal(t, http.StatusTemporaryRedirect, w.Code)
+			assert.Equal(t, tt.location, w.Header().Get("Location"))
+			assert.Equal(t, []string{"User-Agent", "Accept-Language"}, w.Header().Values("Vary"))
+		})
+	}
+}
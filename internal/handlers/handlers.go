@@ -1,15 +1,25 @@
 package handlers
 
 import (
+	"context"
 	"crypto/sha1"
 	"encoding/base64"
-	"log"
+	"errors"
 	"net"
 	"net/http"
+	"time"
 
 	"github.com/scaranin/go-svc-short-url/internal/auth"
 	"github.com/scaranin/go-svc-short-url/internal/config"
+	"github.com/scaranin/go-svc-short-url/internal/logger"
+	"github.com/scaranin/go-svc-short-url/internal/middleware"
 	"github.com/scaranin/go-svc-short-url/internal/models"
+	"github.com/scaranin/go-svc-short-url/internal/policy"
+	"github.com/scaranin/go-svc-short-url/internal/urlnorm"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
 )
 
 const (
@@ -19,6 +29,14 @@ const (
 	contentTypeApJSON string = "application/json"
 )
 
+// tracer starts the spans of the handlers package.
+var tracer = otel.Tracer("github.com/scaranin/go-svc-short-url/internal/handlers")
+
+// errOptionsConflict is returned by URLHandler.Save instead of
+// models.ErrConflict when the request carries link options: the existing short
+// URL keeps its own options, so handing it out would silently drop them.
+var errOptionsConflict = errors.New("URL has already been shortened, its link options cannot be changed")
+
 // URLHandler is the primary struct that holds the service's dependencies and configuration.
 // It orchestrates operations by interacting with storage and authentication components.
 type URLHandler struct {
@@ -38,10 +56,41 @@ type URLHandler struct {
 	Auth auth.AuthConfig
 	// Trusted subnet
 	TrustedSubnet string
+	// Deletes queues bulk deletions for the background workers.
+	Deletes *DeleteQueue
+	// MaxURLLength is the maximum length of a URL to shorten. Zero means no limit.
+	MaxURLLength int
+	// AllowedSchemes are the schemes of URLs that may be shortened. Empty means
+	// http and https.
+	AllowedSchemes []string
+	// Canonicalization is the policy used to normalize URLs before they are hashed.
+	Canonicalization urlnorm.Policy
+	// Policy rejects blocked destinations when URLs are shortened and followed.
+	// A nil Policy allows every destination.
+	Policy *policy.Engine
+	// RedirectStatus is the status of redirects to links that do not choose
+	// their own. Zero means 307 Temporary Redirect.
+	RedirectStatus int
+	// ForwardQuery appends the query string of every short URL request to the
+	// original URL.
+	ForwardQuery bool
+	// RedirectMaxAge is how long clients may cache permanent redirects. A
+	// negative value disables caching of all redirects.
+	RedirectMaxAge time.Duration
+	// LinkAccessTTL is how long the cookie issued for the password of a
+	// protected link stays valid. Zero means 15 minutes.
+	LinkAccessTTL time.Duration
+	// ComingSoonStatus is the status of the response to a link that is not
+	// active yet. Zero means 404 Not Found.
+	ComingSoonStatus int
+	// ComingSoonURL, if set, is where links that are not active yet redirect
+	// to instead.
+	ComingSoonURL string
 }
 
 // CreateHandle initializes and returns a new URLHandler instance.
-// It is configured with application settings, a storage backend, and authentication configuration.
+// It is configured with application settings, a storage backend, and authentication configuration,
+// and starts the workers of the delete queue.
 func CreateHandle(cfg config.ShortenerConfig, store models.Storage, auth auth.AuthConfig) URLHandler {
 	var h URLHandler
 	h.BaseURL = cfg.BaseURL
@@ -49,6 +98,19 @@ func CreateHandle(cfg config.ShortenerConfig, store models.Storage, auth auth.Au
 	h.DSN = cfg.DSN
 	h.Auth = auth
 	h.TrustedSubnet = cfg.TrustedSubnet
+	h.Deletes = NewDeleteQueue(store, cfg.DeleteQueueSize, cfg.DeleteWorkers)
+	h.MaxURLLength = cfg.MaxURLLength
+	h.AllowedSchemes = cfg.AllowedSchemes
+	h.Canonicalization = urlnorm.Policy{
+		TrailingSlash: cfg.URLTrailingSlash,
+		StripParams:   cfg.URLStripParams,
+	}
+	h.RedirectStatus = cfg.RedirectStatus
+	h.ForwardQuery = cfg.RedirectForwardQuery
+	h.RedirectMaxAge = cfg.RedirectMaxAge
+	h.LinkAccessTTL = cfg.LinkAccessTTL
+	h.ComingSoonStatus = cfg.ComingSoonStatus
+	h.ComingSoonURL = cfg.ComingSoonURL
 	return h
 }
 
@@ -62,23 +124,95 @@ func ShortURLCalc(originalURL string) string {
 
 // Save adds a new record to the storage. It associates the URL with the
 // user ID stored in the handler's Auth field.
-// It calculates the short URL, creates the URL model, and passes it to the storage layer.
-func (h *URLHandler) Save(originalURL string, correlationID string) (string, error) {
-	shortURL := ShortURLCalc(originalURL)
+// It checks the destinations against Policy, canonicalizes the URL, calculates
+// the short URL from the canonical form, creates the URL model, and passes it
+// to the storage layer with the link options opts. The original URL is kept as
+// entered; a password in opts is stored as its bcrypt hash only. A URL shortened
+// before returns its short URL with models.ErrConflict, or errOptionsConflict
+// if opts sets any option.
+// The call is traced as a child of the span in ctx.
+func (h *URLHandler) Save(ctx context.Context, originalURL string, correlationID string, opts models.LinkOptions) (string, error) {
+	if err := h.checkDestinations(ctx, originalURL, opts); err != nil {
+		return "", err
+	}
+	return h.save(ctx, originalURL, correlationID, opts)
+}
+
+// checkDestinations checks the original URL and the URLs of the targets and
+// variants in opts against Policy.
+func (h *URLHandler) checkDestinations(ctx context.Context, originalURL string, opts models.LinkOptions) error {
+	if err := h.Policy.Check(ctx, originalURL); err != nil {
+		return err
+	}
+	for _, target := range opts.Targets {
+		if err := h.Policy.Check(ctx, target.URL); err != nil {
+			return err
+		}
+	}
+	for _, variant := range opts.Variants {
+		if err := h.Policy.Check(ctx, variant.URL); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// save is Save without the policy check, for callers that checked the
+// destination already.
+func (h *URLHandler) save(ctx context.Context, originalURL string, correlationID string, opts models.LinkOptions) (string, error) {
+	ctx, span := tracer.Start(ctx, "URLHandler.Save")
+	defer span.End()
+	canonicalURL, err := urlnorm.Normalize(originalURL, h.Canonicalization)
+	if err != nil {
+		return "", err
+	}
+	shortURL := ShortURLCalc(canonicalURL)
+	span.SetAttributes(attribute.String("shortener.short_url", shortURL))
+	hasOptions := !opts.IsZero()
+	var passwordHash string
+	if len(opts.Password) > 0 {
+		if passwordHash, err = hashPassword(opts.Password); err != nil {
+			return "", err
+		}
+		opts.Password = ""
+	}
 	var baseURL = models.URL{
 		CorrelationID: correlationID,
 		OriginalURL:   originalURL,
+		CanonicalURL:  canonicalURL,
 		ShortURL:      shortURL,
 		UserID:        h.Auth.UserID,
+		PasswordHash:  passwordHash,
+		LinkOptions:   opts,
+	}
+	shortURL, err = h.Storage.Save(ctx, &baseURL)
+	if errors.Is(err, models.ErrConflict) && hasOptions {
+		return shortURL, errOptionsConflict
 	}
-	shortURL, err := h.Storage.Save(&baseURL)
 	return shortURL, err
 }
 
 // Load retrieves the original URL from storage using its short URL identifier.
 // It delegates the call to the Load method of the configured Storage.
-func (h *URLHandler) Load(shortURL string) (string, error) {
-	return h.Storage.Load(shortURL)
+// The call is traced as a child of the span in ctx.
+func (h *URLHandler) Load(ctx context.Context, shortURL string) (string, error) {
+	ctx, span := tracer.Start(ctx, "URLHandler.Load", trace.WithAttributes(attribute.String("shortener.short_url", shortURL)))
+	defer span.End()
+	return h.Storage.Load(ctx, shortURL)
+}
+
+// LoadURL retrieves the whole record of a short URL, including its link
+// options, from storage. The call is traced as a child of the span in ctx.
+// An unknown short URL yields models.ErrNotFound, whichever way the storage
+// reports it.
+func (h *URLHandler) LoadURL(ctx context.Context, shortURL string) (models.URL, error) {
+	ctx, span := tracer.Start(ctx, "URLHandler.LoadURL", trace.WithAttributes(attribute.String("shortener.short_url", shortURL)))
+	defer span.End()
+	link, err := h.Storage.LoadURL(ctx, shortURL)
+	if err == nil && len(link.OriginalURL) == 0 {
+		err = models.ErrNotFound
+	}
+	return link, err
 }
 
 // CheckIP verifies if the IP address from the "X-Real-IP" header in the request
@@ -99,15 +233,45 @@ func (h *URLHandler) CheckIP(r *http.Request) bool {
 
 	_, subnet, err := net.ParseCIDR(h.TrustedSubnet)
 	if err != nil {
-		log.Println(err)
+		logger.FromContext(r.Context()).Warn("invalid trusted subnet", zap.String("subnet", h.TrustedSubnet), zap.Error(err))
 		return res
 	}
 
 	if subnet.Contains(ip) {
 		res = true
 	} else {
-		log.Println(err)
+		logger.FromContext(r.Context()).Warn("untrusted client IP", zap.String("ip", ipStr))
 	}
 
 	return res
 }
+
+// writeSaveError replies with the problem matching a failed URLHandler.Save:
+// 409 for link options that cannot be applied to an existing short URL, 403
+// for a destination rejected by the policy, 400 for a host that does not
+// resolve, and the storage problem otherwise.
+func writeSaveError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, errOptionsConflict):
+		middleware.WriteProblem(w, r, http.StatusConflict, models.CodeOptionsConflict, err.Error())
+	case errors.Is(err, policy.ErrBlocked):
+		middleware.WriteProblem(w, r, http.StatusForbidden, models.CodeDestinationBlocked, err.Error())
+	case errors.Is(err, policy.ErrPrivate):
+		middleware.WriteProblem(w, r, http.StatusForbidden, models.CodeDestinationPrivate, err.Error())
+	case errors.Is(err, policy.ErrUnresolvable):
+		middleware.WriteProblem(w, r, http.StatusBadRequest, models.CodeInvalidURL, err.Error())
+	default:
+		writeStorageError(w, r, err)
+	}
+}
+
+// writeStorageError replies with the problem matching a failed storage call:
+// 503 when the storage is unreachable and 500 otherwise.
+func writeStorageError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, models.ErrUnavailable) {
+		w.Header().Set("Retry-After", "1")
+		middleware.WriteProblem(w, r, http.StatusServiceUnavailable, models.CodeStorageUnavailable, err.Error())
+		return
+	}
+	middleware.WriteProblem(w, r, http.StatusInternalServerError, models.CodeInternal, err.Error())
+}
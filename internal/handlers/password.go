@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"html/template"
+	"net/http"
+	"time"
+
+	"github.com/scaranin/go-svc-short-url/internal/logger"
+	"github.com/scaranin/go-svc-short-url/internal/models"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// PasswordHeader carries the password of a protected short URL for
+	// clients that cannot fill in the password form.
+	PasswordHeader = "X-Link-Password"
+	// linkAccessCookie holds the token issued once the password of a short URL
+	// was given. It is scoped to the path of the short URL.
+	linkAccessCookie = "link_access"
+	// passwordField is the name of the password field of the password form.
+	passwordField = "password"
+	// maxPasswordLength is the longest password bcrypt can hash.
+	maxPasswordLength = 72
+	// defaultLinkAccessTTL is used when URLHandler.LinkAccessTTL is not set.
+	defaultLinkAccessTTL = 15 * time.Minute
+)
+
+// passwordTemplate renders the form asking for the password of a short URL.
+// It is posted back to the short URL itself.
+var passwordTemplate = template.Must(template.New("password").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="robots" content="noindex">
+<title>Password required</title>
+</head>
+<body>
+<main>
+<h1>This link is protected</h1>
+{{if .}}<p><strong>The password is wrong, please try again.</strong></p>{{end}}
+<form method="post">
+<label>Password <input type="password" name="password" autofocus required></label>
+<button type="submit">Continue</button>
+</form>
+</main>
+</body>
+</html>
+`))
+
+// hashPassword returns the bcrypt hash of password.
+func hashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	return string(hash), err
+}
+
+// unlock reports whether r may follow the password-protected link. The
+// password is accepted from the X-Link-Password header or from the posted
+// password form; a form password that matches is exchanged for a signed
+// cookie valid for LinkAccessTTL, so the browser is not asked again. A cookie
+// issued earlier unlocks the link as well. Otherwise the password form is
+// written with HTTP 401 Unauthorized and false is returned.
+func (h *URLHandler) unlock(w http.ResponseWriter, r *http.Request, link models.URL) bool {
+	if password := r.Header.Get(PasswordHeader); len(password) > 0 {
+		if checkPassword(link, password) {
+			return true
+		}
+		writePasswordForm(w, r, true)
+		return false
+	}
+	if cookie, err := r.Cookie(linkAccessCookie); err == nil && h.Auth.ParseLinkToken(cookie.Value, link.ShortURL) {
+		return true
+	}
+	if r.Method != http.MethodPost {
+		writePasswordForm(w, r, false)
+		return false
+	}
+	if !checkPassword(link, r.PostFormValue(passwordField)) {
+		writePasswordForm(w, r, true)
+		return false
+	}
+
+	ttl := h.LinkAccessTTL
+	if ttl <= 0 {
+		ttl = defaultLinkAccessTTL
+	}
+	token, err := h.Auth.BuildLinkToken(link.ShortURL, ttl)
+	if err != nil {
+		logger.FromContext(r.Context()).Error("link access token not issued", zap.Error(err))
+		return true
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     linkAccessCookie,
+		Value:    token,
+		Path:     "/" + link.ShortURL,
+		Expires:  time.Now().Add(ttl),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return true
+}
+
+// checkPassword reports whether password matches the password hash of link.
+func checkPassword(link models.URL, password string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(link.PasswordHash), []byte(password)) == nil
+}
+
+// writePasswordForm writes the password form, telling the user that the
+// previous password was wrong if wrong is set.
+func writePasswordForm(w http.ResponseWriter, r *http.Request, wrong bool) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("WWW-Authenticate", `Link-Password realm="short link"`)
+	w.WriteHeader(http.StatusUnauthorized)
+	if err := passwordTemplate.Execute(w, wrong); err != nil {
+		logger.FromContext(r.Context()).Error("password form not rendered", zap.Error(err))
+	}
+}
@@ -1,34 +1,105 @@
 package handlers
 
 import (
-	"log"
+	"context"
+	"encoding/json"
+	"fmt"
 	"net/http"
+	"time"
 
-	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/scaranin/go-svc-short-url/internal/middleware"
+	"github.com/scaranin/go-svc-short-url/internal/models"
 )
 
-// PingHandle serves as an HTTP handler to check the health of the database connection.
-// It attempts to create a new connection pool using the DSN from the handler
-// and then pings the database to verify connectivity.
+// healthCheckTimeout bounds the storage calls made by the health endpoints.
+const healthCheckTimeout = 2 * time.Second
+
+// PingHandle serves as an HTTP handler to check the health of the storage.
+// It pings the active storage through the connection pool the application
+// already holds. Storages that do not implement models.Pinger, such as the
+// in-memory one, are always reachable.
 //
-// On success, it responds with an HTTP 200 OK status. If creating the connection pool
-// or the ping fails, it responds with an HTTP 500 Internal Server Error.
+// On success, it responds with an HTTP 200 OK status. If the ping fails, it
+// responds with an HTTP 500 Internal Server Error.
 func (h *URLHandler) PingHandle(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", contentTypeTextPlain)
-	pool, err := pgxpool.New(r.Context(), h.DSN)
-	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		log.Println(err)
-		return
+	if pinger, ok := h.Storage.(models.Pinger); ok {
+		ctx, cancel := context.WithTimeout(r.Context(), healthCheckTimeout)
+		defer cancel()
+		if err := pinger.Ping(ctx); err != nil {
+			middleware.WriteProblem(w, r, http.StatusInternalServerError, models.CodeStorageUnavailable, err.Error())
+			return
+		}
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// HealthzHandle is the liveness probe. It responds with HTTP 200 OK as long as
+// the process is able to serve requests and does not touch the storage.
+func (h *URLHandler) HealthzHandle(w http.ResponseWriter, r *http.Request) {
+	writeHealthJSON(w, http.StatusOK, models.HealthCheck{Status: "ok"})
+}
+
+// ReadyzHandle is the readiness probe. It checks that the storage is reachable,
+// that its schema migrations are applied and that the delete queue still
+// accepts deletions. It responds with HTTP 200 OK when all checks pass and with
+// HTTP 503 Service Unavailable otherwise; in both cases the body is a JSON
+// models.Readiness with the result of each check.
+func (h *URLHandler) ReadyzHandle(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), healthCheckTimeout)
+	defer cancel()
+
+	readiness := models.Readiness{Status: "ok", Checks: make(map[string]models.HealthCheck)}
+	check := func(name string, err error, detail string) {
+		result := models.HealthCheck{Status: "ok", Detail: detail}
+		if err != nil {
+			result = models.HealthCheck{Status: "fail", Detail: err.Error()}
+			readiness.Status = "fail"
+		}
+		readiness.Checks[name] = result
 	}
-	defer pool.Close()
 
-	err = pool.Ping(r.Context())
+	var err error
+	if pinger, ok := h.Storage.(models.Pinger); ok {
+		err = pinger.Ping(ctx)
+	}
+	check("storage", err, "")
+
+	if migrator, ok := h.Storage.(models.Migrator); ok {
+		pending, err := migrator.PendingMigrations(ctx)
+		if err == nil && pending > 0 {
+			err = fmt.Errorf("%d migrations pending", pending)
+		}
+		check("migrations", err, "")
+	} else {
+		check("migrations", nil, "")
+	}
+
+	if h.Deletes != nil {
+		err = nil
+		if h.Deletes.Saturated() {
+			err = fmt.Errorf("queue is full: %d/%d", h.Deletes.Len(), h.Deletes.Cap())
+		}
+		check("delete_queue", err, fmt.Sprintf("%d/%d", h.Deletes.Len(), h.Deletes.Cap()))
+	}
+
+	status := http.StatusOK
+	if readiness.Status != "ok" {
+		status = http.StatusServiceUnavailable
+	}
+	writeHealthJSON(w, status, readiness)
+}
+
+// writeHealthJSON writes body as the JSON response of a health endpoint.
+func writeHealthJSON(w http.ResponseWriter, status int, body any) {
+	buf, err := json.Marshal(body)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
-		log.Println(err)
 		return
 	}
-
-	w.WriteHeader(http.StatusOK)
+	w.Header().Set("Content-Type", contentTypeApJSON)
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	w.Write(buf)
 }
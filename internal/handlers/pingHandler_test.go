@@ -1,12 +1,19 @@
 package handlers_test
 
 import (
+	"context"
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/scaranin/go-svc-short-url/internal/handlers"
+	"github.com/scaranin/go-svc-short-url/internal/models"
+	"github.com/scaranin/go-svc-short-url/internal/storage"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestURLHandler_PingHandle(t *testing.T) {
@@ -67,3 +74,56 @@ func BenchmarkPingHandle(b *testing.B) {
 	}
 
 }
+
+// blockingStorage holds DeleteBulk until release is closed, keeping the delete queue busy.
+type blockingStorage struct {
+	storage.FileStorageJSON
+	release chan struct{}
+}
+
+func (s blockingStorage) DeleteBulk(ctx context.Context, UserID string, ShortURLs []string) error {
+	<-s.release
+	return s.FileStorageJSON.DeleteBulk(ctx, UserID, ShortURLs)
+}
+
+func TestURLHandler_HealthzHandle(t *testing.T) {
+	h := &handlers.URLHandler{}
+	w := httptest.NewRecorder()
+	h.HealthzHandle(w, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"status":"ok"}`, w.Body.String())
+}
+
+func TestURLHandler_ReadyzHandle(t *testing.T) {
+	fs, err := storage.CreateStoreFile("")
+	require.NoError(t, err)
+	store := blockingStorage{FileStorageJSON: fs, release: make(chan struct{})}
+	h := &handlers.URLHandler{Storage: store, Deletes: handlers.NewDeleteQueue(store, 1, 1)}
+	defer h.Deletes.Close()
+
+	w := httptest.NewRecorder()
+	h.ReadyzHandle(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"status":"ok","checks":{
+		"storage":{"status":"ok"},
+		"migrations":{"status":"ok"},
+		"delete_queue":{"status":"ok","detail":"0/1"}}}`, w.Body.String())
+
+	// The first job occupies the worker, the second one fills the queue.
+	require.True(t, h.Deletes.Enqueue(context.Background(), "user", []string{"a"}))
+	require.Eventually(t, func() bool { return h.Deletes.Len() == 0 }, time.Second, time.Millisecond)
+	require.True(t, h.Deletes.Enqueue(context.Background(), "user", []string{"b"}))
+	assert.False(t, h.Deletes.Enqueue(context.Background(), "user", []string{"c"}))
+
+	w = httptest.NewRecorder()
+	h.ReadyzHandle(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	var readiness models.Readiness
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &readiness))
+	assert.Equal(t, "fail", readiness.Status)
+	assert.Equal(t, "fail", readiness.Checks["delete_queue"].Status)
+	assert.Equal(t, "ok", readiness.Checks["storage"].Status)
+
+	close(store.release)
+}
@@ -2,19 +2,28 @@ package handlers
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
-	"log"
+	"errors"
+	"fmt"
 	"net/http"
 
 	"github.com/jackc/pgerrcode"
 	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/scaranin/go-svc-short-url/internal/logger"
+	"github.com/scaranin/go-svc-short-url/internal/middleware"
 	"github.com/scaranin/go-svc-short-url/internal/models"
+	"go.uber.org/zap"
 )
 
 // post is an internal helper function that handles the logic for creating a single short URL.
 // It is designed to be called by public-facing handlers like PostHandle and PostHandleJSON.
 // It orchestrates user authentication, request parsing based on the `postKind` content type,
-// saving the URL, and formatting the response.
+// URL validation, saving the URL, and formatting the response.
+//
+// A body that cannot be parsed or an invalid URL is rejected with HTTP 400 Bad
+// Request, a body over the route's size limit with HTTP 413 and a destination
+// rejected by the policy with HTTP 403 Forbidden.
 //
 // A key feature is its ability to handle database conflicts: if a unique constraint
 // violation occurs, it returns an HTTP 409 Conflict status. Otherwise, it returns
@@ -25,20 +34,24 @@ func (h *URLHandler) post(w http.ResponseWriter, r *http.Request, postKind strin
 	w.Header().Set("Content-Type", postKind)
 	defer r.Body.Close()
 
-	url, err := h.parseRequestBody(r, postKind)
+	req, err := h.parseRequestBody(r, postKind)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeBodyError(w, r, err)
 		return
 	}
 
-	if len(url) == 0 {
-		w.WriteHeader(http.StatusCreated)
+	if err = h.validateURL(req.URL); err != nil {
+		middleware.WriteProblem(w, r, http.StatusBadRequest, models.CodeInvalidURL, err.Error())
+		return
+	}
+	if err = h.validateOptions(req.LinkOptions); err != nil {
+		middleware.WriteProblem(w, r, http.StatusBadRequest, models.CodeInvalidRequest, err.Error())
 		return
 	}
 
-	resp, statusCode, err := h.saveURLAndBuildResponse(url, postKind)
+	resp, statusCode, err := h.saveURLAndBuildResponse(r.Context(), req, postKind)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeSaveError(w, r, err)
 		return
 	}
 
@@ -51,54 +64,58 @@ func (h *URLHandler) post(w http.ResponseWriter, r *http.Request, postKind strin
 func (h *URLHandler) handleCookies(w http.ResponseWriter, r *http.Request) {
 	cookieR, err := r.Cookie(h.Auth.CookieName)
 	if err != nil {
-		log.Print(err.Error())
+		logger.FromContext(r.Context()).Debug("no auth cookie", zap.Error(err))
 	}
 	cookieW, err := h.Auth.FillUserReturnCookie(cookieR)
 	if err != nil {
-		log.Print(err.Error())
+		logger.FromContext(r.Context()).Debug("auth cookie rejected", zap.Error(err))
+	} else {
+		logger.SetUserID(r.Context(), h.Auth.UserID)
 	}
 	http.SetCookie(w, cookieW)
 }
 
 // parseRequestBody reads and parses the HTTP request body,
-// returning the URL as a byte slice.
+// returning the URL and its link options.
 // Supports two content types:
-// - contentTypeTextPlain: returns the raw request body;
-// - contentTypeApJSON: parses JSON and extracts the URL field.
+// - contentTypeTextPlain: the URL is the request body without surrounding
+// whitespace, with the default link options;
+// - contentTypeApJSON: parses the JSON request with its link options.
 // Returns an error if parsing fails.
-func (h *URLHandler) parseRequestBody(r *http.Request, postKind string) ([]byte, error) {
+func (h *URLHandler) parseRequestBody(r *http.Request, postKind string) (models.Request, error) {
 	var buf bytes.Buffer
+	var req models.Request
 	_, err := buf.ReadFrom(r.Body)
 	if err != nil {
-		return nil, err
+		return req, err
 	}
 
 	if postKind == contentTypeTextPlain {
-		return buf.Bytes(), nil
+		req.URL = string(bytes.TrimSpace(buf.Bytes()))
 	} else if postKind == contentTypeApJSON {
-		var req models.Request
 		if err := json.Unmarshal(buf.Bytes(), &req); err != nil {
-			return nil, err
+			return req, err
 		}
-		return []byte(req.URL), nil
 	}
-	return nil, nil
+	return req, nil
 }
 
 // saveURLAndBuildResponse saves the URL in storage and builds the HTTP response body.
 // Returns the response body, HTTP status code, and an error if any occurs.
-// Handles database unique constraint violations by returning HTTP 409 Conflict.
+// Handles database unique constraint violations and models.ErrConflict by returning HTTP 409 Conflict.
+// Any other error of URLHandler.Save is returned.
 // Response format depends on postKind:
 // - contentTypeTextPlain: returns the short URL as plain text;
-// - contentTypeApJSON: returns JSON containing the short URL in the "Result" field.
-func (h *URLHandler) saveURLAndBuildResponse(url []byte, postKind string) ([]byte, int, error) {
-	shortURL, pgErr := h.Save(string(url), "")
+// - contentTypeApJSON: returns JSON containing the short URL in the "Result" field
+// and the URL of its QR code in the "QRURL" field.
+func (h *URLHandler) saveURLAndBuildResponse(ctx context.Context, req models.Request, postKind string) ([]byte, int, error) {
+	shortURL, pgErr := h.Save(ctx, req.URL, "", req.LinkOptions)
 
 	var resp []byte
 	if postKind == contentTypeTextPlain {
 		resp = []byte(h.BaseURL + shortURL)
 	} else if postKind == contentTypeApJSON {
-		response := models.Response{Result: h.BaseURL + shortURL}
+		response := models.Response{Result: h.BaseURL + shortURL, QRURL: h.qrURL(shortURL)}
 		var err error
 		resp, err = json.Marshal(response)
 		if err != nil {
@@ -110,6 +127,10 @@ func (h *URLHandler) saveURLAndBuildResponse(url []byte, postKind string) ([]byt
 		if pgError, ok := pgErr.(*pgconn.PgError); ok && pgError.Code == pgerrcode.UniqueViolation {
 			return resp, http.StatusConflict, nil
 		}
+		if errors.Is(pgErr, models.ErrConflict) {
+			return resp, http.StatusConflict, nil
+		}
+		return nil, 0, pgErr
 	}
 
 	return resp, http.StatusCreated, nil
@@ -129,9 +150,15 @@ func (h *URLHandler) PostHandleJSON(w http.ResponseWriter, r *http.Request) {
 }
 
 // PostHandleJSONBatch handles requests to shorten multiple URLs in a single batch operation.
-// It expects a JSON array of objects, each with a `correlation_id` and an `original_url`.
+// It expects a JSON array of objects, each with a `correlation_id`, an
+// `original_url` and optionally the link options.
 // It authenticates the user, processes each URL, and returns a JSON array of corresponding
-// objects with the `correlation_id` and the new `short_url`.
+// objects with the `correlation_id` and the new `short_url`. An empty batch or
+// an invalid URL rejects the whole batch with HTTP 400 Bad Request, and a
+// destination rejected by the policy with HTTP 403 Forbidden; the
+// destinations are checked before any URL is saved. A URL that cannot be
+// saved stops the batch with the matching problem, e.g. HTTP 503 Service
+// Unavailable; the URLs saved before it are kept.
 func (h *URLHandler) PostHandleJSONBatch(w http.ResponseWriter, r *http.Request) {
 	var (
 		data         []byte
@@ -143,38 +170,63 @@ func (h *URLHandler) PostHandleJSONBatch(w http.ResponseWriter, r *http.Request)
 	)
 	cookieR, err := r.Cookie(h.Auth.CookieName)
 	if err != nil {
-		log.Print(err.Error())
+		logger.FromContext(r.Context()).Debug("no auth cookie", zap.Error(err))
 	}
 	cookieW, err := h.Auth.FillUserReturnCookie(cookieR)
 	if err != nil {
-		log.Print(err.Error())
+		logger.FromContext(r.Context()).Debug("auth cookie rejected", zap.Error(err))
+	} else {
+		logger.SetUserID(r.Context(), h.Auth.UserID)
 	}
 	_, err = buf.ReadFrom(r.Body)
 	defer r.Body.Close()
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeBodyError(w, r, err)
 		return
 	}
 	data = buf.Bytes()
 
 	if err := json.Unmarshal(data, &pairRequest); err != nil {
-		log.Fatal("Error parsing JSON:", err)
+		middleware.WriteProblem(w, r, http.StatusBadRequest, models.CodeInvalidRequest, err.Error())
+		return
+	}
+	if len(pairRequest) == 0 {
+		middleware.WriteProblem(w, r, http.StatusBadRequest, models.CodeInvalidRequest, "batch is empty")
+		return
+	}
+	for _, pair := range pairRequest {
+		if err := h.validateURL(pair.OriginalURL); err != nil {
+			middleware.WriteProblem(w, r, http.StatusBadRequest, models.CodeInvalidURL,
+				fmt.Sprintf("correlation_id %q: %v", pair.CorrelationID, err))
+			return
+		}
+		if err := h.validateOptions(pair.LinkOptions); err != nil {
+			middleware.WriteProblem(w, r, http.StatusBadRequest, models.CodeInvalidRequest,
+				fmt.Sprintf("correlation_id %q: %v", pair.CorrelationID, err))
+			return
+		}
+		if err := h.checkDestinations(r.Context(), pair.OriginalURL, pair.LinkOptions); err != nil {
+			writeSaveError(w, r, fmt.Errorf("correlation_id %q: %w", pair.CorrelationID, err))
+			return
+		}
 	}
 
 	for _, pair := range pairRequest {
-		sourtURL, _ := h.Save(pair.OriginalURL, pair.CorrelationID)
+		sourtURL, err := h.save(r.Context(), pair.OriginalURL, pair.CorrelationID, pair.LinkOptions)
+		if err != nil && !errors.Is(err, models.ErrConflict) {
+			writeSaveError(w, r, fmt.Errorf("correlation_id %q: %w", pair.CorrelationID, err))
+			return
+		}
 		newPair := models.PairResponse{
 			CorrelationID: pair.CorrelationID,
 			ShortURL:      h.BaseURL + sourtURL,
 		}
 		pairResponse = append(pairResponse, newPair)
-		var URL = models.URL{CorrelationID: pair.CorrelationID, OriginalURL: pair.OriginalURL, ShortURL: ShortURLCalc(pair.OriginalURL)}
-		h.Storage.Save(&URL)
 	}
 
 	resp, err = json.Marshal(pairResponse)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		middleware.WriteProblem(w, r, http.StatusInternalServerError, models.CodeInternal, err.Error())
 		return
 	}
 
@@ -1,17 +1,25 @@
 package handlers_test
 
 import (
+	"context"
+	"encoding/json"
 	"io"
 	"log"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/go-chi/chi"
 	"github.com/scaranin/go-svc-short-url/internal/auth"
 	"github.com/scaranin/go-svc-short-url/internal/config"
 	"github.com/scaranin/go-svc-short-url/internal/handlers"
+	"github.com/scaranin/go-svc-short-url/internal/middleware"
+	"github.com/scaranin/go-svc-short-url/internal/models"
+	"github.com/scaranin/go-svc-short-url/internal/policy"
 	"github.com/scaranin/go-svc-short-url/internal/storage"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -54,7 +62,7 @@ func TestURLHandler_PostHandle(t *testing.T) {
 	if err != nil {
 		return
 	}
-	store, err := storage.CreateStoreFile(cfg.FileStoragePath)
+	store, err := storage.CreateStoreFile(filepath.Join(t.TempDir(), cfg.FileStoragePath))
 	if err != nil {
 		return
 	}
@@ -104,7 +112,25 @@ func TestURLHandler_PostHandleJson(t *testing.T) {
 			want: want{
 				statusCode:  http.StatusCreated,
 				request:     `{"url": "https://practicum.yandex.ru"}`,
-				response:    `{"result":"http://localhost:8080/7CwAhsKqdvt3oSw8T1fXFwxdMLY="}`,
+				response:    `{"result":"http://localhost:8080/pkmdI_i-nYcS6P7hSfjTtWUmfcA=","qr_url":"http://localhost:8080/pkmdI_i-nYcS6P7hSfjTtWUmfcA=/qr"}`,
+				contentType: "application/json",
+			},
+		},
+		{
+			name: "post json handle normalized scheme, host and port",
+			want: want{
+				statusCode:  http.StatusConflict,
+				request:     `{"url": "HTTPS://Practicum.Yandex.ru:443"}`,
+				response:    `{"result":"http://localhost:8080/pkmdI_i-nYcS6P7hSfjTtWUmfcA=","qr_url":"http://localhost:8080/pkmdI_i-nYcS6P7hSfjTtWUmfcA=/qr"}`,
+				contentType: "application/json",
+			},
+		},
+		{
+			name: "post json handle normalized host and root slash",
+			want: want{
+				statusCode:  http.StatusConflict,
+				request:     `{"url": "https://PRACTICUM.yandex.ru./"}`,
+				response:    `{"result":"http://localhost:8080/pkmdI_i-nYcS6P7hSfjTtWUmfcA=","qr_url":"http://localhost:8080/pkmdI_i-nYcS6P7hSfjTtWUmfcA=/qr"}`,
 				contentType: "application/json",
 			},
 		},
@@ -113,7 +139,7 @@ func TestURLHandler_PostHandleJson(t *testing.T) {
 	if err != nil {
 		return
 	}
-	store, err := storage.CreateStoreFile(cfg.FileStoragePath)
+	store, err := storage.CreateStoreFile(filepath.Join(t.TempDir(), cfg.FileStoragePath))
 	if err != nil {
 		return
 	}
@@ -176,3 +202,219 @@ func BenchmarkPost(b *testing.B) {
 	}
 
 }
+
+func TestURLHandler_PostHandleJSONBatchInvalid(t *testing.T) {
+	store, err := storage.CreateStoreFile("")
+	require.NoError(t, err)
+	h := handlers.URLHandler{Storage: store, Auth: auth.NewAuthConfig()}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/shorten/batch", strings.NewReader(`[{"correlation_id":`))
+	req.Header.Set("content-type", "application/json")
+	rec := httptest.NewRecorder()
+	h.PostHandleJSONBatch(rec, req)
+
+	res := rec.Result()
+	defer res.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+	assert.Equal(t, "application/problem+json", res.Header.Get("content-type"))
+	var problem models.Problem
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&problem))
+	assert.Equal(t, models.CodeInvalidRequest, problem.Code)
+}
+
+func TestURLHandler_PostHandleValidation(t *testing.T) {
+	store, err := storage.CreateStoreFile("")
+	require.NoError(t, err)
+	h := handlers.URLHandler{Storage: store, Auth: auth.NewAuthConfig(), MaxURLLength: 40}
+
+	tests := []struct {
+		name       string
+		handler    http.Handler
+		body       string
+		wantStatus int
+		wantCode   string
+	}{
+		{name: "plain URL with whitespace", handler: http.HandlerFunc(h.PostHandle), body: " https://example.com/a\n", wantStatus: http.StatusCreated},
+		{name: "empty plain body", handler: http.HandlerFunc(h.PostHandle), body: "", wantStatus: http.StatusBadRequest, wantCode: models.CodeInvalidURL},
+		{name: "javascript scheme", handler: http.HandlerFunc(h.PostHandle), body: "javascript:alert(1)", wantStatus: http.StatusBadRequest, wantCode: models.CodeInvalidURL},
+		{name: "relative URL", handler: http.HandlerFunc(h.PostHandle), body: "/just/a/path", wantStatus: http.StatusBadRequest, wantCode: models.CodeInvalidURL},
+		{name: "URL without host", handler: http.HandlerFunc(h.PostHandle), body: "https:///path", wantStatus: http.StatusBadRequest, wantCode: models.CodeInvalidURL},
+		{name: "too long URL", handler: http.HandlerFunc(h.PostHandle), body: "https://example.com/" + strings.Repeat("a", 30), wantStatus: http.StatusBadRequest, wantCode: models.CodeInvalidURL},
+		{name: "JSON with empty URL", handler: http.HandlerFunc(h.PostHandleJSON), body: `{"url":""}`, wantStatus: http.StatusBadRequest, wantCode: models.CodeInvalidURL},
+		{name: "malformed JSON", handler: http.HandlerFunc(h.PostHandleJSON), body: `{"url":`, wantStatus: http.StatusBadRequest, wantCode: models.CodeInvalidRequest},
+		{name: "JSON with redirect status", handler: http.HandlerFunc(h.PostHandleJSON), body: `{"url":"https://example.com/r","redirect_status":308}`, wantStatus: http.StatusCreated},
+		{name: "JSON with invalid redirect status", handler: http.HandlerFunc(h.PostHandleJSON), body: `{"url":"https://example.com/r","redirect_status":200}`, wantStatus: http.StatusBadRequest, wantCode: models.CodeInvalidRequest},
+		{name: "JSON with too long password", handler: http.HandlerFunc(h.PostHandleJSON), body: `{"url":"https://example.com/p","password":"` + strings.Repeat("p", 73) + `"}`, wantStatus: http.StatusBadRequest, wantCode: models.CodeInvalidRequest},
+		{name: "JSON with negative max clicks", handler: http.HandlerFunc(h.PostHandleJSON), body: `{"url":"https://example.com/c","max_clicks":-1}`, wantStatus: http.StatusBadRequest, wantCode: models.CodeInvalidRequest},
+		{name: "JSON expiring before activation", handler: http.HandlerFunc(h.PostHandleJSON), body: `{"url":"https://example.com/d","not_before":"2030-01-02T00:00:00Z","expires_at":"2030-01-01T00:00:00Z"}`, wantStatus: http.StatusBadRequest, wantCode: models.CodeInvalidRequest},
+		{name: "JSON already expired", handler: http.HandlerFunc(h.PostHandleJSON), body: `{"url":"https://example.com/e","expires_at":"2020-01-01T00:00:00Z"}`, wantStatus: http.StatusBadRequest, wantCode: models.CodeInvalidRequest},
+		{name: "JSON with unknown target platform", handler: http.HandlerFunc(h.PostHandleJSON), body: `{"url":"https://example.com/f","targets":[{"platform":"symbian","url":"https://example.com/s"}]}`, wantStatus: http.StatusBadRequest, wantCode: models.CodeInvalidRequest},
+		{name: "JSON with invalid target URL", handler: http.HandlerFunc(h.PostHandleJSON), body: `{"url":"https://example.com/g","targets":[{"platform":"ios","url":"ftp://example.com/app"}]}`, wantStatus: http.StatusBadRequest, wantCode: models.CodeInvalidRequest},
+		{name: "JSON with duplicate variant names", handler: http.HandlerFunc(h.PostHandleJSON), body: `{"url":"https://example.com/h","variants":[{"name":"a","url":"https://example.com/a","weight":1},{"name":"a","url":"https://example.com/b","weight":1}]}`, wantStatus: http.StatusBadRequest, wantCode: models.CodeInvalidRequest},
+		{name: "empty batch", handler: http.HandlerFunc(h.PostHandleJSONBatch), body: `[]`, wantStatus: http.StatusBadRequest, wantCode: models.CodeInvalidRequest},
+		{
+			name:       "batch with invalid URL",
+			handler:    http.HandlerFunc(h.PostHandleJSONBatch),
+			body:       `[{"correlation_id":"1","original_url":"https://example.com"},{"correlation_id":"2","original_url":"data:text/html,x"}]`,
+			wantStatus: http.StatusBadRequest,
+			wantCode:   models.CodeInvalidURL,
+		},
+		{
+			name:       "body over the limit",
+			handler:    middleware.WithBodyLimit(16)(http.HandlerFunc(h.PostHandle)),
+			body:       "https://example.com/0123456789",
+			wantStatus: http.StatusRequestEntityTooLarge,
+			wantCode:   models.CodeBodyTooLarge,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tt.body))
+			rec := httptest.NewRecorder()
+			tt.handler.ServeHTTP(rec, req)
+
+			res := rec.Result()
+			defer res.Body.Close()
+			assert.Equal(t, tt.wantStatus, res.StatusCode)
+			if len(tt.wantCode) == 0 {
+				return
+			}
+			var problem models.Problem
+			require.NoError(t, json.NewDecoder(res.Body).Decode(&problem))
+			assert.Equal(t, tt.wantCode, problem.Code)
+		})
+	}
+}
+
+func TestURLHandler_PostHandleCanonical(t *testing.T) {
+	store, err := storage.CreateStoreBolt(filepath.Join(t.TempDir(), "links.db"))
+	require.NoError(t, err)
+	defer store.Close()
+	h := handlers.URLHandler{Storage: store, Auth: auth.NewAuthConfig(), BaseURL: "http://localhost:8080/"}
+
+	post := func(body string) (int, string) {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+		rec := httptest.NewRecorder()
+		h.PostHandle(rec, req)
+		return rec.Code, rec.Body.String()
+	}
+
+	status, first := post("http://example.com")
+	assert.Equal(t, http.StatusCreated, status)
+	for _, spelling := range []string{"HTTP://Example.com", "http://example.com/", "http://example.com:80"} {
+		status, shortURL := post(spelling)
+		assert.Equal(t, http.StatusConflict, status, spelling)
+		assert.Equal(t, first, shortURL, spelling)
+	}
+
+	originalURL, err := store.Load(context.Background(), strings.TrimPrefix(first, h.BaseURL))
+	require.NoError(t, err)
+	assert.Equal(t, "http://example.com", originalURL, "the original input is kept")
+}
+
+func TestURLHandler_PostHandlePolicy(t *testing.T) {
+	policyFile := filepath.Join(t.TempDir(), "policy.txt")
+	require.NoError(t, os.WriteFile(policyFile, []byte("deny blocked.example\n"), 0o644))
+	engine, err := policy.New(policyFile, false)
+	require.NoError(t, err)
+
+	store, err := storage.CreateStoreBolt(filepath.Join(t.TempDir(), "links.db"))
+	require.NoError(t, err)
+	defer store.Close()
+	h := handlers.URLHandler{Storage: store, Auth: auth.NewAuthConfig(), BaseURL: "http://localhost:8080/", Policy: engine}
+	router := chi.NewRouter()
+	router.Post("/", h.PostHandle)
+	router.Post("/api/shorten/batch", h.PostHandleJSONBatch)
+	router.Get("/{shortURL}", h.GetHandle)
+
+	serve := func(method, target, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(method, target, strings.NewReader(body)))
+		return rec
+	}
+
+	rec := serve(http.MethodPost, "/", "https://www.blocked.example/page")
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	assert.Contains(t, rec.Body.String(), models.CodeDestinationBlocked)
+
+	rec = serve(http.MethodPost, "/api/shorten/batch",
+		`[{"correlation_id":"1","original_url":"https://ok.example"},{"correlation_id":"2","original_url":"https://blocked.example"}]`)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	assert.Contains(t, rec.Body.String(), `correlation_id \"2\"`)
+
+	rec = serve(http.MethodPost, "/", "https://ok.example/page")
+	require.Equal(t, http.StatusCreated, rec.Code)
+	shortURL := strings.TrimPrefix(rec.Body.String(), h.BaseURL)
+
+	rec = serve(http.MethodGet, "/"+shortURL, "")
+	assert.Equal(t, http.StatusTemporaryRedirect, rec.Code)
+
+	require.NoError(t, os.WriteFile(policyFile, []byte("deny blocked.example\ndeny ok.example\n"), 0o644))
+	require.NoError(t, engine.Reload())
+	rec = serve(http.MethodGet, "/"+shortURL, "")
+	assert.Equal(t, http.StatusUnavailableForLegalReasons, rec.Code)
+	assert.Contains(t, rec.Body.String(), models.CodeDestinationBlocked)
+}
+
+// unavailableStorage fails every Save as if the storage could not be reached.
+type unavailableStorage struct {
+	storage.FileStorageJSON
+}
+
+func (s unavailableStorage) Save(ctx context.Context, URL *models.URL) (string, error) {
+	return "", models.ErrUnavailable
+}
+
+func TestURLHandler_PostHandleJSONBatchSaveError(t *testing.T) {
+	fs, err := storage.CreateStoreFile("")
+	require.NoError(t, err)
+	h := handlers.URLHandler{Storage: unavailableStorage{fs}, Auth: auth.NewAuthConfig(), BaseURL: "http://localhost:8080/"}
+
+	body := `[{"correlation_id":"1","original_url":"https://example.com/a"}]`
+	w := httptest.NewRecorder()
+	h.PostHandleJSONBatch(w, httptest.NewRequest(http.MethodPost, "/api/shorten/batch", strings.NewReader(body)))
+
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	var problem models.Problem
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&problem))
+	assert.Equal(t, models.CodeStorageUnavailable, problem.Code)
+	assert.Contains(t, problem.Detail, `correlation_id "1"`)
+}
+
+func TestURLHandler_PostHandleJSONOptionsConflict(t *testing.T) {
+	store, err := storage.CreateStoreFile("")
+	require.NoError(t, err)
+	h := handlers.URLHandler{Storage: store, Auth: auth.NewAuthConfig(), BaseURL: "http://localhost:8080/"}
+	post := func(handler http.HandlerFunc, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest(http.MethodPost, "/api/shorten", strings.NewReader(body)))
+		return w
+	}
+
+	require.Equal(t, http.StatusCreated, post(h.PostHandleJSON, `{"url":"https://example.com/dup"}`).Code)
+	assert.Equal(t, http.StatusConflict, post(h.PostHandleJSON, `{"url":"https://example.com/dup"}`).Code, "a plain resend gets the existing short URL")
+
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		body    string
+	}{
+		{name: "password", handler: h.PostHandleJSON, body: `{"url":"https://example.com/dup","password":"secret"}`},
+		{name: "max clicks", handler: h.PostHandleJSON, body: `{"url":"https://example.com/dup","max_clicks":1}`},
+		{name: "redirect status", handler: h.PostHandleJSON, body: `{"url":"https://example.com/dup","redirect_status":301}`},
+		{name: "batch", handler: h.PostHandleJSONBatch, body: `[{"correlation_id":"1","original_url":"https://example.com/dup","max_clicks":1}]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := post(tt.handler, tt.body)
+			assert.Equal(t, http.StatusConflict, w.Code)
+			var problem models.Problem
+			require.NoError(t, json.NewDecoder(w.Body).Decode(&problem))
+			assert.Equal(t, models.CodeOptionsConflict, problem.Code)
+		})
+	}
+
+	link, err := store.LoadURL(context.Background(), handlers.ShortURLCalc("https://example.com/dup"))
+	require.NoError(t, err)
+	assert.True(t, link.LinkOptions.IsZero(), "the existing link is unchanged")
+}
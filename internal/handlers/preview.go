@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/go-chi/chi"
+	"github.com/scaranin/go-svc-short-url/internal/logger"
+	"github.com/scaranin/go-svc-short-url/internal/models"
+	"go.uber.org/zap"
+)
+
+const (
+	// previewSuffix appended to a short URL asks for its preview page.
+	previewSuffix = "+"
+	// previewParam set to "1" in the query string asks for the preview page.
+	previewParam = "preview"
+	// maxTitleLength limits the owner-defined title of a link.
+	maxTitleLength = 200
+	// maxDescriptionLength limits the owner-defined description of a link.
+	maxDescriptionLength = 1000
+)
+
+// previewTemplate renders the interstitial page shown before a redirect.
+// html/template escapes every value and replaces unsafe URLs in href.
+var previewTemplate = template.Must(template.New("preview").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="robots" content="noindex">
+<title>{{if .Title}}{{.Title}}{{else}}Link preview{{end}}</title>
+</head>
+<body>
+<main>
+<h1>{{if .Title}}{{.Title}}{{else}}You are leaving for another site{{end}}</h1>
+{{if .Description}}<p>{{.Description}}</p>{{end}}
+{{if .Warning}}<p><strong>Check the address below before you continue.</strong></p>{{end}}
+<p>This link leads to <code>{{.Destination}}</code></p>
+<p><a href="{{.Target}}" rel="noopener noreferrer nofollow">Continue to {{.Host}}</a></p>
+</main>
+</body>
+</html>
+`))
+
+// previewPage is the data of previewTemplate.
+type previewPage struct {
+	Title       string
+	Description string
+	Warning     bool
+	Destination string
+	Host        string
+	Target      string
+}
+
+// previewRequest returns the short URL of r and whether r asks for its preview
+// page, either with the "+" suffix or with preview=1. It also returns the
+// query string of r without the preview parameter.
+func previewRequest(r *http.Request) (shortURL string, preview bool, rawQuery string) {
+	shortURL = chi.URLParam(r, "shortURL")
+	rawQuery = r.URL.RawQuery
+	if trimmed, ok := strings.CutSuffix(shortURL, previewSuffix); ok {
+		shortURL, preview = trimmed, true
+	}
+	query := r.URL.Query()
+	if query.Has(previewParam) {
+		preview = preview || query.Get(previewParam) == "1"
+		query.Del(previewParam)
+		rawQuery = query.Encode()
+	}
+	return shortURL, preview, rawQuery
+}
+
+// writePreview renders the preview page of link showing its resolved
+// destination dest, with a link to target. It is never cached, so a later
+// change of the link is shown on the next visit.
+func writePreview(w http.ResponseWriter, r *http.Request, link models.URL, dest string, target string) {
+	page := previewPage{
+		Title:       link.Title,
+		Description: link.Description,
+		Warning:     link.AlwaysPreview,
+		Destination: dest,
+		Target:      target,
+	}
+	if u, err := url.Parse(dest); err == nil {
+		page.Host = u.Host
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	if err := previewTemplate.Execute(w, page); err != nil {
+		logger.FromContext(r.Context()).Error("preview page not rendered", zap.Error(err))
+	}
+}
@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi"
+	"github.com/scaranin/go-svc-short-url/internal/middleware"
+	"github.com/scaranin/go-svc-short-url/internal/models"
+	"github.com/scaranin/go-svc-short-url/internal/qr"
+)
+
+const (
+	// qrSuffix is appended to a short URL to get the path of its QR code.
+	qrSuffix = "/qr"
+	// contentTypePNG is the MIME type of PNG QR codes.
+	contentTypePNG = "image/png"
+	// contentTypeSVG is the MIME type of SVG QR codes.
+	contentTypeSVG = "image/svg+xml"
+)
+
+// QRHandle handles GET requests for the QR code of a short URL. The code
+// encodes the short URL itself, so scans are redirected and counted like
+// clicks. The query parameters select the image:
+//   - format: "png" (the default) or "svg";
+//   - size: width and height in pixels, 256 by default;
+//   - level: error correction level L, M (the default), Q or H;
+//   - margin: quiet zone in modules, 4 by default.
+//
+// Invalid parameters are rejected with HTTP 400 Bad Request, an unknown short
+// URL with HTTP 404 Not Found and a deleted or exhausted one with HTTP 410 Gone.
+func (h *URLHandler) QRHandle(w http.ResponseWriter, r *http.Request) {
+	shortURL := chi.URLParam(r, "shortURL")
+	format, opts, err := parseQROptions(r)
+	if err != nil {
+		middleware.WriteProblem(w, r, http.StatusBadRequest, models.CodeInvalidRequest, err.Error())
+		return
+	}
+
+	_, err = h.LoadURL(r.Context(), shortURL)
+	switch {
+	case errors.Is(err, models.ErrNotFound):
+		middleware.WriteProblem(w, r, http.StatusNotFound, models.CodeNotFound, "short URL not found")
+		return
+	case errors.Is(err, models.ErrDeleted):
+		middleware.WriteProblem(w, r, http.StatusGone, models.CodeURLDeleted, "short URL has been deleted")
+		return
+	case errors.Is(err, models.ErrClicksExhausted):
+		writeClicksExhausted(w, r)
+		return
+	case err != nil:
+		writeStorageError(w, r, err)
+		return
+	}
+
+	var image []byte
+	contentType := contentTypePNG
+	if format == "svg" {
+		contentType = contentTypeSVG
+		image, err = qr.SVG(h.BaseURL+shortURL, opts)
+	} else {
+		image, err = qr.PNG(h.BaseURL+shortURL, opts)
+	}
+	if err != nil {
+		middleware.WriteProblem(w, r, http.StatusBadRequest, models.CodeInvalidRequest, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(image)
+}
+
+// parseQROptions reads the image format and qr.Options from the query of r.
+func parseQROptions(r *http.Request) (string, qr.Options, error) {
+	query := r.URL.Query()
+	opts := qr.DefaultOptions()
+	format := query.Get("format")
+	switch format {
+	case "", "png":
+		format = "png"
+	case "svg":
+	default:
+		return "", opts, errors.New(`format must be "png" or "svg"`)
+	}
+	if value := query.Get("size"); len(value) > 0 {
+		size, err := strconv.Atoi(value)
+		if err != nil {
+			return "", opts, errors.New("size must be a number of pixels")
+		}
+		opts.Size = size
+	}
+	if value := query.Get("level"); len(value) > 0 {
+		opts.Level = value
+	}
+	if value := query.Get("margin"); len(value) > 0 {
+		margin, err := strconv.Atoi(value)
+		if err != nil {
+			return "", opts, errors.New("margin must be a number of modules")
+		}
+		opts.Margin = margin
+	}
+	return format, opts, opts.Validate()
+}
+
+// qrURL returns the URL of the QR code of shortURL.
+func (h *URLHandler) qrURL(shortURL string) string {
+	return h.BaseURL + shortURL + qrSuffix
+}
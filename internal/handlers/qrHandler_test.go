@@ -0,0 +1,62 @@
+package handlers_test
+
+import (
+	"bytes"
+	"context"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi"
+	"github.com/scaranin/go-svc-short-url/internal/handlers"
+	"github.com/scaranin/go-svc-short-url/internal/models"
+	"github.com/scaranin/go-svc-short-url/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestURLHandler_QRHandle(t *testing.T) {
+	ctx := context.Background()
+	store, err := storage.CreateStoreFile("")
+	require.NoError(t, err)
+	_, err = store.Save(ctx, &models.URL{ShortURL: "abc", OriginalURL: "https://a.example", UserID: "u1"})
+	require.NoError(t, err)
+	_, err = store.Save(ctx, &models.URL{ShortURL: "gone", OriginalURL: "https://g.example", UserID: "u1"})
+	require.NoError(t, err)
+	require.NoError(t, store.DeleteBulk(ctx, "u1", []string{"gone"}))
+
+	h := handlers.URLHandler{Storage: store, BaseURL: "http://localhost:8080/"}
+	router := chi.NewRouter()
+	router.Get("/{shortURL}/qr", h.QRHandle)
+
+	tests := []struct {
+		name        string
+		target      string
+		statusCode  int
+		contentType string
+	}{
+		{name: "png by default", target: "/abc/qr", statusCode: http.StatusOK, contentType: "image/png"},
+		{name: "svg", target: "/abc/qr?format=svg&size=512&level=H&margin=0", statusCode: http.StatusOK, contentType: "image/svg+xml"},
+		{name: "unknown format", target: "/abc/qr?format=gif", statusCode: http.StatusBadRequest, contentType: "application/problem+json"},
+		{name: "size too large", target: "/abc/qr?size=100000", statusCode: http.StatusBadRequest, contentType: "application/problem+json"},
+		{name: "invalid level", target: "/abc/qr?level=Z", statusCode: http.StatusBadRequest, contentType: "application/problem+json"},
+		{name: "unknown short URL", target: "/missing/qr", statusCode: http.StatusNotFound, contentType: "application/problem+json"},
+		{name: "deleted short URL", target: "/gone/qr", statusCode: http.StatusGone, contentType: "application/problem+json"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.target, nil))
+
+			assert.Equal(t, tt.statusCode, w.Code)
+			assert.Equal(t, tt.contentType, w.Header().Get("Content-Type"))
+		})
+	}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/abc/qr?size=128", nil))
+	img, err := png.Decode(bytes.NewReader(w.Body.Bytes()))
+	require.NoError(t, err)
+	assert.Equal(t, 128, img.Bounds().Dx())
+}
@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/scaranin/go-svc-short-url/internal/models"
+	"github.com/scaranin/go-svc-short-url/internal/targeting"
+)
+
+// isRedirectStatus reports whether status may be used to redirect to an
+// original URL.
+func isRedirectStatus(status int) bool {
+	switch status {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return true
+	}
+	return false
+}
+
+// validateOptions checks the link options of a shortening request. The URLs
+// of its targets and variants are validated like the URL to shorten.
+func (h *URLHandler) validateOptions(opts models.LinkOptions) error {
+	if opts.RedirectStatus != 0 && !isRedirectStatus(opts.RedirectStatus) {
+		return fmt.Errorf("redirect_status %d is not allowed, use 301, 302, 307 or 308", opts.RedirectStatus)
+	}
+	if len(opts.Title) > maxTitleLength {
+		return fmt.Errorf("title is longer than %d bytes", maxTitleLength)
+	}
+	if len(opts.Description) > maxDescriptionLength {
+		return fmt.Errorf("description is longer than %d bytes", maxDescriptionLength)
+	}
+	if opts.MaxClicks < 0 {
+		return errors.New("max_clicks must not be negative")
+	}
+	if opts.NotBefore != nil && opts.ExpiresAt != nil && !opts.ExpiresAt.After(*opts.NotBefore) {
+		return errors.New("expires_at must be after not_before")
+	}
+	if opts.ExpiresAt != nil && !opts.ExpiresAt.After(time.Now()) {
+		return errors.New("expires_at is in the past")
+	}
+	if len(opts.Password) > maxPasswordLength {
+		return fmt.Errorf("password is longer than %d bytes", maxPasswordLength)
+	}
+	if err := targeting.Validate(opts.Targets); err != nil {
+		return err
+	}
+	for i, target := range opts.Targets {
+		if err := h.validateURL(target.URL); err != nil {
+			return fmt.Errorf("target %d: %w", i, err)
+		}
+	}
+	if err := validateVariants(opts.Variants); err != nil {
+		return err
+	}
+	for _, variant := range opts.Variants {
+		if err := h.validateURL(variant.URL); err != nil {
+			return fmt.Errorf("variant %q: %w", variant.Name, err)
+		}
+	}
+	return nil
+}
+
+// redirectStatus returns the status of the redirect to link: its own status,
+// else RedirectStatus, else 307 Temporary Redirect.
+func (h *URLHandler) redirectStatus(link models.URL) int {
+	if isRedirectStatus(link.RedirectStatus) {
+		return link.RedirectStatus
+	}
+	if isRedirectStatus(h.RedirectStatus) {
+		return h.RedirectStatus
+	}
+	return http.StatusTemporaryRedirect
+}
+
+// redirectTarget returns the Location of the redirect through link to its
+// resolved destination dest. The query string rawQuery of the request is
+// appended to dest if the link or ForwardQuery asks for it, after the query
+// dest already has.
+func (h *URLHandler) redirectTarget(link models.URL, dest string, rawQuery string) string {
+	if !(link.ForwardQuery || h.ForwardQuery) || len(rawQuery) == 0 {
+		return dest
+	}
+	u, err := url.Parse(dest)
+	if err != nil {
+		return dest
+	}
+	if len(u.RawQuery) == 0 {
+		u.RawQuery = rawQuery
+	} else {
+		u.RawQuery += "&" + rawQuery
+	}
+	return u.String()
+}
+
+// cacheControl returns the Cache-Control header of a redirect to link with
+// status. Permanent redirects may be cached for RedirectMaxAge; temporary ones
+// are never stored, so every visit reaches the service and the link can
+// change. Redirects through a password-protected link are never stored
+// either, so no cache hands the destination out without the password, and
+// neither are those through a click-limited link, whose every redirect must
+// be counted. A link that expires is cached no longer than until it expires.
+func (h *URLHandler) cacheControl(link models.URL, status int) string {
+	if len(link.PasswordHash) > 0 {
+		return "private, no-store"
+	}
+	if link.MaxClicks > 0 {
+		return "no-store"
+	}
+	permanent := status == http.StatusMovedPermanently || status == http.StatusPermanentRedirect
+	if !permanent || h.RedirectMaxAge < 0 {
+		return "no-store"
+	}
+	maxAge := h.RedirectMaxAge
+	if link.ExpiresAt != nil {
+		maxAge = min(maxAge, time.Until(*link.ExpiresAt))
+	}
+	if maxAge < time.Second {
+		return "no-store"
+	}
+	return "public, max-age=" + strconv.FormatInt(int64(maxAge.Seconds()), 10)
+}
@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/scaranin/go-svc-short-url/internal/middleware"
+	"github.com/scaranin/go-svc-short-url/internal/models"
+)
+
+var (
+	// errNotYetActive is returned by linkSchedule before the NotBefore time of
+	// a link.
+	errNotYetActive = errors.New("short URL is not active yet")
+	// errExpired is returned by linkSchedule after the ExpiresAt time of a link.
+	errExpired = errors.New("short URL has expired")
+)
+
+// linkSchedule checks the activation window of link at now.
+func linkSchedule(link models.URL, now time.Time) error {
+	switch {
+	case link.Expired(now):
+		return errExpired
+	case link.Scheduled(now):
+		return errNotYetActive
+	}
+	return nil
+}
+
+// writeComingSoon answers a request for link before its NotBefore time. With
+// ComingSoonURL it redirects there with HTTP 302 Found; otherwise it writes a
+// problem with ComingSoonStatus, 404 Not Found by default. Either way the
+// response is not cached and Retry-After tells when the link goes live.
+func (h *URLHandler) writeComingSoon(w http.ResponseWriter, r *http.Request, link models.URL) {
+	w.Header().Set("Cache-Control", "no-store")
+	wait := math.Ceil(time.Until(*link.NotBefore).Seconds())
+	w.Header().Set("Retry-After", strconv.FormatInt(int64(max(wait, 1)), 10))
+	if len(h.ComingSoonURL) > 0 {
+		w.Header().Set("Location", h.ComingSoonURL)
+		w.WriteHeader(http.StatusFound)
+		return
+	}
+	status := h.ComingSoonStatus
+	if status == 0 {
+		status = http.StatusNotFound
+	}
+	middleware.WriteProblem(w, r, status, models.CodeNotYetActive, errNotYetActive.Error())
+}
@@ -2,8 +2,12 @@ package handlers
 
 import (
 	"encoding/json"
-	"log"
 	"net/http"
+
+	"github.com/scaranin/go-svc-short-url/internal/logger"
+	"github.com/scaranin/go-svc-short-url/internal/middleware"
+	"github.com/scaranin/go-svc-short-url/internal/models"
+	"go.uber.org/zap"
 )
 
 // GetStats handles the /stats endpoint by retrieving and returning storage statistics in JSON format.
@@ -18,34 +22,36 @@ func (h *URLHandler) GetStats(w http.ResponseWriter, r *http.Request) {
 	)
 	cookieR, err := r.Cookie(h.Auth.CookieName)
 	if err != nil {
-		log.Print(err.Error())
+		logger.FromContext(r.Context()).Debug("no auth cookie", zap.Error(err))
 	}
 	cookieW, err = h.Auth.FillUserReturnCookie(cookieR)
 	if err != nil {
-		log.Print(err.Error())
+		logger.FromContext(r.Context()).Debug("auth cookie rejected", zap.Error(err))
+	} else {
+		logger.SetUserID(r.Context(), h.Auth.UserID)
 	}
 	if err == http.ErrNoCookie {
 		w.WriteHeader(http.StatusNoContent)
 		return
 	}
 	if err != nil {
-		w.WriteHeader(http.StatusUnauthorized)
+		middleware.WriteProblem(w, r, http.StatusUnauthorized, models.CodeUnauthorized, err.Error())
 		return
 	}
 
 	if len(h.TrustedSubnet) == 0 {
-		http.Error(w, "Access denied", http.StatusForbidden)
+		middleware.WriteProblem(w, r, http.StatusForbidden, models.CodeForbidden, "client IP is not in the trusted subnet")
 		return
 	}
 
 	if !h.CheckIP(r) {
-		http.Error(w, "Access denied", http.StatusForbidden)
+		middleware.WriteProblem(w, r, http.StatusForbidden, models.CodeForbidden, "client IP is not in the trusted subnet")
 		return
 	}
 
-	stat, err := h.Storage.GetStats()
+	stat, err := h.Storage.GetStats(r.Context())
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeStorageError(w, r, err)
 		return
 	}
 	buf, err := json.Marshal(stat)
@@ -1,9 +1,11 @@
 package handlers_test
 
 import (
+	"context"
 	"log"
 	"net/http"
 	"net/http/httptest"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
@@ -82,10 +84,16 @@ func TestGetStats(t *testing.T) {
 				SecretKey:  "TsoyZhiv",
 				TokenExp:   24 * time.Hour,
 			}
-			fs, err := storage.CreateStoreFile("BaseFile.json")
+			fs, err := storage.CreateStoreFile(filepath.Join(t.TempDir(), "BaseFile.json"))
 			if err != nil {
 				log.Println(err)
 			}
+			for _, originalURL := range []string{"https://practicum.yandex.ru/", "https://practicum.yandex.ru"} {
+				_, err = fs.Save(context.Background(), &models.URL{ShortURL: handlers.ShortURLCalc(originalURL), OriginalURL: originalURL})
+				if err != nil {
+					log.Println(err)
+				}
+			}
 			h := &handlers.URLHandler{
 				Auth:          authConfig,
 				Storage:       fs,
@@ -0,0 +1,36 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/scaranin/go-svc-short-url/internal/models"
+	"github.com/scaranin/go-svc-short-url/internal/targeting"
+)
+
+// destination returns where the client of r is sent for link: the URL of the
+// first of its targets the client matches, else the URL of the A/B variant
+// the client is assigned (see selectVariant), else its original URL. The name
+// of the variant is returned as well, or an empty string.
+func destination(w http.ResponseWriter, r *http.Request, link models.URL) (string, string) {
+	if target, ok := selectTarget(w, r, link); ok {
+		return target, ""
+	}
+	if variant, ok := selectVariant(w, r, link); ok {
+		return variant.URL, variant.Name
+	}
+	return link.OriginalURL, ""
+}
+
+// selectTarget returns the URL of the first target of link the client of r
+// matches. For a link with targets the response varies with the headers they
+// are matched against, which is announced in Vary so shared caches keep them
+// apart.
+func selectTarget(w http.ResponseWriter, r *http.Request, link models.URL) (string, bool) {
+	if len(link.Targets) == 0 {
+		return "", false
+	}
+	w.Header().Add("Vary", "User-Agent")
+	w.Header().Add("Vary", "Accept-Language")
+	client := targeting.ParseClient(r.UserAgent(), r.Header.Get("Accept-Language"))
+	return targeting.Select(link.Targets, client)
+}
@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/scaranin/go-svc-short-url/internal/middleware"
+	"github.com/scaranin/go-svc-short-url/internal/models"
+)
+
+// defaultSchemes are the URL schemes accepted when URLHandler.AllowedSchemes is empty.
+var defaultSchemes = []string{"http", "https"}
+
+// validateURL checks that rawURL may be shortened: it must not be empty or
+// longer than MaxURLLength, and must be an absolute URL with a host and one of
+// the allowed schemes. Schemes such as javascript: or data: are rejected, as
+// following them from a redirect would run attacker-controlled content.
+func (h *URLHandler) validateURL(rawURL string) error {
+	if len(rawURL) == 0 {
+		return errors.New("URL is empty")
+	}
+	if h.MaxURLLength > 0 && len(rawURL) > h.MaxURLLength {
+		return fmt.Errorf("URL is longer than %d bytes", h.MaxURLLength)
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("URL is malformed: %w", err)
+	}
+
+	schemes := h.AllowedSchemes
+	if len(schemes) == 0 {
+		schemes = defaultSchemes
+	}
+	if !slices.Contains(schemes, strings.ToLower(u.Scheme)) {
+		return fmt.Errorf("URL scheme %q is not allowed, use one of %s", u.Scheme, strings.Join(schemes, ", "))
+	}
+	if len(u.Hostname()) == 0 {
+		return errors.New("URL has no host")
+	}
+	return nil
+}
+
+// writeBodyError replies with the problem matching a request body that could
+// not be read or decoded: 413 when it exceeds the route's size limit and 400
+// otherwise.
+func writeBodyError(w http.ResponseWriter, r *http.Request, err error) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		middleware.WriteProblem(w, r, http.StatusRequestEntityTooLarge, models.CodeBodyTooLarge,
+			fmt.Sprintf("request body is larger than %d bytes", tooLarge.Limit))
+		return
+	}
+	middleware.WriteProblem(w, r, http.StatusBadRequest, models.CodeInvalidRequest, err.Error())
+}
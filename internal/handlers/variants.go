@@ -0,0 +1,239 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/scaranin/go-svc-short-url/internal/logger"
+	"github.com/scaranin/go-svc-short-url/internal/middleware"
+	"github.com/scaranin/go-svc-short-url/internal/models"
+	"go.uber.org/zap"
+)
+
+const (
+	// variantCookie holds the name of the A/B variant a client was assigned.
+	// It is scoped to the path of the short URL.
+	variantCookie = "link_variant"
+	// variantCookieMaxAge is how long a client keeps its variant.
+	variantCookieMaxAge = 30 * 24 * time.Hour
+	// maxVariants limits the number of variants of a link.
+	maxVariants = 10
+	// maxVariantWeight limits the weight of a variant.
+	maxVariantWeight = 10000
+)
+
+// variantName matches the names a variant may have. They are stored in a
+// cookie, so they are kept to unreserved characters.
+var variantName = regexp.MustCompile(`^[A-Za-z0-9_-]{1,32}$`)
+
+// validateVariants checks the variants of a link: unique names, weights in
+// range and at least one variant that receives clients.
+func validateVariants(variants []models.Variant) error {
+	if len(variants) == 0 {
+		return nil
+	}
+	if len(variants) > maxVariants {
+		return fmt.Errorf("at most %d variants are allowed", maxVariants)
+	}
+	names := make(map[string]bool, len(variants))
+	total := 0
+	for _, variant := range variants {
+		if !variantName.MatchString(variant.Name) {
+			return fmt.Errorf("variant name %q must be 1 to 32 letters, digits, '-' or '_'", variant.Name)
+		}
+		if names[variant.Name] {
+			return fmt.Errorf("variant name %q is used twice", variant.Name)
+		}
+		names[variant.Name] = true
+		if variant.Weight < 0 || variant.Weight > maxVariantWeight {
+			return fmt.Errorf("variant %q: weight must be between 0 and %d", variant.Name, maxVariantWeight)
+		}
+		total += variant.Weight
+	}
+	if total == 0 {
+		return errors.New("at least one variant needs a positive weight")
+	}
+	return nil
+}
+
+// selectVariant assigns the client of r to one of the variants of link. A
+// client keeps the variant named in its cookie while that variant has a
+// positive weight; otherwise a variant is drawn by weight and remembered in
+// the cookie.
+func selectVariant(w http.ResponseWriter, r *http.Request, link models.URL) (models.Variant, bool) {
+	if len(link.Variants) == 0 {
+		return models.Variant{}, false
+	}
+	w.Header().Add("Vary", "Cookie")
+	if cookie, err := r.Cookie(variantCookie); err == nil {
+		for _, variant := range link.Variants {
+			if variant.Name == cookie.Value && variant.Weight > 0 {
+				return variant, true
+			}
+		}
+	}
+
+	total := 0
+	for _, variant := range link.Variants {
+		total += variant.Weight
+	}
+	if total <= 0 {
+		return models.Variant{}, false
+	}
+	pick := rand.IntN(total)
+	for _, variant := range link.Variants {
+		if pick < variant.Weight {
+			http.SetCookie(w, &http.Cookie{
+				Name:     variantCookie,
+				Value:    variant.Name,
+				Path:     "/" + link.ShortURL,
+				MaxAge:   int(variantCookieMaxAge.Seconds()),
+				HttpOnly: true,
+				SameSite: http.SameSiteLaxMode,
+			})
+			return variant, true
+		}
+		pick -= variant.Weight
+	}
+	return models.Variant{}, false
+}
+
+// GetVariants is an HTTP handler that reports the A/B variants of a short URL
+// owned by the authenticated user, with the number of redirects each one
+// received. It responds with HTTP 404 Not Found if the short URL does not
+// exist or belongs to another user. The counts may lag behind by the cache
+// lifetime of the short URL.
+func (h *URLHandler) GetVariants(w http.ResponseWriter, r *http.Request) {
+	userID, cookieW, ok := h.authorize(w, r)
+	if !ok {
+		return
+	}
+	link, err := h.Storage.LoadURL(r.Context(), chi.URLParam(r, "shortURL"))
+	if err != nil && !errors.Is(err, models.ErrClicksExhausted) {
+		writeVariantsError(w, r, err)
+		return
+	}
+	if len(link.OriginalURL) == 0 || link.UserID != userID {
+		writeVariantsError(w, r, models.ErrNotOwned)
+		return
+	}
+	http.SetCookie(w, cookieW)
+	writeVariants(w, r, link)
+}
+
+// UpdateVariants is an HTTP handler that lets the owner of a short URL adjust
+// the weights of its A/B variants. The body is a JSON object mapping variant
+// names to their new weights; variants not named keep their weight. On
+// success it responds like GetVariants. Unknown variants and weights leaving
+// no variant to send clients to are rejected with HTTP 400 Bad Request, and a
+// short URL of another user with HTTP 403 Forbidden.
+func (h *URLHandler) UpdateVariants(w http.ResponseWriter, r *http.Request) {
+	userID, cookieW, ok := h.authorize(w, r)
+	if !ok {
+		return
+	}
+	var weights map[string]int
+	if err := json.NewDecoder(r.Body).Decode(&weights); err != nil {
+		writeBodyError(w, r, err)
+		return
+	}
+	defer r.Body.Close()
+
+	shortURL := chi.URLParam(r, "shortURL")
+	link, err := h.Storage.LoadURL(r.Context(), shortURL)
+	if err != nil && !errors.Is(err, models.ErrClicksExhausted) {
+		writeVariantsError(w, r, err)
+		return
+	}
+	if len(link.OriginalURL) == 0 {
+		writeVariantsError(w, r, models.ErrNotOwned)
+		return
+	}
+	if link.UserID != userID {
+		middleware.WriteProblem(w, r, http.StatusForbidden, models.CodeForbidden, "short URL belongs to another user")
+		return
+	}
+
+	variants := make([]models.Variant, len(link.Variants))
+	copy(variants, link.Variants)
+	for name, weight := range weights {
+		found := false
+		for i := range variants {
+			if variants[i].Name == name {
+				variants[i].Weight, found = weight, true
+			}
+		}
+		if !found {
+			middleware.WriteProblem(w, r, http.StatusBadRequest, models.CodeInvalidRequest, fmt.Sprintf("short URL has no variant %q", name))
+			return
+		}
+	}
+	if err = validateVariants(variants); err != nil {
+		middleware.WriteProblem(w, r, http.StatusBadRequest, models.CodeInvalidRequest, err.Error())
+		return
+	}
+	if err = h.Storage.UpdateVariants(r.Context(), userID, shortURL, variants); err != nil {
+		writeVariantsError(w, r, err)
+		return
+	}
+	link.Variants = variants
+	http.SetCookie(w, cookieW)
+	writeVariants(w, r, link)
+}
+
+// authorize authenticates the user of r by the signed auth cookie and returns
+// the user ID with the cookie refreshed. The user ID is kept per request
+// rather than in the shared Auth, which concurrent requests would overwrite.
+// It writes HTTP 401 Unauthorized if there is no cookie and HTTP 403 Forbidden
+// if its token is not valid, and returns false.
+func (h *URLHandler) authorize(w http.ResponseWriter, r *http.Request) (string, *http.Cookie, bool) {
+	cookieR, err := r.Cookie(h.Auth.CookieName)
+	if err != nil {
+		middleware.WriteProblem(w, r, http.StatusUnauthorized, models.CodeUnauthorized, err.Error())
+		return "", nil, false
+	}
+	userID, ok := h.Auth.ParseUserID(cookieR.Value)
+	if !ok {
+		middleware.WriteProblem(w, r, http.StatusForbidden, models.CodeForbidden, "invalid auth token")
+		return "", nil, false
+	}
+	logger.SetUserID(r.Context(), userID)
+	cookieW := &http.Cookie{
+		Name:     h.Auth.CookieName,
+		Value:    cookieR.Value,
+		Expires:  time.Now().Add(h.Auth.TokenExp),
+		HttpOnly: true,
+		Path:     "/",
+	}
+	return userID, cookieW, true
+}
+
+// writeVariants writes the variants of link with their click counts.
+func writeVariants(w http.ResponseWriter, r *http.Request, link models.URL) {
+	reports := make([]models.VariantReport, 0, len(link.Variants))
+	for _, variant := range link.Variants {
+		reports = append(reports, models.VariantReport{Variant: variant, Clicks: link.VariantClicks[variant.Name]})
+	}
+	w.Header().Set("Content-Type", contentTypeApJSON)
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(reports); err != nil {
+		logger.FromContext(r.Context()).Debug("variants not written", zap.Error(err))
+	}
+}
+
+// writeVariantsError replies with the problem matching a failed variants
+// request: 404 for a short URL the user does not own, the storage problem
+// otherwise.
+func writeVariantsError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, models.ErrNotOwned) || errors.Is(err, models.ErrDeleted) || errors.Is(err, models.ErrNotFound) {
+		middleware.WriteProblem(w, r, http.StatusNotFound, models.CodeNotFound, "short URL not found")
+		return
+	}
+	writeStorageError(w, r, err)
+}
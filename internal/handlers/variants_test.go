@@ -0,0 +1,150 @@
+package handlers_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/scaranin/go-svc-short-url/internal/auth"
+	"github.com/scaranin/go-svc-short-url/internal/handlers"
+	"github.com/scaranin/go-svc-short-url/internal/models"
+	"github.com/scaranin/go-svc-short-url/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestURLHandler_Variants(t *testing.T) {
+	store, err := storage.CreateStoreFile("")
+	require.NoError(t, err)
+	h := handlers.URLHandler{Storage: store, Auth: auth.NewAuthConfig()}
+	token, err := h.Auth.BuildJWTString()
+	require.NoError(t, err)
+	owner, ok := h.Auth.ParseUserID(token)
+	require.True(t, ok)
+	h.Auth.UserID = owner
+	shortURL, err := h.Save(context.Background(), "https://shop.example/", "", models.LinkOptions{Variants: []models.Variant{
+		{Name: "a", URL: "https://shop.example/a", Weight: 1},
+		{Name: "b", URL: "https://shop.example/b", Weight: 1},
+	}})
+	require.NoError(t, err)
+
+	router := chi.NewRouter()
+	router.Get("/{shortURL}", h.GetHandle)
+	router.Get("/api/user/urls/{shortURL}/variants", h.GetVariants)
+	router.Put("/api/user/urls/{shortURL}/variants", h.UpdateVariants)
+	authCookie := &http.Cookie{Name: h.Auth.CookieName, Value: token}
+	follow := func(cookie *http.Cookie) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/"+shortURL, nil)
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	variants := func(method, body string, cookie *http.Cookie) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/api/user/urls/"+shortURL+"/variants", strings.NewReader(body))
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := follow(nil)
+	require.Equal(t, http.StatusTemporaryRedirect, w.Code)
+	assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+	cookies := w.Result().Cookies()
+	require.Len(t, cookies, 1)
+	sticky := cookies[0]
+	assert.Equal(t, "/"+shortURL, sticky.Path)
+	location := w.Header().Get("Location")
+	assert.Equal(t, "https://shop.example/"+sticky.Value, location)
+	for i := 0; i < 5; i++ {
+		assert.Equal(t, location, follow(sticky).Header().Get("Location"), "the variant is sticky")
+	}
+
+	w = variants(http.MethodGet, "", authCookie)
+	require.Equal(t, http.StatusOK, w.Code)
+	var reports []models.VariantReport
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&reports))
+	require.Len(t, reports, 2)
+	for _, report := range reports {
+		if report.Name == sticky.Value {
+			assert.Equal(t, 6, report.Clicks)
+		} else {
+			assert.Zero(t, report.Clicks)
+		}
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, variants(http.MethodPut, `{"a":1}`, nil).Code)
+	assert.Equal(t, http.StatusBadRequest, variants(http.MethodPut, `{"c":1}`, authCookie).Code, "unknown variant")
+	assert.Equal(t, http.StatusBadRequest, variants(http.MethodPut, `{"a":0,"b":0}`, authCookie).Code, "no weight left")
+
+	other := map[string]string{"a": "b", "b": "a"}[sticky.Value]
+	w = variants(http.MethodPut, `{"`+sticky.Value+`":0}`, authCookie)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "https://shop.example/"+other, follow(sticky).Header().Get("Location"), "a variant without weight gets no clients")
+
+	intruder := auth.NewAuthConfig()
+	intruderToken, err := intruder.BuildJWTString()
+	require.NoError(t, err)
+	w = variants(http.MethodGet, "", &http.Cookie{Name: h.Auth.CookieName, Value: intruderToken})
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestURLHandler_UpdateVariantsForbidden(t *testing.T) {
+	store, err := storage.CreateStoreFile("")
+	require.NoError(t, err)
+	h := handlers.URLHandler{Storage: store, Auth: auth.NewAuthConfig()}
+	token, err := h.Auth.BuildJWTString()
+	require.NoError(t, err)
+	owner, ok := h.Auth.ParseUserID(token)
+	require.True(t, ok)
+	h.Auth.UserID = owner
+	shortURL, err := h.Save(context.Background(), "https://shop.example/", "", models.LinkOptions{Variants: []models.Variant{
+		{Name: "a", URL: "https://shop.example/a", Weight: 1},
+		{Name: "b", URL: "https://shop.example/b", Weight: 1},
+	}})
+	require.NoError(t, err)
+	router := chi.NewRouter()
+	router.Put("/api/user/urls/{shortURL}/variants", h.UpdateVariants)
+
+	otherUser := auth.NewAuthConfig()
+	otherToken, err := otherUser.BuildJWTString()
+	require.NoError(t, err)
+	wrongKey := auth.NewAuthConfig()
+	wrongKey.SecretKey = "forged"
+	wrongKeyToken, err := wrongKey.BuildJWTString()
+	require.NoError(t, err)
+	unsignedToken, err := jwt.NewWithClaims(jwt.SigningMethodNone, auth.Claims{UserID: owner}).SignedString(jwt.UnsafeAllowNoneSignatureType)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{name: "other user", token: otherToken},
+		{name: "wrong signing key", token: wrongKeyToken},
+		{name: "unsigned token of the owner", token: unsignedToken},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPut, "/api/user/urls/"+shortURL+"/variants", strings.NewReader(`{"a":0}`))
+			req.AddCookie(&http.Cookie{Name: h.Auth.CookieName, Value: tt.token})
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			assert.Equal(t, http.StatusForbidden, w.Code)
+
+			link, err := store.LoadURL(context.Background(), shortURL)
+			require.NoError(t, err)
+			assert.Equal(t, 1, link.Variants[0].Weight, "the weights are unchanged")
+		})
+	}
+}
@@ -0,0 +1,13 @@
+/*
+Package logger builds the service's zap logger and carries it through request
+contexts.
+
+`New` creates the process-wide logger from the configured level and format;
+it is created once at startup and installed with `zap.ReplaceGlobals`, so
+background goroutines can use `zap.L()`. The logging middleware stores a
+request-scoped copy in the request context with `WithRequest`; handlers and
+storage code retrieve it with `FromContext`, so their entries carry the fields
+of the request they serve, such as the trace and user IDs.
+*/
+
+package logger
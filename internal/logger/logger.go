@@ -0,0 +1,121 @@
+package logger
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// Supported log formats.
+const (
+	// FormatJSON writes one JSON object per entry, for production.
+	FormatJSON = "json"
+	// FormatConsole writes human-readable entries, for development.
+	FormatConsole = "console"
+)
+
+// New builds a logger writing entries of level and above to stderr in the
+// given format. Sampling is left to the callers that need it, so no entry is
+// dropped silently.
+func New(level string, format string) (*zap.Logger, error) {
+	lvl, err := zapcore.ParseLevel(level)
+	if err != nil {
+		return nil, err
+	}
+
+	var cfg zap.Config
+	switch format {
+	case FormatJSON:
+		cfg = zap.NewProductionConfig()
+	case FormatConsole:
+		cfg = zap.NewDevelopmentConfig()
+	default:
+		return nil, fmt.Errorf("unknown log format %q", format)
+	}
+	cfg.Level = zap.NewAtomicLevelAt(lvl)
+	cfg.Sampling = nil
+	cfg.EncoderConfig.TimeKey = "time"
+	cfg.EncoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder
+	return cfg.Build()
+}
+
+// contextKey is the type of the context key holding the request logger.
+type contextKey struct{}
+
+// requestLogger is the mutable logger of a single request. Fields learned
+// while the request is handled, such as the user ID, are added to it in place,
+// so they also appear in entries logged later by the middleware.
+type requestLogger struct {
+	mu     sync.Mutex
+	logger *zap.Logger
+	userID string
+	// fields are the fields added with With, for entries that are not written
+	// through logger.
+	fields []zap.Field
+}
+
+// WithRequest returns a copy of ctx carrying logger as the request logger.
+func WithRequest(ctx context.Context, logger *zap.Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, &requestLogger{logger: logger})
+}
+
+// FromContext returns the request logger stored in ctx, or the global logger
+// if ctx does not belong to a request.
+func FromContext(ctx context.Context) *zap.Logger {
+	if rl, ok := ctx.Value(contextKey{}).(*requestLogger); ok {
+		rl.mu.Lock()
+		defer rl.mu.Unlock()
+		return rl.logger
+	}
+	return zap.L()
+}
+
+// With adds fields to the request logger stored in ctx. It is a no-op if ctx
+// does not belong to a request.
+func With(ctx context.Context, fields ...zap.Field) {
+	if rl, ok := ctx.Value(contextKey{}).(*requestLogger); ok {
+		rl.mu.Lock()
+		defer rl.mu.Unlock()
+		rl.logger = rl.logger.With(fields...)
+		rl.fields = append(rl.fields, fields...)
+	}
+}
+
+// Fields returns the fields added to the request logger in ctx with With.
+func Fields(ctx context.Context) []zap.Field {
+	if rl, ok := ctx.Value(contextKey{}).(*requestLogger); ok {
+		rl.mu.Lock()
+		defer rl.mu.Unlock()
+		return append([]zap.Field(nil), rl.fields...)
+	}
+	return nil
+}
+
+// SetUserID records the authenticated user of the request in ctx and adds it
+// to the request logger as the "user_id" field.
+func SetUserID(ctx context.Context, userID string) {
+	rl, ok := ctx.Value(contextKey{}).(*requestLogger)
+	if !ok || len(userID) == 0 {
+		return
+	}
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	if rl.userID == userID {
+		return
+	}
+	rl.userID = userID
+	rl.logger = rl.logger.With(zap.String("user_id", userID))
+}
+
+// UserID returns the user recorded with SetUserID, or "" if there is none.
+func UserID(ctx context.Context) string {
+	if rl, ok := ctx.Value(contextKey{}).(*requestLogger); ok {
+		rl.mu.Lock()
+		defer rl.mu.Unlock()
+		return rl.userID
+	}
+	return ""
+}
@@ -0,0 +1,78 @@
+package metrics
+
+import (
+	"errors"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	cacheLookupsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "cache", "lookups_total"),
+		"Number of cached short URL lookups by result: \"hit\", \"negative_hit\" or \"miss\".",
+		[]string{"result"}, nil,
+	)
+	cacheEvictionsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "cache", "evictions_total"),
+		"Number of cache entries dropped to respect the size bound.",
+		nil, nil,
+	)
+	cacheEntriesDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "cache", "entries"),
+		"Number of cached entries.",
+		nil, nil,
+	)
+	cacheHitRatioDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "cache", "hit_ratio"),
+		"Share of lookups answered from the cache, including cached misses.",
+		nil, nil,
+	)
+)
+
+// CacheSample is a snapshot of the counters of the read-through storage cache.
+type CacheSample struct {
+	Hits, NegativeHits, Misses, Evictions uint64
+	Size                                  int
+	HitRatio                              float64
+}
+
+// CacheCollector exports the statistics of the read-through storage cache,
+// read on every scrape.
+type CacheCollector struct {
+	stats func() CacheSample
+}
+
+// NewCacheCollector creates a collector reading the cache statistics from stats.
+func NewCacheCollector(stats func() CacheSample) *CacheCollector {
+	return &CacheCollector{stats: stats}
+}
+
+// Describe implements the prometheus.Collector interface.
+func (c *CacheCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- cacheLookupsDesc
+	ch <- cacheEvictionsDesc
+	ch <- cacheEntriesDesc
+	ch <- cacheHitRatioDesc
+}
+
+// Collect implements the prometheus.Collector interface.
+func (c *CacheCollector) Collect(ch chan<- prometheus.Metric) {
+	stat := c.stats()
+	ch <- prometheus.MustNewConstMetric(cacheLookupsDesc, prometheus.CounterValue, float64(stat.Hits), "hit")
+	ch <- prometheus.MustNewConstMetric(cacheLookupsDesc, prometheus.CounterValue, float64(stat.NegativeHits), "negative_hit")
+	ch <- prometheus.MustNewConstMetric(cacheLookupsDesc, prometheus.CounterValue, float64(stat.Misses), "miss")
+	ch <- prometheus.MustNewConstMetric(cacheEvictionsDesc, prometheus.CounterValue, float64(stat.Evictions))
+	ch <- prometheus.MustNewConstMetric(cacheEntriesDesc, prometheus.GaugeValue, float64(stat.Size))
+	ch <- prometheus.MustNewConstMetric(cacheHitRatioDesc, prometheus.GaugeValue, stat.HitRatio)
+}
+
+// RegisterCache registers a CacheCollector for stats with the default registry.
+// Registering a second cache is a no-op.
+func RegisterCache(stats func() CacheSample) error {
+	err := prometheus.Register(NewCacheCollector(stats))
+	var already prometheus.AlreadyRegisteredError
+	if errors.As(err, &already) {
+		return nil
+	}
+	return err
+}
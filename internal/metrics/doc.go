@@ -0,0 +1,13 @@
+/*
+Package metrics defines the Prometheus metrics exported by the service on
+/metrics.
+
+The collectors are package-level variables registered with the default
+Prometheus registry, so any package can record a measurement without threading
+a registry through constructors. HTTP metrics are recorded by the
+`middleware` package, storage latencies by `storage.MeteredStorage`, and the
+pgx pool and storage cache statistics are collected on scrape by a
+`PoolCollector` and a `CacheCollector`.
+*/
+
+package metrics
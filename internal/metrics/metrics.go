@@ -0,0 +1,76 @@
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// namespace prefixes the names of all metrics of the service.
+const namespace = "shortener"
+
+var (
+	// HTTPRequests counts handled requests by method, chi route pattern and status code.
+	HTTPRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "Number of handled HTTP requests.",
+	}, []string{"method", "route", "code"})
+
+	// HTTPDuration observes request latency by method and chi route pattern.
+	HTTPDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Latency of HTTP requests.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route"})
+
+	// Redirects counts short URL lookups by result: "hit", "miss", "deleted",
+	// "exhausted", "scheduled", "expired", "blocked" or "error".
+	Redirects = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "redirects_total",
+		Help:      "Number of short URL lookups by result.",
+	}, []string{"result"})
+
+	// StorageDuration observes storage call latency by backend, operation and
+	// result ("ok" or "error").
+	StorageDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "storage_operation_duration_seconds",
+		Help:      "Latency of storage operations.",
+		Buckets:   []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+	}, []string{"backend", "operation", "result"})
+
+	// DeleteQueueDepth is the number of bulk deletions waiting for a worker.
+	DeleteQueueDepth = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "delete_queue_depth",
+		Help:      "Number of bulk deletions waiting to be applied.",
+	})
+
+	// GzipBytes counts response bytes passed through gzip compression, by
+	// stage: "uncompressed" before and "compressed" after compression.
+	GzipBytes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "gzip_bytes_total",
+		Help:      "Response bytes before and after gzip compression.",
+	}, []string{"stage"})
+
+	// GzipRatio observes the compressed to uncompressed size ratio of gzipped responses.
+	GzipRatio = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "gzip_compression_ratio",
+		Help:      "Compressed to uncompressed size ratio of gzipped responses.",
+		Buckets:   prometheus.LinearBuckets(0.1, 0.1, 10),
+	})
+)
+
+// Handler returns the HTTP handler serving the default registry in the
+// Prometheus text format. Compression is left to the gzip middleware.
+func Handler() http.Handler {
+	return promhttp.InstrumentMetricHandler(prometheus.DefaultRegisterer,
+		promhttp.HandlerFor(prometheus.DefaultGatherer, promhttp.HandlerOpts{DisableCompression: true}))
+}
@@ -0,0 +1,81 @@
+package metrics
+
+import (
+	"errors"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	poolConnsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "pgxpool", "connections"),
+		"Number of pool connections by state.",
+		[]string{"pool", "state"}, nil,
+	)
+	poolMaxConnsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "pgxpool", "max_connections"),
+		"Maximum size of the pool.",
+		[]string{"pool"}, nil,
+	)
+	poolAcquiresDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "pgxpool", "acquires_total"),
+		"Number of successful connection acquisitions.",
+		[]string{"pool"}, nil,
+	)
+	poolEmptyAcquiresDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "pgxpool", "empty_acquires_total"),
+		"Number of acquisitions that had to wait for a connection.",
+		[]string{"pool"}, nil,
+	)
+	poolAcquireDurationDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "pgxpool", "acquire_duration_seconds_total"),
+		"Total time spent acquiring connections.",
+		[]string{"pool"}, nil,
+	)
+)
+
+// PoolCollector exports the statistics of pgx connection pools, read on every scrape.
+type PoolCollector struct {
+	pools map[string]*pgxpool.Pool
+}
+
+// NewPoolCollector creates a collector for the given pools, keyed by the value
+// of their "pool" label.
+func NewPoolCollector(pools map[string]*pgxpool.Pool) *PoolCollector {
+	return &PoolCollector{pools: pools}
+}
+
+// Describe implements the prometheus.Collector interface.
+func (c *PoolCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- poolConnsDesc
+	ch <- poolMaxConnsDesc
+	ch <- poolAcquiresDesc
+	ch <- poolEmptyAcquiresDesc
+	ch <- poolAcquireDurationDesc
+}
+
+// Collect implements the prometheus.Collector interface.
+func (c *PoolCollector) Collect(ch chan<- prometheus.Metric) {
+	for name, pool := range c.pools {
+		stat := pool.Stat()
+		ch <- prometheus.MustNewConstMetric(poolConnsDesc, prometheus.GaugeValue, float64(stat.AcquiredConns()), name, "acquired")
+		ch <- prometheus.MustNewConstMetric(poolConnsDesc, prometheus.GaugeValue, float64(stat.IdleConns()), name, "idle")
+		ch <- prometheus.MustNewConstMetric(poolConnsDesc, prometheus.GaugeValue, float64(stat.ConstructingConns()), name, "constructing")
+		ch <- prometheus.MustNewConstMetric(poolMaxConnsDesc, prometheus.GaugeValue, float64(stat.MaxConns()), name)
+		ch <- prometheus.MustNewConstMetric(poolAcquiresDesc, prometheus.CounterValue, float64(stat.AcquireCount()), name)
+		ch <- prometheus.MustNewConstMetric(poolEmptyAcquiresDesc, prometheus.CounterValue, float64(stat.EmptyAcquireCount()), name)
+		ch <- prometheus.MustNewConstMetric(poolAcquireDurationDesc, prometheus.CounterValue, stat.AcquireDuration().Seconds(), name)
+	}
+}
+
+// RegisterPools registers a PoolCollector for pools with the default registry.
+// Registering pools under names that are already registered is a no-op.
+func RegisterPools(pools map[string]*pgxpool.Pool) error {
+	err := prometheus.Register(NewPoolCollector(pools))
+	var already prometheus.AlreadyRegisteredError
+	if errors.As(err, &already) {
+		return nil
+	}
+	return err
+}
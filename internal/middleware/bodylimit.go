@@ -0,0 +1,21 @@
+package middleware
+
+import "net/http"
+
+// WithBodyLimit provides HTTP middleware that limits request bodies to
+// maxBytes. Reading past the limit fails with *http.MaxBytesError, which the
+// handlers report as 413 Request Entity Too Large. Placed after
+// GzipMiddleware, the limit applies to the decompressed body. A value below
+// one disables the limit.
+func WithBodyLimit(maxBytes int64) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		if maxBytes < 1 {
+			return h
+		}
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			r.Body = http.MaxBytesReader(w, r.Body, maxBytes)
+			h.ServeHTTP(w, r)
+		}
+		return http.HandlerFunc(fn)
+	}
+}
@@ -5,22 +5,48 @@ import (
 	"io"
 	"net/http"
 	"strings"
+
+	"github.com/scaranin/go-svc-short-url/internal/metrics"
+	"github.com/scaranin/go-svc-short-url/internal/models"
 )
 
 // compressWriter implements http.ResponseWriter and transparently compresses data
-// written to it using gzip encoding. It automatically sets the appropriate
-// Content-Encoding header when the status code indicates success (<300).
+// written to it using gzip encoding. Only successful responses (status < 300)
+// are compressed and announced with Content-Encoding; other responses are
+// passed through as they are. Nothing is written until the response is started,
+// so a handler that never writes leaves the response to the outer handlers.
 type compressWriter struct {
 	w  http.ResponseWriter
 	zw *gzip.Writer
+	// uncompressed and compressed count the response bytes before and after
+	// compression for the gzip metrics.
+	uncompressed int
+	compressed   *countingWriter
+	// status is the status of the response, or zero until it is started.
+	status int
+}
+
+// countingWriter counts the bytes written to the underlying writer.
+type countingWriter struct {
+	w io.Writer
+	n int
+}
+
+// Write writes p to the underlying writer and counts the written bytes.
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += n
+	return n, err
 }
 
 // newCompressWriter creates a new compressWriter instance wrapping the provided
 // http.ResponseWriter and initializing a new gzip.Writer.
 func newCompressWriter(w http.ResponseWriter) *compressWriter {
+	compressed := &countingWriter{w: w}
 	return &compressWriter{
-		w:  w,
-		zw: gzip.NewWriter(w),
+		w:          w,
+		zw:         gzip.NewWriter(compressed),
+		compressed: compressed,
 	}
 }
 
@@ -29,24 +55,51 @@ func (c *compressWriter) Header() http.Header {
 	return c.w.Header()
 }
 
-// Write compresses the data using gzip before writing to the underlying ResponseWriter.
+// Write starts the response with 200 OK if needed and writes p, compressed
+// if the response is.
 func (c *compressWriter) Write(p []byte) (int, error) {
-	return c.zw.Write(p)
+	if c.status == 0 {
+		c.WriteHeader(http.StatusOK)
+	}
+	if c.status >= 300 {
+		return c.w.Write(p)
+	}
+	n, err := c.zw.Write(p)
+	c.uncompressed += n
+	return n, err
 }
 
-// WriteHeader sets the status code and adds Content-Encoding: gzip header
-// for successful responses (status code < 300).
+// WriteHeader starts the response. It adds the Content-Encoding: gzip header
+// for successful responses (status code < 300) and removes it otherwise.
 func (c *compressWriter) WriteHeader(statusCode int) {
+	if c.status != 0 {
+		return
+	}
+	c.status = statusCode
 	if statusCode < 300 {
 		c.w.Header().Set("Content-Encoding", "gzip")
+		c.w.Header().Del("Content-Length")
+	} else {
+		c.w.Header().Del("Content-Encoding")
 	}
 	c.w.WriteHeader(statusCode)
 }
 
 // Close flushes any pending compressed data and closes the gzip writer.
 // This should be called when finished with the writer to ensure all data is sent.
+// It also records the compression metrics of the response. It writes nothing
+// if the response was never started or is not compressed.
 func (c *compressWriter) Close() error {
-	return c.zw.Close()
+	if c.status == 0 || c.status >= 300 {
+		return nil
+	}
+	err := c.zw.Close()
+	metrics.GzipBytes.WithLabelValues("uncompressed").Add(float64(c.uncompressed))
+	metrics.GzipBytes.WithLabelValues("compressed").Add(float64(c.compressed.n))
+	if c.uncompressed > 0 {
+		metrics.GzipRatio.Observe(float64(c.compressed.n) / float64(c.uncompressed))
+	}
+	return err
 }
 
 // compressReader implements io.ReadCloser and transparently decompresses
@@ -101,7 +154,7 @@ func GzipMiddleware(h http.Handler) http.Handler {
 		if sendsGzip {
 			cr, err := newCompressReader(r.Body)
 			if err != nil {
-				w.WriteHeader(http.StatusInternalServerError)
+				WriteProblem(w, r, http.StatusBadRequest, models.CodeInvalidRequest, "request body is not valid gzip")
 				return
 			}
 			r.Body = cr
@@ -113,8 +166,6 @@ func GzipMiddleware(h http.Handler) http.Handler {
 		supportsGzip := strings.Contains(acceptEncoding, "gzip")
 
 		if supportsGzip {
-			ow.Header().Set("Content-Encoding", "gzip")
-
 			cw := newCompressWriter(w)
 			ow = cw
 
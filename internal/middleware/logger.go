@@ -1,13 +1,18 @@
 package middleware
 
 import (
-	"log"
 	"net/http"
 	"time"
 
+	"github.com/scaranin/go-svc-short-url/internal/logger"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
 )
 
+// redirectRoute is the route pattern of short URL redirects.
+const redirectRoute = "/{shortURL}"
+
 type (
 	// responseData holds captured response information for logging purposes.
 	responseData struct {
@@ -19,8 +24,8 @@ type (
 	// - HTTP status code (via WriteHeader)
 	// - Response size (via Write)
 	loggingResponseWriter struct {
-		http.ResponseWriter // встраиваем оригинальный http.ResponseWriter
-		responseData        *responseData
+		http.ResponseWriter
+		responseData *responseData
 	}
 )
 
@@ -37,48 +42,75 @@ func (r *loggingResponseWriter) WriteHeader(statusCode int) {
 	r.responseData.status = statusCode
 }
 
-// WithLogging provides HTTP middleware that logs request/response details.
-// Logs include:
-//   - Request URI
-//   - HTTP method
+// WithLogging provides HTTP middleware that writes an access log entry for
+// every request with the given logger. It stores a request-scoped logger in
+// the request context (see logger.FromContext), carrying the request ID set
+// by WithRequestID, the trace ID and, once a handler has authenticated the
+// request, the user ID. The entry
+// includes:
+//   - Request URI, HTTP method and chi route pattern
 //   - Response status code
 //   - Response duration
 //   - Response size in bytes
 //
-// The middleware uses zap logger in development mode for structured logging.
-func WithLogging(h http.Handler) http.Handler {
-	logFn := func(w http.ResponseWriter, r *http.Request) {
-		logger, err := zap.NewDevelopment()
-		if err != nil {
-			log.Fatal(err)
-		}
-		defer logger.Sync()
+// Successful redirects are by far the most frequent requests, so their
+// entries are sampled: per second the first redirectSampling entries are
+// written and then every redirectSampling-th. A value below one disables
+// sampling. They carry the fields handlers added with logger.With, such as
+// the A/B variant of the redirect.
+func WithLogging(log *zap.Logger, redirectSampling int) func(http.Handler) http.Handler {
+	redirectLog := log
+	if redirectSampling > 0 {
+		redirectLog = log.WithOptions(zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+			return zapcore.NewSamplerWithOptions(core, time.Second, redirectSampling, redirectSampling)
+		}))
+	}
 
-		sugar := *logger.Sugar()
+	return func(h http.Handler) http.Handler {
+		logFn := func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
 
-		start := time.Now()
+			var requestFields []zap.Field
+			if id := RequestIDFromContext(r.Context()); len(id) > 0 {
+				requestFields = append(requestFields, zap.String("request_id", id))
+			}
+			if spanContext := trace.SpanContextFromContext(r.Context()); spanContext.HasTraceID() {
+				requestFields = append(requestFields, zap.String("trace_id", spanContext.TraceID().String()))
+			}
+			ctx := logger.WithRequest(r.Context(), log.With(requestFields...))
 
-		responseData := &responseData{
-			status: 0,
-			size:   0,
-		}
-		lw := loggingResponseWriter{
-			ResponseWriter: w, // встраиваем оригинальный http.ResponseWriter
-			responseData:   responseData,
-		}
-
-		h.ServeHTTP(&lw, r)
+			responseData := &responseData{}
+			lw := loggingResponseWriter{
+				ResponseWriter: w,
+				responseData:   responseData,
+			}
 
-		duration := time.Since(start)
+			h.ServeHTTP(&lw, r.WithContext(ctx))
 
-		sugar.Infoln(
-			"uri", r.RequestURI,
-			"method", r.Method,
-			"status", responseData.status, // получаем перехваченный код статуса ответа
-			"duration", duration,
-			"size", responseData.size, // получаем перехваченный размер ответа
-		)
+			status := responseData.status
+			if status == 0 {
+				status = http.StatusOK
+			}
+			route := routePattern(r)
+			fields := []zap.Field{
+				zap.String("method", r.Method),
+				zap.String("uri", r.RequestURI),
+				zap.String("route", route),
+				zap.Int("status", status),
+				zap.Int("bytes", responseData.size),
+				zap.Duration("duration", time.Since(start)),
+			}
 
+			if status >= 300 && status < 400 && route == redirectRoute {
+				if userID := logger.UserID(ctx); len(userID) > 0 {
+					fields = append(fields, zap.String("user_id", userID))
+				}
+				fields = append(fields, logger.Fields(ctx)...)
+				redirectLog.Info("redirect", append(requestFields, fields...)...)
+				return
+			}
+			logger.FromContext(ctx).Info("request", fields...)
+		}
+		return http.HandlerFunc(logFn)
 	}
-	return http.HandlerFunc(logFn)
 }
@@ -0,0 +1,43 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi"
+	"github.com/scaranin/go-svc-short-url/internal/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestWithLogging(t *testing.T) {
+	core, logs := observer.New(zap.InfoLevel)
+	router := chi.NewRouter()
+	router.Use(WithRequestID, WithLogging(zap.New(core), 100))
+	router.Get("/{shortURL}", func(w http.ResponseWriter, r *http.Request) {
+		logger.With(r.Context(), zap.String("variant", "b"))
+		w.Header().Set("Location", "https://b.example/")
+		w.WriteHeader(http.StatusTemporaryRedirect)
+	})
+	router.Get("/api/user/urls", func(w http.ResponseWriter, r *http.Request) {
+		logger.With(r.Context(), zap.String("variant", "none"))
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/abc", nil)
+	req.Header.Set(RequestIDHeader, "req-1")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/user/urls", nil))
+
+	entries := logs.AllUntimed()
+	require.Len(t, entries, 2)
+	redirect := entries[0].ContextMap()
+	assert.Equal(t, "redirect", entries[0].Message)
+	assert.Equal(t, "b", redirect["variant"])
+	assert.Equal(t, "req-1", redirect["request_id"])
+	assert.Equal(t, int64(http.StatusTemporaryRedirect), redirect["status"])
+	assert.Equal(t, "request", entries[1].Message)
+	assert.Equal(t, "none", entries[1].ContextMap()["variant"])
+}
@@ -0,0 +1,72 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/scaranin/go-svc-short-url/internal/metrics"
+)
+
+// statusResponseWriter wraps http.ResponseWriter to capture the status code.
+type statusResponseWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+// WriteHeader captures the status code while delegating to the original ResponseWriter.
+func (r *statusResponseWriter) WriteHeader(statusCode int) {
+	if r.status == 0 {
+		r.status = statusCode
+	}
+	r.ResponseWriter.WriteHeader(statusCode)
+}
+
+// Write delegates to the original ResponseWriter; a body written without
+// WriteHeader implies status 200.
+func (r *statusResponseWriter) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	return r.ResponseWriter.Write(b)
+}
+
+// statusCode returns the captured status code; a response without a body or an
+// explicit status is sent with 200.
+func (r *statusResponseWriter) statusCode() int {
+	if r.status == 0 {
+		return http.StatusOK
+	}
+	return r.status
+}
+
+// routePattern returns the chi route pattern that matched r, or "unmatched".
+// It must be called after the router has handled the request.
+func routePattern(r *http.Request) string {
+	if rctx := chi.RouteContext(r.Context()); rctx != nil && len(rctx.RoutePattern()) > 0 {
+		return rctx.RoutePattern()
+	}
+	return "unmatched"
+}
+
+// WithMetrics provides HTTP middleware that records Prometheus request metrics:
+//   - the number of requests by method, route and status code
+//   - the request latency by method and route
+//
+// Requests are labelled with the chi route pattern rather than the path, so
+// every short URL is counted under "/{shortURL}". Requests that match no route
+// are labelled "unmatched".
+func WithMetrics(h http.Handler) http.Handler {
+	metricsFn := func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		mw := &statusResponseWriter{ResponseWriter: w}
+
+		h.ServeHTTP(mw, r)
+
+		route := routePattern(r)
+		metrics.HTTPRequests.WithLabelValues(r.Method, route, strconv.Itoa(mw.statusCode())).Inc()
+		metrics.HTTPDuration.WithLabelValues(r.Method, route).Observe(time.Since(start).Seconds())
+	}
+	return http.HandlerFunc(metricsFn)
+}
@@ -0,0 +1,45 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/scaranin/go-svc-short-url/internal/logger"
+	"github.com/scaranin/go-svc-short-url/internal/models"
+	"go.uber.org/zap"
+)
+
+// contentTypeProblem is the MIME type of models.Problem bodies.
+const contentTypeProblem = "application/problem+json"
+
+// WriteProblem replies to the request with an application/problem+json body
+// carrying the HTTP status, the stable error code and detail. The body
+// includes the request ID, so a client can quote it when reporting the
+// failure. Server errors are logged with the request logger.
+func WriteProblem(w http.ResponseWriter, r *http.Request, status int, code string, detail string) {
+	if status >= http.StatusInternalServerError {
+		logger.FromContext(r.Context()).Error("request failed",
+			zap.Int("status", status), zap.String("code", code), zap.String("detail", detail))
+	}
+
+	problem := models.Problem{
+		Type:      "about:blank",
+		Title:     http.StatusText(status),
+		Status:    status,
+		Code:      code,
+		Detail:    detail,
+		Instance:  r.URL.Path,
+		RequestID: RequestIDFromContext(r.Context()),
+	}
+	body, err := json.Marshal(problem)
+	if err != nil {
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+
+	w.Header().Del("Content-Length")
+	w.Header().Set("Content-Type", contentTypeProblem)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	_, _ = w.Write(body)
+}
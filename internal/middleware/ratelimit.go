@@ -0,0 +1,62 @@
+package middleware
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/scaranin/go-svc-short-url/internal/auth"
+	"github.com/scaranin/go-svc-short-url/internal/models"
+	"github.com/scaranin/go-svc-short-url/internal/ratelimit"
+)
+
+// WithRateLimit provides HTTP middleware that limits requests per user and
+// per client IP with limiter. The user is taken from a valid auth cookie and
+// the IP from the connection's remote address, so neither can be chosen
+// freely by the client. Every response carries the X-RateLimit-Limit,
+// X-RateLimit-Remaining and X-RateLimit-Reset headers; requests over the
+// limit are rejected with 429 Too Many Requests and a Retry-After header.
+// A nil limiter disables the middleware.
+func WithRateLimit(limiter *ratelimit.Limiter, authCfg auth.AuthConfig) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		if limiter == nil {
+			return h
+		}
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			keys := []string{"ip:" + clientIP(r)}
+			if cookie, err := r.Cookie(authCfg.CookieName); err == nil {
+				if userID, ok := authCfg.ParseUserID(cookie.Value); ok {
+					keys = append(keys, "user:"+userID)
+				}
+			}
+
+			res := limiter.Take(keys...)
+			w.Header().Set("X-RateLimit-Limit", strconv.Itoa(res.Limit))
+			w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(res.Remaining))
+			w.Header().Set("X-RateLimit-Reset", strconv.Itoa(ceilSeconds(res.Reset)))
+			if !res.Allowed {
+				w.Header().Set("Retry-After", strconv.Itoa(max(ceilSeconds(res.RetryAfter), 1)))
+				WriteProblem(w, r, http.StatusTooManyRequests, models.CodeRateLimited, "rate limit exceeded")
+				return
+			}
+			h.ServeHTTP(w, r)
+		}
+		return http.HandlerFunc(fn)
+	}
+}
+
+// clientIP returns the host part of the request's remote address.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// ceilSeconds rounds d up to whole seconds.
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,57 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/scaranin/go-svc-short-url/internal/auth"
+	"github.com/scaranin/go-svc-short-url/internal/ratelimit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithRateLimit(t *testing.T) {
+	authCfg := auth.NewAuthConfig()
+	token, err := authCfg.BuildJWTString()
+	require.NoError(t, err)
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	})
+	handler := WithRateLimit(ratelimit.New(1, 1), authCfg)(ok)
+
+	request := func(remoteAddr string, withCookie bool) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/", nil)
+		req.RemoteAddr = remoteAddr
+		if withCookie {
+			req.AddCookie(&http.Cookie{Name: authCfg.CookieName, Value: token})
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	w := request("10.0.0.1:1000", true)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, "1", w.Header().Get("X-RateLimit-Limit"))
+	assert.Equal(t, "0", w.Header().Get("X-RateLimit-Remaining"))
+	assert.Equal(t, "1", w.Header().Get("X-RateLimit-Reset"))
+
+	w = request("10.0.0.1:1001", false)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code, "the IP bucket is shared across ports")
+	assert.Equal(t, "1", w.Header().Get("Retry-After"))
+	assert.Equal(t, "application/problem+json", w.Header().Get("Content-Type"))
+
+	w = request("10.0.0.2:1000", true)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code, "the user bucket follows the user to another IP")
+
+	w = request("10.0.0.3:1000", false)
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	disabled := WithRateLimit(nil, authCfg)(ok)
+	req := httptest.NewRequest(http.MethodPost, "/", nil)
+	rec := httptest.NewRecorder()
+	disabled.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.Empty(t, rec.Header().Get("X-RateLimit-Limit"))
+}
@@ -0,0 +1,36 @@
+package middleware
+
+import (
+	"net/http"
+	"runtime/debug"
+
+	"github.com/scaranin/go-svc-short-url/internal/logger"
+	"github.com/scaranin/go-svc-short-url/internal/models"
+	"go.uber.org/zap"
+)
+
+// WithRecovery provides HTTP middleware that recovers from panics in the
+// wrapped handler. The panic is logged with its stack trace and the client
+// receives a 500 problem response, so a single faulty request cannot take
+// the whole process down. http.ErrAbortHandler is re-panicked, as net/http
+// uses it to abort a response on purpose.
+func WithRecovery(h http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			rec := recover()
+			if rec == nil {
+				return
+			}
+			if rec == http.ErrAbortHandler {
+				panic(rec)
+			}
+			logger.FromContext(r.Context()).Error("panic recovered",
+				zap.Any("panic", rec), zap.ByteString("stack", debug.Stack()))
+			// The body is written uncompressed, whatever the handler had announced.
+			w.Header().Del("Content-Encoding")
+			WriteProblem(w, r, http.StatusInternalServerError, models.CodeInternal, "internal server error")
+		}()
+		h.ServeHTTP(w, r)
+	}
+	return http.HandlerFunc(fn)
+}
@@ -0,0 +1,93 @@
+package middleware
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/scaranin/go-svc-short-url/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithRecovery(t *testing.T) {
+	panicking := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	})
+	handler := WithRequestID(WithRecovery(panicking))
+
+	req := httptest.NewRequest(http.MethodPost, "/api/shorten/batch", nil)
+	req.Header.Set(RequestIDHeader, "req-1")
+	w := httptest.NewRecorder()
+	require.NotPanics(t, func() { handler.ServeHTTP(w, req) })
+
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, "application/problem+json", w.Header().Get("Content-Type"))
+	var problem models.Problem
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &problem))
+	assert.Equal(t, models.Problem{
+		Type:      "about:blank",
+		Title:     "Internal Server Error",
+		Status:    http.StatusInternalServerError,
+		Code:      models.CodeInternal,
+		Detail:    "internal server error",
+		Instance:  "/api/shorten/batch",
+		RequestID: "req-1",
+	}, problem)
+}
+
+func TestWithRecoveryAbortHandler(t *testing.T) {
+	aborting := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	})
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	assert.PanicsWithValue(t, http.ErrAbortHandler, func() {
+		WithRecovery(aborting).ServeHTTP(httptest.NewRecorder(), req)
+	})
+}
+
+func TestWithRecoveryGzip(t *testing.T) {
+	panicking := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	})
+	chains := map[string]http.Handler{
+		"recovery inside gzip":  GzipMiddleware(WithRecovery(panicking)),
+		"recovery outside gzip": WithRecovery(GzipMiddleware(panicking)),
+	}
+	for name, handler := range chains {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/abc", nil)
+			req.Header.Set("Accept-Encoding", "gzip")
+			w := httptest.NewRecorder()
+			require.NotPanics(t, func() { handler.ServeHTTP(w, req) })
+
+			assert.Equal(t, http.StatusInternalServerError, w.Code)
+			assert.Empty(t, w.Header().Get("Content-Encoding"))
+			var problem models.Problem
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &problem), "the body is plain JSON")
+			assert.Equal(t, models.CodeInternal, problem.Code)
+		})
+	}
+}
+
+func TestGzipMiddleware(t *testing.T) {
+	handler := GzipMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(strings.Repeat("short", 100)))
+	}))
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "gzip", w.Header().Get("Content-Encoding"))
+	zr, err := gzip.NewReader(w.Body)
+	require.NoError(t, err)
+	body, err := io.ReadAll(zr)
+	require.NoError(t, err)
+	assert.Equal(t, strings.Repeat("short", 100), string(body))
+}
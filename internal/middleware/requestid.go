@@ -0,0 +1,71 @@
+package middleware
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// RequestIDHeader is the header carrying the request ID in requests and responses.
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength limits the length of request IDs accepted from clients.
+const maxRequestIDLength = 128
+
+// requestIDKey is the type of the context key holding the request ID.
+type requestIDKey struct{}
+
+// WithRequestID provides HTTP middleware that assigns an ID to every request.
+// The ID sent by the client in the X-Request-ID header is kept if it is
+// valid, otherwise a random one is generated. The ID is stored in the request
+// context (see RequestIDFromContext), added to the current span and echoed in
+// the X-Request-ID response header.
+func WithRequestID(h http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+
+		trace.SpanFromContext(r.Context()).SetAttributes(attribute.String("http.request_id", id))
+		w.Header().Set(RequestIDHeader, id)
+		h.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id)))
+	}
+	return http.HandlerFunc(fn)
+}
+
+// RequestIDFromContext returns the ID assigned to the request by WithRequestID,
+// or "" if ctx does not carry one.
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// validRequestID reports whether a client-supplied request ID may be reused.
+// Only short IDs made of letters, digits and a few separators are accepted,
+// so they cannot forge log lines or response headers.
+func validRequestID(id string) bool {
+	if len(id) == 0 || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-', c == '_', c == '.', c == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// newRequestID generates a random 128-bit request ID in hex.
+func newRequestID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,47 @@
+package middleware
+
+import (
+	"net/http"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerName identifies the spans started by this package.
+const tracerName = "github.com/scaranin/go-svc-short-url/internal/middleware"
+
+// WithTracing provides HTTP middleware that starts an OpenTelemetry server
+// span for every request. It continues the trace from the W3C traceparent
+// header if the client sent one, and passes the span to the handlers through
+// the request context. Once routing is done the span is named after the chi
+// route pattern, e.g. "GET /{shortURL}". Responses with a 5xx status mark the
+// span as failed.
+func WithTracing(h http.Handler) http.Handler {
+	tracer := otel.Tracer(tracerName)
+	traceFn := func(w http.ResponseWriter, r *http.Request) {
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := tracer.Start(ctx, r.Method,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPRequestMethodKey.String(r.Method),
+				semconv.URLPath(r.URL.Path),
+			),
+		)
+		defer span.End()
+
+		sw := &statusResponseWriter{ResponseWriter: w}
+		h.ServeHTTP(sw, r.WithContext(ctx))
+
+		route := routePattern(r)
+		status := sw.statusCode()
+		span.SetName(r.Method + " " + route)
+		span.SetAttributes(semconv.HTTPRoute(route), semconv.HTTPResponseStatusCode(status))
+		if status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(status))
+		}
+	}
+	return http.HandlerFunc(traceFn)
+}
@@ -0,0 +1,13 @@
+/*
+Package migrate copies URL records between storage backends.
+
+It streams every record, including its owner and deletion state, from any storage
+implementing `models.Exporter` into any storage implementing `models.Importer`.
+Progress is checkpointed to a file after each batch, so an interrupted migration
+resumes where it stopped. The checkpoint records which source and target it
+belongs to, and a checkpoint left by another migration is rejected rather than
+resumed. An optional verification pass compares the source and target record
+by record once the copy is complete.
+*/
+
+package migrate
@@ -0,0 +1,330 @@
+package migrate
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/scaranin/go-svc-short-url/internal/models"
+	"github.com/scaranin/go-svc-short-url/internal/storage"
+)
+
+// maxReportedMismatches caps the number of mismatching short URLs kept in a Report.
+const maxReportedMismatches = 100
+
+// Options controls how records are copied between storages.
+type Options struct {
+	// BatchSize is the number of records read from the source per page.
+	BatchSize int
+	// CheckpointPath is the file that stores the last copied short URL.
+	// An empty path disables resuming.
+	CheckpointPath string
+	// CheckpointKey identifies the source and target pair, see CheckpointKey.
+	// A checkpoint written under another key is rejected, so the position of
+	// one migration is never used to resume another.
+	CheckpointKey string
+	// Verify enables the verification pass after the copy.
+	Verify bool
+	// Progress, if set, is called after every copied batch.
+	Progress func(Report)
+}
+
+// Report summarizes a migration run.
+type Report struct {
+	// ResumedFrom is the short URL the copy resumed after, if a checkpoint was found.
+	ResumedFrom string
+	// Copied is the number of records copied during this run.
+	Copied int
+	// Verified is the number of source records found identical in the target.
+	Verified int
+	// Mismatches lists short URLs that are missing or differ in the target.
+	Mismatches []string
+}
+
+// Run copies all records from src to dst and, if opts.Verify is set, verifies
+// the result. Both storages must support export, and dst must support import.
+// On success the checkpoint file is removed so the next run starts from scratch.
+func Run(src models.Storage, dst models.Storage, opts Options) (Report, error) {
+	var report Report
+	srcExporter, ok := src.(models.Exporter)
+	if !ok {
+		return report, fmt.Errorf("source storage %T does not support export", src)
+	}
+	dstImporter, ok := dst.(models.Importer)
+	if !ok {
+		return report, fmt.Errorf("target storage %T does not support import", dst)
+	}
+
+	report, err := Copy(srcExporter, dstImporter, opts)
+	if err != nil {
+		return report, err
+	}
+
+	if opts.Verify {
+		dstExporter, ok := dst.(models.Exporter)
+		if !ok {
+			return report, fmt.Errorf("target storage %T does not support export", dst)
+		}
+		report.Verified, report.Mismatches, err = Verify(srcExporter, dstExporter, opts.BatchSize)
+		if err != nil {
+			return report, err
+		}
+		if len(report.Mismatches) > 0 {
+			return report, fmt.Errorf("verification failed: %d mismatching records", len(report.Mismatches))
+		}
+	}
+
+	if len(opts.CheckpointPath) > 0 {
+		if err = os.Remove(opts.CheckpointPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return report, err
+		}
+	}
+	return report, nil
+}
+
+// Copy streams records from src into dst in batches, starting after the short URL
+// stored in the checkpoint file, and updates the checkpoint after every batch.
+func Copy(src models.Exporter, dst models.Importer, opts Options) (Report, error) {
+	var report Report
+	after, err := readCheckpoint(opts.CheckpointPath, opts.CheckpointKey)
+	if err != nil {
+		return report, err
+	}
+	report.ResumedFrom = after
+
+	for {
+		URLs, err := src.ExportURLs(after, opts.BatchSize)
+		if err != nil {
+			return report, err
+		}
+		if len(URLs) == 0 {
+			return report, nil
+		}
+
+		for i := range URLs {
+			if err = dst.ImportURL(&URLs[i]); err != nil {
+				return report, fmt.Errorf("import %s: %w", URLs[i].ShortURL, err)
+			}
+		}
+		after = URLs[len(URLs)-1].ShortURL
+		report.Copied += len(URLs)
+
+		if err = writeCheckpoint(opts.CheckpointPath, opts.CheckpointKey, after); err != nil {
+			return report, err
+		}
+		if opts.Progress != nil {
+			opts.Progress(report)
+		}
+	}
+}
+
+// Verify walks src and dst side by side in short URL order and checks that every
+// source record exists in dst with the same content. Records present only in dst
+// are ignored. It returns the number of verified records and up to
+// maxReportedMismatches short URLs that are missing or differ.
+func Verify(src models.Exporter, dst models.Exporter, batchSize int) (int, []string, error) {
+	var (
+		verified   int
+		mismatches []string
+	)
+	srcPager := &pager{exporter: src, batchSize: batchSize}
+	dstPager := &pager{exporter: dst, batchSize: batchSize}
+
+	for {
+		srcURL, err := srcPager.next()
+		if err != nil {
+			return verified, mismatches, err
+		}
+		if srcURL == nil {
+			return verified, mismatches, nil
+		}
+
+		dstURL, err := dstPager.seek(srcURL.ShortURL)
+		if err != nil {
+			return verified, mismatches, err
+		}
+		if dstURL != nil && dstURL.ShortURL == srcURL.ShortURL && sameRecord(srcURL, dstURL) {
+			verified++
+			continue
+		}
+		if len(mismatches) < maxReportedMismatches {
+			mismatches = append(mismatches, srcURL.ShortURL)
+		}
+	}
+}
+
+// sameRecord reports whether two records carry the same migrated content,
+// that is every persisted field. The plain-text Password and CorrelationID are
+// never stored and are not compared.
+func sameRecord(a, b *models.URL) bool {
+	return a.OriginalURL == b.OriginalURL &&
+		canonicalURL(a) == canonicalURL(b) &&
+		a.UserID == b.UserID &&
+		a.IsDeleted == b.IsDeleted &&
+		a.PasswordHash == b.PasswordHash &&
+		a.Clicks == b.Clicks &&
+		maps.Equal(a.VariantClicks, b.VariantClicks) &&
+		a.RedirectStatus == b.RedirectStatus &&
+		a.ForwardQuery == b.ForwardQuery &&
+		a.Title == b.Title &&
+		a.Description == b.Description &&
+		a.AlwaysPreview == b.AlwaysPreview &&
+		a.MaxClicks == b.MaxClicks &&
+		sameTime(a.NotBefore, b.NotBefore) &&
+		sameTime(a.ExpiresAt, b.ExpiresAt) &&
+		slices.Equal(a.Targets, b.Targets) &&
+		slices.Equal(a.Variants, b.Variants)
+}
+
+// canonicalURL returns the canonical URL of u. Records shortened before
+// canonicalization have none, which DBStorage reports as the original URL.
+func canonicalURL(u *models.URL) string {
+	if len(u.CanonicalURL) == 0 {
+		return u.OriginalURL
+	}
+	return u.CanonicalURL
+}
+
+// sameTime reports whether a and b are both unset or the same instant at the
+// microsecond precision of Postgres.
+func sameTime(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Truncate(time.Microsecond).Equal(b.Truncate(time.Microsecond))
+}
+
+// pager iterates over all records of an Exporter one page at a time.
+type pager struct {
+	exporter  models.Exporter
+	batchSize int
+	page      []models.URL
+	pos       int
+	after     string
+	done      bool
+}
+
+// peek returns the current record without consuming it, or nil when exhausted.
+func (p *pager) peek() (*models.URL, error) {
+	if p.pos == len(p.page) {
+		if p.done {
+			return nil, nil
+		}
+		page, err := p.exporter.ExportURLs(p.after, p.batchSize)
+		if err != nil {
+			return nil, err
+		}
+		if len(page) == 0 {
+			p.done = true
+			return nil, nil
+		}
+		p.page, p.pos = page, 0
+		p.after = page[len(page)-1].ShortURL
+	}
+	return &p.page[p.pos], nil
+}
+
+// next returns the current record and advances past it, or nil when exhausted.
+func (p *pager) next() (*models.URL, error) {
+	URL, err := p.peek()
+	if URL != nil {
+		p.pos++
+	}
+	return URL, err
+}
+
+// seek skips records whose short URL sorts before shortURL and returns the first
+// remaining record without consuming it, or nil when exhausted.
+func (p *pager) seek(shortURL string) (*models.URL, error) {
+	for {
+		URL, err := p.peek()
+		if err != nil || URL == nil || URL.ShortURL >= shortURL {
+			return URL, err
+		}
+		p.pos++
+	}
+}
+
+// checkpoint is the content of the checkpoint file.
+type checkpoint struct {
+	// Key is the CheckpointKey of the migration that wrote the file.
+	Key string `json:"key"`
+	// After is the last copied short URL.
+	After string `json:"after"`
+}
+
+// CheckpointKey returns the key identifying a migration from the storage spec
+// from to the storage spec to. The specs are hashed, so credentials in a
+// database DSN do not end up in the checkpoint file.
+func CheckpointKey(from string, to string) string {
+	sum := sha256.Sum256([]byte(from + "\x00" + to))
+	return hex.EncodeToString(sum[:])
+}
+
+// readCheckpoint returns the short URL stored in the checkpoint file, or an empty
+// string if the path is empty or the file does not exist. It fails if the file
+// was written under a key other than key.
+func readCheckpoint(path string, key string) (string, error) {
+	if len(path) == 0 {
+		return "", nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	var cp checkpoint
+	if err = json.Unmarshal(data, &cp); err != nil {
+		return "", fmt.Errorf("checkpoint %s: %w", path, err)
+	}
+	if cp.Key != key {
+		return "", fmt.Errorf("checkpoint %s belongs to a migration between other storages; remove it to start over", path)
+	}
+	return cp.After, nil
+}
+
+// writeCheckpoint atomically replaces the checkpoint file with the given key
+// and short URL.
+func writeCheckpoint(path string, key string, shortURL string) error {
+	if len(path) == 0 {
+		return nil
+	}
+	data, err := json.Marshal(checkpoint{Key: key, After: shortURL})
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err = os.WriteFile(tmp, append(data, '\n'), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// OpenStore opens the storage described by spec and returns it together with a
+// function that releases its resources. Supported specs are:
+//   - postgres://... or postgresql://... for DBStorage
+//   - bolt:<path> for BoltStorage
+//   - file:<path> for FileStorageJSON
+func OpenStore(spec string) (models.Storage, func(), error) {
+	switch {
+	case strings.HasPrefix(spec, "postgres://"), strings.HasPrefix(spec, "postgresql://"):
+		store, err := storage.CreateStoreDB(spec)
+		return store, store.Close, err
+	case strings.HasPrefix(spec, "bolt:"):
+		store, err := storage.CreateStoreBolt(strings.TrimPrefix(spec, "bolt:"))
+		return store, store.Close, err
+	case strings.HasPrefix(spec, "file:"):
+		store, err := storage.CreateStoreFile(strings.TrimPrefix(spec, "file:"))
+		return store, store.Close, err
+	}
+	return nil, func() {}, fmt.Errorf("unknown storage spec %q", spec)
+}
@@ -0,0 +1,233 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/scaranin/go-svc-short-url/internal/models"
+	"github.com/scaranin/go-svc-short-url/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// failingImporter imports records into Importer until limit records have been
+// imported and fails afterwards, like a migration interrupted half way.
+type failingImporter struct {
+	models.Importer
+	limit int
+}
+
+func (fi *failingImporter) ImportURL(URL *models.URL) error {
+	if fi.limit == 0 {
+		return errors.New("connection lost")
+	}
+	fi.limit--
+	return fi.Importer.ImportURL(URL)
+}
+
+// newSource returns an in-memory storage holding the records a, b, c, d and e,
+// with d deleted.
+func newSource(t *testing.T) storage.FileStorageJSON {
+	t.Helper()
+	src, err := storage.CreateStoreFile("")
+	require.NoError(t, err)
+	for _, shortURL := range []string{"a", "b", "c", "d", "e"} {
+		require.NoError(t, src.ImportURL(&models.URL{
+			ShortURL:    shortURL,
+			OriginalURL: "https://" + shortURL + ".example",
+			UserID:      "u1",
+			IsDeleted:   shortURL == "d",
+		}))
+	}
+	return src
+}
+
+// newTarget returns an empty BoltStorage in a temporary directory.
+func newTarget(t *testing.T) storage.BoltStorage {
+	t.Helper()
+	dst, err := storage.CreateStoreBolt(filepath.Join(t.TempDir(), "target.db"))
+	require.NoError(t, err)
+	t.Cleanup(dst.Close)
+	return dst
+}
+
+func TestRun(t *testing.T) {
+	src := newSource(t)
+	dst := newTarget(t)
+	checkpointPath := filepath.Join(t.TempDir(), "checkpoint")
+
+	var progress []int
+	report, err := Run(src, dst, Options{
+		BatchSize:      2,
+		CheckpointPath: checkpointPath,
+		CheckpointKey:  CheckpointKey("file:a", "bolt:b"),
+		Verify:         true,
+		Progress:       func(r Report) { progress = append(progress, r.Copied) },
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 5, report.Copied)
+	assert.Equal(t, 5, report.Verified)
+	assert.Empty(t, report.Mismatches)
+	assert.Equal(t, []int{2, 4, 5}, progress)
+	assert.NoFileExists(t, checkpointPath, "a finished migration removes its checkpoint")
+
+	ctx := context.Background()
+	originalURL, err := dst.Load(ctx, "a")
+	require.NoError(t, err)
+	assert.Equal(t, "https://a.example", originalURL)
+	_, err = dst.Load(ctx, "d")
+	assert.ErrorIs(t, err, models.ErrDeleted, "the deletion state is copied")
+	list, err := dst.GetUserURLList(ctx, "u1")
+	require.NoError(t, err)
+	assert.Len(t, list, 4, "the owner is copied")
+}
+
+func TestCopyResume(t *testing.T) {
+	src := newSource(t)
+	dst := newTarget(t)
+	key := CheckpointKey("file:a", "bolt:b")
+	opts := Options{BatchSize: 2, CheckpointPath: filepath.Join(t.TempDir(), "checkpoint"), CheckpointKey: key}
+
+	report, err := Copy(src, &failingImporter{Importer: dst, limit: 3}, opts)
+	require.Error(t, err)
+	assert.Equal(t, 2, report.Copied, "only whole batches are checkpointed")
+
+	after, err := readCheckpoint(opts.CheckpointPath, key)
+	require.NoError(t, err)
+	assert.Equal(t, "b", after)
+
+	report, err = Copy(src, dst, opts)
+	require.NoError(t, err)
+	assert.Equal(t, "b", report.ResumedFrom)
+	assert.Equal(t, 3, report.Copied)
+
+	verified, mismatches, err := Verify(src, dst, 2)
+	require.NoError(t, err)
+	assert.Equal(t, 5, verified)
+	assert.Empty(t, mismatches)
+}
+
+func TestCopyCheckpointKey(t *testing.T) {
+	checkpointPath := filepath.Join(t.TempDir(), "checkpoint")
+	require.NoError(t, writeCheckpoint(checkpointPath, CheckpointKey("file:a", "bolt:b"), "c"))
+
+	tests := []struct {
+		name    string
+		key     string
+		wantErr bool
+	}{
+		{name: "same pair", key: CheckpointKey("file:a", "bolt:b")},
+		{name: "other source", key: CheckpointKey("file:other", "bolt:b"), wantErr: true},
+		{name: "other target", key: CheckpointKey("file:a", "bolt:other"), wantErr: true},
+		{name: "swapped", key: CheckpointKey("bolt:b", "file:a"), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dst := newTarget(t)
+			report, err := Copy(newSource(t), dst, Options{BatchSize: 2, CheckpointPath: checkpointPath, CheckpointKey: tt.key})
+			if tt.wantErr {
+				require.Error(t, err)
+				assert.Zero(t, report.Copied)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, "c", report.ResumedFrom)
+			assert.Equal(t, 2, report.Copied)
+		})
+	}
+}
+
+func TestVerify(t *testing.T) {
+	tests := []struct {
+		name           string
+		change         func(t *testing.T, src storage.FileStorageJSON, dst storage.BoltStorage)
+		wantVerified   int
+		wantMismatches []string
+	}{
+		{
+			name:         "identical",
+			change:       func(t *testing.T, src storage.FileStorageJSON, dst storage.BoltStorage) {},
+			wantVerified: 5,
+		},
+		{
+			name: "extra target record",
+			change: func(t *testing.T, src storage.FileStorageJSON, dst storage.BoltStorage) {
+				require.NoError(t, dst.ImportURL(&models.URL{ShortURL: "bb", OriginalURL: "https://bb.example"}))
+			},
+			wantVerified: 5,
+		},
+		{
+			name: "different destination",
+			change: func(t *testing.T, src storage.FileStorageJSON, dst storage.BoltStorage) {
+				require.NoError(t, dst.ImportURL(&models.URL{ShortURL: "b", OriginalURL: "https://other.example", UserID: "u1"}))
+			},
+			wantVerified:   4,
+			wantMismatches: []string{"b"},
+		},
+		{
+			name: "different deletion state",
+			change: func(t *testing.T, src storage.FileStorageJSON, dst storage.BoltStorage) {
+				require.NoError(t, dst.ImportURL(&models.URL{ShortURL: "d", OriginalURL: "https://d.example", UserID: "u1"}))
+			},
+			wantVerified:   4,
+			wantMismatches: []string{"d"},
+		},
+		{
+			name: "different password hash",
+			change: func(t *testing.T, src storage.FileStorageJSON, dst storage.BoltStorage) {
+				require.NoError(t, dst.ImportURL(&models.URL{ShortURL: "a", OriginalURL: "https://a.example", UserID: "u1", PasswordHash: "$2a$10$hash"}))
+			},
+			wantVerified:   4,
+			wantMismatches: []string{"a"},
+		},
+		{
+			name: "different link options",
+			change: func(t *testing.T, src storage.FileStorageJSON, dst storage.BoltStorage) {
+				require.NoError(t, dst.ImportURL(&models.URL{ShortURL: "b", OriginalURL: "https://b.example", UserID: "u1", LinkOptions: models.LinkOptions{MaxClicks: 5}}))
+			},
+			wantVerified:   4,
+			wantMismatches: []string{"b"},
+		},
+		{
+			name: "different clicks",
+			change: func(t *testing.T, src storage.FileStorageJSON, dst storage.BoltStorage) {
+				require.NoError(t, dst.ImportURL(&models.URL{ShortURL: "c", OriginalURL: "https://c.example", UserID: "u1", VariantClicks: map[string]int{"a": 1}}))
+			},
+			wantVerified:   4,
+			wantMismatches: []string{"c"},
+		},
+		{
+			name: "deleted in target",
+			change: func(t *testing.T, src storage.FileStorageJSON, dst storage.BoltStorage) {
+				require.NoError(t, dst.DeleteBulk(context.Background(), "u1", []string{"a"}))
+			},
+			wantVerified:   4,
+			wantMismatches: []string{"a"},
+		},
+		{
+			name: "missing in target",
+			change: func(t *testing.T, src storage.FileStorageJSON, dst storage.BoltStorage) {
+				require.NoError(t, src.ImportURL(&models.URL{ShortURL: "ab", OriginalURL: "https://ab.example"}))
+				require.NoError(t, src.ImportURL(&models.URL{ShortURL: "f", OriginalURL: "https://f.example"}))
+			},
+			wantVerified:   5,
+			wantMismatches: []string{"ab", "f"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src := newSource(t)
+			dst := newTarget(t)
+			_, err := Copy(src, dst, Options{BatchSize: 2})
+			require.NoError(t, err)
+			tt.change(t, src, dst)
+
+			verified, mismatches, err := Verify(src, dst, 2)
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantVerified, verified)
+			assert.Equal(t, tt.wantMismatches, mismatches)
+		})
+	}
+}
@@ -1,40 +1,173 @@
 package models
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"os"
+	"reflect"
+	"time"
+
+	"github.com/scaranin/go-svc-short-url/internal/targeting"
+)
+
+var (
+	// ErrDeleted is returned by Storage.Load when the requested short URL has been
+	// soft-deleted by its owner. Handlers translate it to HTTP 410 Gone.
+	ErrDeleted = errors.New("ROW_IS_DELETED")
+	// ErrConflict is returned by Storage.Save when the original URL has already been
+	// shortened. The short URL returned alongside it identifies the existing record.
+	ErrConflict = errors.New("URL_ALREADY_EXISTS")
+	// ErrUnavailable is returned when the storage is temporarily unreachable and
+	// the request cannot be served from a fallback. Handlers translate it to
+	// HTTP 503 Service Unavailable.
+	ErrUnavailable = errors.New("STORAGE_UNAVAILABLE")
+	// ErrClicksExhausted is returned by Storage.LoadURL and Storage.RecordClick
+	// when a click-limited short URL has been followed MaxClicks times.
+	// Handlers translate it to HTTP 410 Gone.
+	ErrClicksExhausted = errors.New("CLICKS_EXHAUSTED")
+	// ErrNotOwned is returned by Storage.UpdateVariants when the short URL does
+	// not exist, is deleted or belongs to another user. Handlers translate it
+	// to HTTP 404 Not Found.
+	ErrNotOwned = errors.New("URL_NOT_OWNED")
+	// ErrNotFound is returned by Storage.LoadURL when the requested short URL
+	// does not exist. Handlers translate it to HTTP 404 Not Found.
+	ErrNotFound = errors.New("URL_NOT_FOUND")
 )
 
 // Storage defines the interface for URL persistence layers.
 // It abstracts the underlying data store (e.g., in-memory map, file, database),
 // allowing different implementations to be used interchangeably.
+// Every method takes the context of the request it serves, which carries its
+// deadline and its trace.
 type Storage interface {
 	// Save takes a URL object and persists it. It returns the short URL identifier
 	// and an error if the operation fails (e.g., a conflict on a unique URL).
-	Save(URL *URL) (string, error)
+	Save(ctx context.Context, URL *URL) (string, error)
 	// Load retrieves the original URL corresponding to a given short URL identifier.
 	// It returns an error if the short URL is not found or has been marked as deleted.
-	Load(shortURL string) (string, error)
+	Load(ctx context.Context, shortURL string) (string, error)
+	// LoadURL works like Load but returns the whole record, including its link
+	// options. A record with an empty OriginalURL means the short URL is not found.
+	LoadURL(ctx context.Context, shortURL string) (URL, error)
+	// RecordClick counts a redirect through a short URL. For a click-limited
+	// URL it atomically increments the click count unless MaxClicks has been
+	// reached, in which case it returns ErrClicksExhausted. A non-empty variant
+	// names the A/B variant the redirect was sent to, and is counted in
+	// URL.VariantClicks. Other redirects are not counted.
+	RecordClick(ctx context.Context, shortURL string, variant string) error
+	// UpdateVariants replaces the A/B variants of a short URL owned by UserID.
+	// The click counts of the variants are kept.
+	UpdateVariants(ctx context.Context, UserID string, shortURL string, variants []Variant) error
 	// GetUserURLList retrieves a list of all URLs created by a specific user.
 	// It returns a slice of URLUserList objects and an error if the query fails.
-	GetUserURLList(UserID string) ([]URLUserList, error)
+	GetUserURLList(ctx context.Context, UserID string) ([]URLUserList, error)
 	// DeleteBulk marks a batch of URLs for deletion for a specific user.
 	// This is typically a "soft delete" operation.
-	DeleteBulk(UserID string, ShortURLs []string) error
+	DeleteBulk(ctx context.Context, UserID string, ShortURLs []string) error
+
+	GetStats(ctx context.Context) (Statistic, error)
+}
+
+// Exporter is implemented by storages that can stream their full contents,
+// for example to migrate them into another backend.
+type Exporter interface {
+	// ExportURLs returns up to limit records, including deleted ones, whose ShortURL
+	// sorts strictly after the given value, in ascending ShortURL order. An empty
+	// slice means there are no more records.
+	ExportURLs(after string, limit int) ([]URL, error)
+}
+
+// Importer is implemented by storages that can accept records produced by an Exporter.
+type Importer interface {
+	// ImportURL stores the record as is, preserving its owner and deletion state.
+	// Importing a record that already exists overwrites it, so imports can be repeated.
+	ImportURL(URL *URL) error
+}
 
-	GetStats() (Statistic, error)
+// Pinger is implemented by storages that can check whether their backend is reachable.
+type Pinger interface {
+	// Ping returns an error if the storage cannot currently serve requests.
+	Ping(ctx context.Context) error
+}
+
+// Migrator is implemented by storages with a versioned schema.
+type Migrator interface {
+	// PendingMigrations returns the number of schema migrations not applied yet.
+	PendingMigrations(ctx context.Context) (int, error)
 }
 
 // Request represents the JSON structure for a single URL shortening request.
 type Request struct {
 	// URL is the original URL to be shortened.
 	URL string `json:"url"`
+	LinkOptions
+}
+
+// LinkOptions are the per-link settings chosen when a URL is shortened.
+type LinkOptions struct {
+	// RedirectStatus is the status of the redirect to the original URL: 301,
+	// 302, 307 or 308. Zero means the service default.
+	RedirectStatus int `json:"redirect_status,omitempty"`
+	// ForwardQuery appends the query string of the short URL request to the
+	// original URL when redirecting.
+	ForwardQuery bool `json:"forward_query,omitempty"`
+	// Title is shown on the preview page of the link.
+	Title string `json:"title,omitempty"`
+	// Description is shown on the preview page of the link.
+	Description string `json:"description,omitempty"`
+	// AlwaysPreview shows the preview page, with a warning, on every visit
+	// instead of redirecting.
+	AlwaysPreview bool `json:"always_preview,omitempty"`
+	// Password protects the link. It is only set in requests and is never
+	// stored: the handlers replace it with URL.PasswordHash.
+	Password string `json:"password,omitempty"`
+	// MaxClicks is the number of redirects after which the link expires, e.g.
+	// 1 for a one-time link. Zero means no limit.
+	MaxClicks int `json:"max_clicks,omitempty"`
+	// NotBefore is the time the link goes live. Until then it answers with the
+	// "coming soon" response of the service. Nil means active at once.
+	NotBefore *time.Time `json:"not_before,omitempty"`
+	// ExpiresAt is the time after which the link is gone. Nil means never.
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	// Targets send clients matching their platform or language to other
+	// destinations, in order. The original URL is the fallback.
+	Targets []targeting.Rule `json:"targets,omitempty"`
+	// Variants split the redirects between several destinations by weight,
+	// for A/B tests. A client keeps the variant it was first sent to.
+	Variants []Variant `json:"variants,omitempty"`
+}
+
+// Variant is one destination of an A/B split.
+type Variant struct {
+	// Name identifies the variant in the sticky cookie and in click counts.
+	Name string `json:"name"`
+	// URL is the destination of the variant.
+	URL string `json:"url"`
+	// Weight is the share of new clients sent to the variant, relative to the
+	// weights of the other variants. Zero stops sending clients to it.
+	Weight int `json:"weight"`
+}
+
+// VariantReport is a variant of a short URL with the number of redirects it
+// received, as reported to the owner.
+type VariantReport struct {
+	Variant
+	// Clicks is the number of redirects to the variant.
+	Clicks int `json:"clicks"`
+}
+
+// IsZero reports whether no link option is set.
+func (o LinkOptions) IsZero() bool {
+	return reflect.ValueOf(o).IsZero()
 }
 
 // Response represents the JSON structure for a single URL shortening response.
 type Response struct {
 	// Result contains the generated short URL.
 	Result string `json:"result"`
+	// QRURL is the URL of the QR code of the short URL.
+	QRURL string `json:"qr_url,omitempty"`
 }
 
 // URL represents the core data model for a shortened URL, linking the
@@ -43,13 +176,41 @@ type URL struct {
 	// CorrelationID is an optional identifier used in batch operations.
 	// The `json:"-"` tag prevents it from being serialized into JSON.
 	CorrelationID string `json:"-"`
-	// OriginalURL is the original, full-length URL.
+	// OriginalURL is the original, full-length URL as entered by the user. It
+	// is the redirect target and is shown back to the user.
 	OriginalURL string `json:"url"`
+	// CanonicalURL is the normalized form of OriginalURL that ShortURL is derived
+	// from, so spellings of the same address share one short URL.
+	CanonicalURL string `json:"canonical_url,omitempty"`
 	// ShortURL is the generated short URL identifier.
 	ShortURL string `json:"shorturl"`
 	// UserID is the identifier of the user who owns this URL.
-	// The `json:"-"` tag prevents it from being serialized into JSON.
-	UserID string `json:"-"`
+	UserID string `json:"user_id,omitempty"`
+	// IsDeleted reports whether the URL has been soft-deleted by its owner.
+	IsDeleted bool `json:"is_deleted,omitempty"`
+	// PasswordHash is the bcrypt hash of the password protecting the link, or
+	// empty if the link is not protected.
+	PasswordHash string `json:"password_hash,omitempty"`
+	// Clicks is the number of redirects counted against MaxClicks.
+	Clicks int `json:"clicks,omitempty"`
+	// VariantClicks is the number of redirects to each of the Variants, by name.
+	VariantClicks map[string]int `json:"variant_clicks,omitempty"`
+	LinkOptions
+}
+
+// Exhausted reports whether the link has been followed MaxClicks times.
+func (u URL) Exhausted() bool {
+	return u.MaxClicks > 0 && u.Clicks >= u.MaxClicks
+}
+
+// Scheduled reports whether the link is not active yet at now.
+func (u URL) Scheduled(now time.Time) bool {
+	return u.NotBefore != nil && now.Before(*u.NotBefore)
+}
+
+// Expired reports whether the link has expired at now.
+func (u URL) Expired(now time.Time) bool {
+	return u.ExpiresAt != nil && !now.Before(*u.ExpiresAt)
 }
 
 // PairRequest represents a single item in a batch shortening request.
@@ -58,6 +219,7 @@ type PairRequest struct {
 	CorrelationID string `json:"correlation_id"`
 	// OriginalURL is the URL to be shortened for this item.
 	OriginalURL string `json:"original_url"`
+	LinkOptions
 }
 
 // PairResponse represents a single item in a batch shortening response.
@@ -75,6 +237,8 @@ type URLUserList struct {
 	ShortURL string `json:"short_url"`
 	// OriginalURL is the original URL that was shortened.
 	OriginalURL string `json:"original_url"`
+	// QRURL is the URL of the QR code of the short URL.
+	QRURL string `json:"qr_url,omitempty"`
 }
 
 // Producer is responsible for writing URL data to a file in a streaming JSON format.
@@ -90,6 +254,86 @@ type Statistic struct {
 	Users int `json:"users"`
 }
 
+// HealthCheck is the outcome of a single readiness check.
+type HealthCheck struct {
+	// Status is "ok" or "fail".
+	Status string `json:"status"`
+	// Detail describes the checked value or the reason of the failure.
+	Detail string `json:"detail,omitempty"`
+}
+
+// Readiness is the JSON body of the readiness endpoint.
+type Readiness struct {
+	// Status is "ok" when every check passed and "fail" otherwise.
+	Status string `json:"status"`
+	// Checks holds the individual checks by name.
+	Checks map[string]HealthCheck `json:"checks"`
+}
+
+// Stable error codes of Problem responses. Clients may rely on them, so
+// existing codes must not change their meaning.
+const (
+	// CodeInvalidRequest means the request body or parameters could not be parsed.
+	CodeInvalidRequest = "invalid_request"
+	// CodeInvalidURL means the URL to shorten was rejected by validation.
+	CodeInvalidURL = "invalid_url"
+	// CodeBodyTooLarge means the request body exceeds the size limit of the route.
+	CodeBodyTooLarge = "body_too_large"
+	// CodeUnauthorized means the request carries no valid authentication cookie.
+	CodeUnauthorized = "unauthorized"
+	// CodeForbidden means the client is not allowed to use the endpoint.
+	CodeForbidden = "forbidden"
+	// CodeNotFound means the short URL does not exist.
+	CodeNotFound = "not_found"
+	// CodeURLDeleted means the short URL has been deleted by its owner.
+	CodeURLDeleted = "url_deleted"
+	// CodeClicksExhausted means the short URL has been followed as many times
+	// as its owner allowed.
+	CodeClicksExhausted = "clicks_exhausted"
+	// CodeNotYetActive means the short URL is scheduled to go live later, at
+	// the time given in the Retry-After header.
+	CodeNotYetActive = "not_yet_active"
+	// CodeURLExpired means the expiry time of the short URL has passed.
+	CodeURLExpired = "url_expired"
+	// CodeOptionsConflict means the URL has already been shortened, so the
+	// link options of the request cannot be applied.
+	CodeOptionsConflict = "options_conflict"
+	// CodeDestinationBlocked means the destination is rejected by the policy.
+	CodeDestinationBlocked = "destination_blocked"
+	// CodeDestinationPrivate means the destination is a private, loopback or
+	// link-local address.
+	CodeDestinationPrivate = "destination_private"
+	// CodeStorageUnavailable means the storage could not be reached.
+	CodeStorageUnavailable = "storage_unavailable"
+	// CodeOverloaded means the request was rejected to shed load and may be retried later.
+	CodeOverloaded = "overloaded"
+	// CodeRateLimited means the client sent too many requests and must wait
+	// for the time given in the Retry-After header.
+	CodeRateLimited = "rate_limited"
+	// CodeInternal means an unexpected server-side failure.
+	CodeInternal = "internal_error"
+)
+
+// Problem is an RFC 9457 problem details body, sent as application/problem+json
+// with every error response.
+type Problem struct {
+	// Type identifies the problem type. It is always "about:blank", so Title is
+	// the standard text of Status.
+	Type string `json:"type"`
+	// Title is a short summary of the problem.
+	Title string `json:"title"`
+	// Status is the HTTP status code of the response.
+	Status int `json:"status"`
+	// Code is one of the stable error codes above.
+	Code string `json:"code"`
+	// Detail explains this occurrence of the problem.
+	Detail string `json:"detail,omitempty"`
+	// Instance is the path of the failed request.
+	Instance string `json:"instance,omitempty"`
+	// RequestID is the X-Request-ID of the failed request.
+	RequestID string `json:"request_id,omitempty"`
+}
+
 // NewProducer creates a new Producer for writing to the specified file.
 // The caller is responsible for calling Close() on the producer to release resources.
 func NewProducer(filename string) (*Producer, error) {
@@ -0,0 +1,13 @@
+/*
+Package policy decides which destinations may be shortened and redirected to,
+so the service cannot be used to mask phishing sites or to reach internal hosts.
+
+An `Engine` holds allow and deny rules for domains and IP ranges, loaded from a
+local file and reloaded when the file changes (see `Engine.Run`). It can also
+resolve host names and refuse destinations on private, loopback or link-local
+addresses. `Engine.Check` is consulted when a URL is shortened;
+`Engine.CheckRedirect` re-checks the rules on every redirect, so links blocked
+after they were created stop working.
+*/
+
+package policy
@@ -0,0 +1,319 @@
+package policy
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+var (
+	// ErrBlocked is returned for destinations matching a deny rule or missing
+	// from a non-empty allowlist.
+	ErrBlocked = errors.New("destination is blocked")
+	// ErrPrivate is returned for destinations on private, loopback or
+	// link-local addresses when such destinations are refused.
+	ErrPrivate = errors.New("destination is a private address")
+	// ErrUnresolvable is returned when the destination host cannot be resolved.
+	ErrUnresolvable = errors.New("destination host cannot be resolved")
+)
+
+// resolveTimeout bounds the DNS lookup of a destination.
+const resolveTimeout = 2 * time.Second
+
+// cgnat is the shared address space of carrier-grade NAT, which netip does
+// not count as private.
+var cgnat = netip.MustParsePrefix("100.64.0.0/10")
+
+// Resolver looks up the addresses of a host. *net.Resolver implements it.
+type Resolver interface {
+	LookupNetIP(ctx context.Context, network string, host string) ([]netip.Addr, error)
+}
+
+// Engine checks destinations against the rules of a policy file. A nil
+// *Engine allows every destination.
+type Engine struct {
+	// BlockPrivate refuses destinations on private, loopback and link-local
+	// addresses, resolving host names to find them.
+	BlockPrivate bool
+	// Resolver resolves host names when BlockPrivate is set.
+	Resolver Resolver
+
+	path    string
+	rules   atomic.Pointer[rules]
+	mu      sync.Mutex
+	modTime time.Time
+}
+
+// rules is an immutable set of rules parsed from a policy file.
+type rules struct {
+	denyDomains    []string
+	allowDomains   []string
+	denyPrefixes   []netip.Prefix
+	allowPrefixes  []netip.Prefix
+	hasAllowFilter bool
+}
+
+// New creates an engine with the rules of the policy file at path. An empty
+// path means no rules.
+func New(path string, blockPrivate bool) (*Engine, error) {
+	e := &Engine{BlockPrivate: blockPrivate, Resolver: net.DefaultResolver, path: path}
+	e.rules.Store(&rules{})
+	if len(path) > 0 {
+		if err := e.Reload(); err != nil {
+			return nil, err
+		}
+	}
+	return e, nil
+}
+
+// Check reports whether rawURL may be shortened. It returns an error wrapping
+// ErrBlocked if a rule rejects the host or one of its addresses, and, if
+// BlockPrivate is set, ErrPrivate if the host resolves to a private address or
+// ErrUnresolvable if it does not resolve at all.
+func (e *Engine) Check(ctx context.Context, rawURL string) error {
+	host, err := hostOf(rawURL)
+	if err != nil || e == nil {
+		return err
+	}
+	if err = e.checkHost(host); err != nil {
+		return err
+	}
+	if !e.BlockPrivate {
+		return nil
+	}
+	if _, err = netip.ParseAddr(host); err == nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, resolveTimeout)
+	defer cancel()
+	addrs, err := e.Resolver.LookupNetIP(ctx, "ip", host)
+	if err != nil || len(addrs) == 0 {
+		return fmt.Errorf("%w: %s", ErrUnresolvable, host)
+	}
+	r := e.rules.Load()
+	for _, addr := range addrs {
+		if err = r.checkAddr(host, addr.Unmap(), e.BlockPrivate, false); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CheckRedirect re-checks the destination of a redirect. It applies the rules
+// to the host and refuses private IP literals, but does not resolve host
+// names, so redirects never wait for DNS.
+func (e *Engine) CheckRedirect(rawURL string) error {
+	host, err := hostOf(rawURL)
+	if err != nil || e == nil {
+		return err
+	}
+	return e.checkHost(host)
+}
+
+// checkHost applies the rules to host, and the private address check to IP literals.
+func (e *Engine) checkHost(host string) error {
+	r := e.rules.Load()
+	if addr, err := netip.ParseAddr(host); err == nil {
+		return r.checkAddr(host, addr.Unmap(), e.BlockPrivate, true)
+	}
+	for _, domain := range r.denyDomains {
+		if matchDomain(host, domain) {
+			return fmt.Errorf("%w: %s matches %s", ErrBlocked, host, domain)
+		}
+	}
+	if !r.hasAllowFilter {
+		return nil
+	}
+	for _, domain := range r.allowDomains {
+		if matchDomain(host, domain) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s is not allowed", ErrBlocked, host)
+}
+
+// checkAddr applies the IP rules and, if blockPrivate is set, the private
+// address check to addr, an address of host. The allowlist of IP ranges only
+// applies to IP literals; resolved host names are allowlisted by domain.
+func (r *rules) checkAddr(host string, addr netip.Addr, blockPrivate bool, literal bool) error {
+	for _, prefix := range r.denyPrefixes {
+		if prefix.Contains(addr) {
+			return fmt.Errorf("%w: %s (%s) matches %s", ErrBlocked, host, addr, prefix)
+		}
+	}
+	if blockPrivate && isPrivate(addr) {
+		return fmt.Errorf("%w: %s (%s)", ErrPrivate, host, addr)
+	}
+	if !r.hasAllowFilter || !literal {
+		return nil
+	}
+	for _, prefix := range r.allowPrefixes {
+		if prefix.Contains(addr) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s is not allowed", ErrBlocked, host)
+}
+
+// Reload reads the policy file again and replaces the rules. On error the
+// previous rules stay in effect.
+func (e *Engine) Reload() error {
+	info, err := os.Stat(e.path)
+	if err != nil {
+		return err
+	}
+	r, err := parseFile(e.path)
+	if err != nil {
+		return err
+	}
+	e.rules.Store(r)
+	e.mu.Lock()
+	e.modTime = info.ModTime()
+	e.mu.Unlock()
+	return nil
+}
+
+// Run reloads the policy file every interval if it has been modified. It
+// blocks until ctx is cancelled, so it is meant to be run in its own goroutine.
+// It returns immediately if there is no policy file or interval is not positive.
+func (e *Engine) Run(ctx context.Context, interval time.Duration) {
+	if e == nil || len(e.path) == 0 || interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		info, err := os.Stat(e.path)
+		if err != nil {
+			zap.L().Warn("policy file unavailable, keeping the current rules", zap.String("path", e.path), zap.Error(err))
+			continue
+		}
+		e.mu.Lock()
+		modified := !info.ModTime().Equal(e.modTime)
+		e.mu.Unlock()
+		if !modified {
+			continue
+		}
+		if err = e.Reload(); err != nil {
+			zap.L().Error("policy reload failed, keeping the current rules", zap.String("path", e.path), zap.Error(err))
+			continue
+		}
+		zap.L().Info("policy reloaded", zap.String("path", e.path))
+	}
+}
+
+// parseFile parses a policy file. Every non-empty line that is not a "#"
+// comment holds a rule: a domain, an IP address or a CIDR range, optionally
+// preceded by "deny" (the default) or "allow". A domain also matches its
+// subdomains; "*.example.com" matches the subdomains only. Once any allow
+// rule is present, destinations not matching one are blocked. Deny rules take
+// precedence over allow rules.
+func parseFile(path string) (*rules, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	r := &rules{}
+	scanner := bufio.NewScanner(file)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		allow := false
+		if len(fields) == 2 && (fields[0] == "allow" || fields[0] == "deny") {
+			allow = fields[0] == "allow"
+			fields = fields[1:]
+		}
+		if len(fields) != 1 || fields[0] == "allow" || fields[0] == "deny" {
+			return nil, fmt.Errorf("%s:%d: invalid rule %q", path, lineNo, line)
+		}
+		if err = r.add(fields[0], allow); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, lineNo, err)
+		}
+	}
+	return r, scanner.Err()
+}
+
+// add adds a single domain, address or range rule.
+func (r *rules) add(pattern string, allow bool) error {
+	if allow {
+		r.hasAllowFilter = true
+	}
+	if strings.Contains(pattern, "/") {
+		prefix, err := netip.ParsePrefix(pattern)
+		if err != nil {
+			return err
+		}
+		r.addPrefix(prefix.Masked(), allow)
+		return nil
+	}
+	if addr, err := netip.ParseAddr(pattern); err == nil {
+		r.addPrefix(netip.PrefixFrom(addr, addr.BitLen()), allow)
+		return nil
+	}
+	domain := strings.TrimSuffix(strings.ToLower(pattern), ".")
+	if name := strings.TrimPrefix(domain, "*."); len(name) == 0 || strings.ContainsAny(name, "*:") {
+		return fmt.Errorf("invalid domain %q", pattern)
+	}
+	if allow {
+		r.allowDomains = append(r.allowDomains, domain)
+	} else {
+		r.denyDomains = append(r.denyDomains, domain)
+	}
+	return nil
+}
+
+// addPrefix adds an IP range rule.
+func (r *rules) addPrefix(prefix netip.Prefix, allow bool) {
+	if allow {
+		r.allowPrefixes = append(r.allowPrefixes, prefix)
+	} else {
+		r.denyPrefixes = append(r.denyPrefixes, prefix)
+	}
+}
+
+// matchDomain reports whether host is domain or one of its subdomains. A
+// domain of the form "*.example.com" matches the subdomains only.
+func matchDomain(host string, domain string) bool {
+	if parent, ok := strings.CutPrefix(domain, "*."); ok {
+		return strings.HasSuffix(host, "."+parent)
+	}
+	return host == domain || strings.HasSuffix(host, "."+domain)
+}
+
+// isPrivate reports whether addr is not publicly routable.
+func isPrivate(addr netip.Addr) bool {
+	return addr.IsPrivate() || addr.IsLoopback() || addr.IsLinkLocalUnicast() ||
+		addr.IsLinkLocalMulticast() || addr.IsInterfaceLocalMulticast() ||
+		addr.IsUnspecified() || cgnat.Contains(addr)
+}
+
+// hostOf returns the lower-cased host of rawURL without a trailing dot.
+func hostOf(rawURL string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(strings.ToLower(u.Hostname()), "."), nil
+}
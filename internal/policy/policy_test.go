@@ -0,0 +1,144 @@
+package policy
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeResolver resolves host names from a map.
+type fakeResolver map[string][]netip.Addr
+
+func (r fakeResolver) LookupNetIP(ctx context.Context, network string, host string) ([]netip.Addr, error) {
+	addrs, ok := r[host]
+	if !ok {
+		return nil, errors.New("no such host")
+	}
+	return addrs, nil
+}
+
+func writePolicy(t *testing.T, path string, content string) {
+	t.Helper()
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+}
+
+func TestEngineCheck(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.txt")
+	writePolicy(t, path, `# phishing
+evil.example
+deny *.phish.example
+203.0.113.0/24
+`)
+	e, err := New(path, true)
+	require.NoError(t, err)
+	e.Resolver = fakeResolver{
+		"example.com":       {netip.MustParseAddr("93.184.216.34")},
+		"intranet.example":  {netip.MustParseAddr("10.1.2.3")},
+		"mapped.example":    {netip.MustParseAddr("::ffff:127.0.0.1")},
+		"phish.example":     {netip.MustParseAddr("93.184.216.35")},
+		"hosted.example":    {netip.MustParseAddr("203.0.113.7")},
+		"cgnat.example":     {netip.MustParseAddr("100.64.1.1")},
+		"sub.evil.example":  {netip.MustParseAddr("93.184.216.36")},
+		"notevil.example":   {netip.MustParseAddr("93.184.216.37")},
+		"ipv6-only.example": {netip.MustParseAddr("2001:db8::1")},
+	}
+
+	tests := []struct {
+		rawURL string
+		want   error
+	}{
+		{rawURL: "https://example.com/a"},
+		{rawURL: "https://EVIL.example./login", want: ErrBlocked},
+		{rawURL: "https://sub.evil.example/", want: ErrBlocked},
+		{rawURL: "https://notevil.example/"},
+		{rawURL: "https://phish.example/"},
+		{rawURL: "https://a.phish.example/", want: ErrBlocked},
+		{rawURL: "https://hosted.example/", want: ErrBlocked},
+		{rawURL: "http://203.0.113.1/", want: ErrBlocked},
+		{rawURL: "http://intranet.example/", want: ErrPrivate},
+		{rawURL: "http://mapped.example/", want: ErrPrivate},
+		{rawURL: "http://cgnat.example/", want: ErrPrivate},
+		{rawURL: "http://127.0.0.1:8080/", want: ErrPrivate},
+		{rawURL: "http://[::1]/", want: ErrPrivate},
+		{rawURL: "http://169.254.169.254/latest/meta-data", want: ErrPrivate},
+		{rawURL: "http://ipv6-only.example/"},
+		{rawURL: "http://unknown.example/", want: ErrUnresolvable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.rawURL, func(t *testing.T) {
+			err := e.Check(context.Background(), tt.rawURL)
+			if tt.want == nil {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, tt.want)
+			}
+		})
+	}
+
+	assert.NoError(t, e.CheckRedirect("http://intranet.example/"), "redirects do not resolve host names")
+	assert.ErrorIs(t, e.CheckRedirect("http://10.0.0.1/"), ErrPrivate)
+	assert.ErrorIs(t, e.CheckRedirect("https://evil.example/"), ErrBlocked)
+}
+
+func TestEngineAllowlist(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.txt")
+	writePolicy(t, path, `allow example.com
+allow 192.0.2.0/24
+deny bad.example.com
+`)
+	e, err := New(path, false)
+	require.NoError(t, err)
+
+	assert.NoError(t, e.CheckRedirect("https://example.com/"))
+	assert.NoError(t, e.CheckRedirect("https://www.example.com/"))
+	assert.NoError(t, e.CheckRedirect("http://192.0.2.10/"))
+	assert.ErrorIs(t, e.CheckRedirect("https://bad.example.com/"), ErrBlocked, "deny rules take precedence")
+	assert.ErrorIs(t, e.CheckRedirect("https://example.org/"), ErrBlocked)
+	assert.ErrorIs(t, e.CheckRedirect("http://198.51.100.1/"), ErrBlocked)
+	assert.ErrorIs(t, e.CheckRedirect("http://[::ffff:198.51.100.1]/"), ErrBlocked)
+}
+
+func TestEngineReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.txt")
+	writePolicy(t, path, "old.example\n")
+	e, err := New(path, false)
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go e.Run(ctx, 5*time.Millisecond)
+
+	assert.ErrorIs(t, e.CheckRedirect("https://old.example/"), ErrBlocked)
+	writePolicy(t, path, "new.example\n")
+	require.NoError(t, os.Chtimes(path, time.Now(), time.Now().Add(time.Second)))
+	require.Eventually(t, func() bool {
+		return e.CheckRedirect("https://new.example/") != nil
+	}, time.Second, 5*time.Millisecond)
+	assert.NoError(t, e.CheckRedirect("https://old.example/"))
+
+	writePolicy(t, path, "allow\n")
+	require.NoError(t, os.Chtimes(path, time.Now(), time.Now().Add(2*time.Second)))
+	time.Sleep(30 * time.Millisecond)
+	assert.ErrorIs(t, e.CheckRedirect("https://new.example/"), ErrBlocked, "an invalid file keeps the current rules")
+}
+
+func TestNilEngine(t *testing.T) {
+	var e *Engine
+	assert.NoError(t, e.Check(context.Background(), "http://127.0.0.1/"))
+	assert.NoError(t, e.CheckRedirect("http://127.0.0.1/"))
+}
+
+func TestParseFileErrors(t *testing.T) {
+	for _, content := range []string{"allow\n", "deny a b\n", "10.0.0.0/33\n", "*.\n"} {
+		path := filepath.Join(t.TempDir(), "policy.txt")
+		writePolicy(t, path, content)
+		_, err := New(path, false)
+		assert.Error(t, err, content)
+	}
+}
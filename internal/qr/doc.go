@@ -0,0 +1,9 @@
+/*
+Package qr renders QR codes of short links as PNG and SVG images.
+
+The codes are encoded in-process with github.com/skip2/go-qrcode, so printing
+a link never depends on an external service. `Options` select the image size,
+the error correction level and the width of the quiet zone around the code.
+*/
+
+package qr
@@ -0,0 +1,163 @@
+package qr
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"strconv"
+	"strings"
+
+	qrcode "github.com/skip2/go-qrcode"
+)
+
+// Limits and defaults of Options.
+const (
+	DefaultSize   = 256
+	MinSize       = 64
+	MaxSize       = 2048
+	DefaultLevel  = "M"
+	DefaultMargin = 4
+	MaxMargin     = 16
+)
+
+// levels maps the error correction levels to the recovery levels of go-qrcode.
+// Higher levels survive more damage at the cost of denser codes.
+var levels = map[string]qrcode.RecoveryLevel{
+	"L": qrcode.Low,
+	"M": qrcode.Medium,
+	"Q": qrcode.High,
+	"H": qrcode.Highest,
+}
+
+// Options configure the rendered image. Zero values select the defaults,
+// except for Margin, where zero means no quiet zone.
+type Options struct {
+	// Size is the width and height of the image in pixels.
+	Size int
+	// Level is the error correction level: "L", "M", "Q" or "H".
+	Level string
+	// Margin is the width of the quiet zone around the code in modules.
+	Margin int
+}
+
+// DefaultOptions returns the options used when a client does not choose any.
+func DefaultOptions() Options {
+	return Options{Size: DefaultSize, Level: DefaultLevel, Margin: DefaultMargin}
+}
+
+// Validate checks that the options are within the limits above.
+func (o Options) Validate() error {
+	if o.Size != 0 && (o.Size < MinSize || o.Size > MaxSize) {
+		return fmt.Errorf("size must be between %d and %d pixels", MinSize, MaxSize)
+	}
+	if _, ok := levels[strings.ToUpper(o.Level)]; !ok && len(o.Level) > 0 {
+		return fmt.Errorf("level %q is not one of L, M, Q, H", o.Level)
+	}
+	if o.Margin < 0 || o.Margin > MaxMargin {
+		return fmt.Errorf("margin must be between 0 and %d modules", MaxMargin)
+	}
+	return nil
+}
+
+// PNG renders content as a PNG image of Size×Size pixels. Every module is an
+// equal square of whole pixels; the code is centered and the pixels left over
+// are added to the quiet zone.
+func PNG(content string, opts Options) ([]byte, error) {
+	modules, size, err := encode(content, opts)
+	if err != nil {
+		return nil, err
+	}
+	scale := size / len(modules)
+	if scale == 0 {
+		return nil, fmt.Errorf("size %d is too small for %d modules", size, len(modules))
+	}
+	offset := (size - scale*len(modules)) / 2
+
+	img := image.NewPaletted(image.Rect(0, 0, size, size), color.Palette{color.White, color.Black})
+	for y, row := range modules {
+		for x, dark := range row {
+			if !dark {
+				continue
+			}
+			for py := 0; py < scale; py++ {
+				for px := 0; px < scale; px++ {
+					img.SetColorIndex(offset+x*scale+px, offset+y*scale+py, 1)
+				}
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	if err = png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// SVG renders content as an SVG image of Size×Size pixels. The dark modules
+// are drawn as one path of horizontal runs, so the image scales without
+// blurring.
+func SVG(content string, opts Options) ([]byte, error) {
+	modules, size, err := encode(content, opts)
+	if err != nil {
+		return nil, err
+	}
+	n := strconv.Itoa(len(modules))
+
+	var buf bytes.Buffer
+	buf.WriteString(`<?xml version="1.0" encoding="UTF-8"?>` + "\n")
+	fmt.Fprintf(&buf, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %s %s" shape-rendering="crispEdges">`, size, size, n, n)
+	fmt.Fprintf(&buf, `<rect width="%s" height="%s" fill="#fff"/><path fill="#000" d="`, n, n)
+	for y, row := range modules {
+		for x := 0; x < len(row); {
+			if !row[x] {
+				x++
+				continue
+			}
+			run := 1
+			for x+run < len(row) && row[x+run] {
+				run++
+			}
+			fmt.Fprintf(&buf, "M%d %dh%dv1h-%dz", x, y, run, run)
+			x += run
+		}
+	}
+	buf.WriteString(`"/></svg>` + "\n")
+	return buf.Bytes(), nil
+}
+
+// encode returns the modules of the QR code of content including the quiet
+// zone, true meaning dark, and the image size in pixels.
+func encode(content string, opts Options) ([][]bool, int, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, 0, err
+	}
+	level, ok := levels[strings.ToUpper(opts.Level)]
+	if !ok {
+		level = levels[DefaultLevel]
+	}
+	size := opts.Size
+	if size == 0 {
+		size = DefaultSize
+	}
+
+	code, err := qrcode.New(content, level)
+	if err != nil {
+		return nil, 0, err
+	}
+	code.DisableBorder = true
+	bitmap := code.Bitmap()
+
+	n := len(bitmap) + 2*opts.Margin
+	modules := make([][]bool, n)
+	for y := range modules {
+		modules[y] = make([]bool, n)
+		if y < opts.Margin || y >= opts.Margin+len(bitmap) {
+			continue
+		}
+		copy(modules[y][opts.Margin:], bitmap[y-opts.Margin])
+	}
+	return modules, size, nil
+}
@@ -0,0 +1,72 @@
+package qr
+
+import (
+	"bytes"
+	"image/png"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const content = "http://localhost:8080/pkmdI_i-nYcS6P7hSfjTtWUmfcA="
+
+func TestPNG(t *testing.T) {
+	data, err := PNG(content, DefaultOptions())
+	require.NoError(t, err)
+	img, err := png.Decode(bytes.NewReader(data))
+	require.NoError(t, err)
+	assert.Equal(t, DefaultSize, img.Bounds().Dx())
+	assert.Equal(t, DefaultSize, img.Bounds().Dy())
+	r, g, b, _ := img.At(0, 0).RGBA()
+	assert.Equal(t, [3]uint32{0xffff, 0xffff, 0xffff}, [3]uint32{r, g, b}, "the quiet zone is white")
+
+	data, err = PNG(content, Options{Size: 100, Level: "h"})
+	require.NoError(t, err)
+	img, err = png.Decode(bytes.NewReader(data))
+	require.NoError(t, err)
+	assert.Equal(t, 100, img.Bounds().Dx())
+	dark := false
+	for x := 0; x < 20 && !dark; x++ {
+		r, _, _, _ = img.At(x, x).RGBA()
+		dark = r == 0
+	}
+	assert.True(t, dark, "without a margin the finder pattern is next to the corner")
+}
+
+func TestSVG(t *testing.T) {
+	data, err := SVG(content, Options{Size: 512, Level: "Q", Margin: 2})
+	require.NoError(t, err)
+	svg := string(data)
+	assert.True(t, strings.HasPrefix(svg, "<?xml"))
+	assert.Contains(t, svg, `width="512" height="512"`)
+	assert.Contains(t, svg, `<path fill="#000" d="M2 2h7v1h-7z`, "the finder pattern starts after the margin")
+}
+
+func TestOptions_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    Options
+		wantErr bool
+	}{
+		{name: "defaults", opts: DefaultOptions()},
+		{name: "zero value", opts: Options{}},
+		{name: "lower-case level", opts: Options{Level: "q"}},
+		{name: "too small", opts: Options{Size: MinSize - 1}, wantErr: true},
+		{name: "too large", opts: Options{Size: MaxSize + 1}, wantErr: true},
+		{name: "unknown level", opts: Options{Level: "X"}, wantErr: true},
+		{name: "negative margin", opts: Options{Margin: -1}, wantErr: true},
+		{name: "margin too wide", opts: Options{Margin: MaxMargin + 1}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.opts.Validate()
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
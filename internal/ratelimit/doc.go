@@ -0,0 +1,11 @@
+/*
+Package ratelimit implements keyed token-bucket rate limiting.
+
+A `Limiter` keeps one `rate.Limiter` bucket per key, such as a user ID or a
+client IP, and forgets buckets that have been idle long enough to be full
+again. `Limiter.Take` consumes a token from several buckets at once, so a
+request can be limited both per user and per IP; the HTTP side lives in
+`middleware.WithRateLimit`.
+*/
+
+package ratelimit
@@ -0,0 +1,122 @@
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// Limiter is a set of token buckets sharing the same rate and burst, one per key.
+type Limiter struct {
+	limit rate.Limit
+	burst int
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastPrune time.Time
+}
+
+// bucket is the token bucket of a single key.
+type bucket struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// Result is the outcome of Limiter.Take.
+type Result struct {
+	// Allowed reports whether a token was taken from every bucket.
+	Allowed bool
+	// Limit is the bucket size, the number of requests allowed in a burst.
+	Limit int
+	// Remaining is the number of tokens left in the emptiest bucket.
+	Remaining int
+	// RetryAfter is how long to wait before the request may be retried. It is
+	// zero if the request was allowed.
+	RetryAfter time.Duration
+	// Reset is how long it takes until the emptiest bucket is full again.
+	Reset time.Duration
+}
+
+// New creates a limiter allowing perSecond requests per second per key, in
+// bursts of up to burst requests.
+func New(perSecond float64, burst int) *Limiter {
+	return &Limiter{
+		limit:     rate.Limit(perSecond),
+		burst:     max(burst, 1),
+		buckets:   make(map[string]*bucket),
+		lastPrune: time.Now(),
+	}
+}
+
+// Take takes a token from the bucket of every non-empty key. If any bucket is
+// empty, no token is taken from the others either and the result is not allowed.
+func (l *Limiter) Take(keys ...string) Result {
+	now := time.Now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.prune(now)
+
+	res := Result{Allowed: true, Limit: l.burst, Remaining: l.burst}
+	reservations := make([]*rate.Reservation, 0, len(keys))
+	var emptiest *rate.Limiter
+	for _, key := range keys {
+		if len(key) == 0 {
+			continue
+		}
+		b, ok := l.buckets[key]
+		if !ok {
+			b = &bucket{limiter: rate.NewLimiter(l.limit, l.burst)}
+			l.buckets[key] = b
+		}
+		b.lastSeen = now
+
+		r := b.limiter.ReserveN(now, 1)
+		reservations = append(reservations, r)
+		if delay := r.DelayFrom(now); delay > 0 {
+			res.Allowed = false
+			res.RetryAfter = max(res.RetryAfter, delay)
+		}
+		if remaining := int(math.Floor(b.limiter.TokensAt(now))); emptiest == nil || remaining < res.Remaining {
+			emptiest = b.limiter
+			res.Remaining = max(remaining, 0)
+		}
+	}
+
+	if !res.Allowed {
+		for _, r := range reservations {
+			r.CancelAt(now)
+		}
+		if emptiest != nil {
+			res.Remaining = max(int(math.Floor(emptiest.TokensAt(now))), 0)
+		}
+	}
+	if emptiest != nil {
+		res.Reset = l.refillTime(l.burst - res.Remaining)
+	}
+	return res
+}
+
+// refillTime returns how long it takes to add the given number of tokens.
+func (l *Limiter) refillTime(tokens int) time.Duration {
+	if tokens <= 0 || l.limit <= 0 {
+		return 0
+	}
+	return time.Duration(float64(tokens) / float64(l.limit) * float64(time.Second))
+}
+
+// prune forgets the buckets that are full again, since a new bucket behaves
+// the same. It runs at most once per refill period. The caller must hold l.mu.
+func (l *Limiter) prune(now time.Time) {
+	idle := l.refillTime(l.burst)
+	if idle <= 0 || now.Sub(l.lastPrune) < idle {
+		return
+	}
+	for key, b := range l.buckets {
+		if now.Sub(b.lastSeen) >= idle {
+			delete(l.buckets, key)
+		}
+	}
+	l.lastPrune = now
+}
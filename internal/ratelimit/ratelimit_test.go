@@ -0,0 +1,54 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLimiterTake(t *testing.T) {
+	l := New(1, 2)
+
+	res := l.Take("ip:1", "user:a")
+	assert.True(t, res.Allowed)
+	assert.Equal(t, 2, res.Limit)
+	assert.Equal(t, 1, res.Remaining)
+	assert.Equal(t, time.Duration(0), res.RetryAfter)
+
+	res = l.Take("ip:1", "user:a")
+	assert.True(t, res.Allowed)
+	assert.Equal(t, 0, res.Remaining)
+
+	res = l.Take("ip:1", "user:a")
+	assert.False(t, res.Allowed)
+	assert.Equal(t, 0, res.Remaining)
+	assert.InDelta(t, time.Second, res.RetryAfter, float64(50*time.Millisecond))
+	assert.InDelta(t, 2*time.Second, res.Reset, float64(50*time.Millisecond))
+
+	// The same user from another IP is still limited by the user bucket, and a
+	// rejected request does not consume the fresh IP bucket.
+	res = l.Take("ip:2", "user:a")
+	assert.False(t, res.Allowed)
+	res = l.Take("ip:2")
+	assert.True(t, res.Allowed)
+	assert.Equal(t, 1, res.Remaining)
+
+	// Empty keys are ignored.
+	res = l.Take("", "user:b")
+	assert.True(t, res.Allowed)
+	assert.Len(t, l.buckets, 4)
+}
+
+func TestLimiterRefill(t *testing.T) {
+	l := New(100, 1)
+
+	assert.True(t, l.Take("ip:1").Allowed)
+	assert.False(t, l.Take("ip:1").Allowed)
+	time.Sleep(15 * time.Millisecond)
+	assert.True(t, l.Take("ip:1").Allowed)
+
+	time.Sleep(15 * time.Millisecond)
+	l.Take("ip:2")
+	assert.NotContains(t, l.buckets, "ip:1", "idle full buckets must be forgotten")
+}
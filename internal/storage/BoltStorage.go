@@ -0,0 +1,311 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/scaranin/go-svc-short-url/internal/models"
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	// linksBucket maps a short URL identifier to the JSON-encoded models.URL record.
+	linksBucket = []byte("links")
+	// usersBucket holds one nested bucket per user, keyed by the short URLs the user owns.
+	usersBucket = []byte("users")
+	// deletionsBucket maps a deleted short URL identifier to the RFC 3339 time of deletion.
+	deletionsBucket = []byte("deletions")
+)
+
+// BoltStorage provides an implementation of the models.Storage interface on top of
+// an embedded bbolt B-tree key-value database. It is intended for single-node
+// deployments that need durable, crash-safe storage without running PostgreSQL.
+type BoltStorage struct {
+	// Path is the location of the database file on disk.
+	Path string
+	// DB is the open bbolt database handle.
+	DB *bolt.DB
+}
+
+// Save implements the models.Storage interface. It stores the URL record in the
+// links bucket and registers the short URL in the owner's bucket, all within a
+// single read-write transaction. If the short URL already exists, it returns the
+// existing short URL and models.ErrConflict.
+func (bs BoltStorage) Save(ctx context.Context, URL *models.URL) (string, error) {
+	err := bs.DB.Update(func(tx *bolt.Tx) error {
+		links := tx.Bucket(linksBucket)
+		if links.Get([]byte(URL.ShortURL)) != nil {
+			return models.ErrConflict
+		}
+
+		data, err := json.Marshal(URL)
+		if err != nil {
+			return err
+		}
+		if err = links.Put([]byte(URL.ShortURL), data); err != nil {
+			return err
+		}
+
+		if len(URL.UserID) == 0 {
+			return nil
+		}
+		userBucket, err := tx.Bucket(usersBucket).CreateBucketIfNotExists([]byte(URL.UserID))
+		if err != nil {
+			return err
+		}
+		return userBucket.Put([]byte(URL.ShortURL), nil)
+	})
+	return URL.ShortURL, err
+}
+
+// Load implements the models.Storage interface. It returns an empty string if
+// the short URL is not found and models.ErrDeleted if it has been deleted.
+func (bs BoltStorage) Load(ctx context.Context, shortURL string) (string, error) {
+	URL, err := bs.LoadURL(ctx, shortURL)
+	return URL.OriginalURL, err
+}
+
+// LoadURL implements the models.Storage interface. It returns a zero record if
+// the short URL is not found.
+func (bs BoltStorage) LoadURL(ctx context.Context, shortURL string) (models.URL, error) {
+	var URL models.URL
+	err := bs.DB.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(linksBucket).Get([]byte(shortURL))
+		if data == nil {
+			return nil
+		}
+		return json.Unmarshal(data, &URL)
+	})
+	if err != nil {
+		return models.URL{}, err
+	}
+	return URL, linkState(URL)
+}
+
+// RecordClick implements the models.Storage interface. The click counts are
+// checked and incremented within a single read-write transaction.
+func (bs BoltStorage) RecordClick(ctx context.Context, shortURL string, variant string) error {
+	return bs.DB.Update(func(tx *bolt.Tx) error {
+		links := tx.Bucket(linksBucket)
+		data := links.Get([]byte(shortURL))
+		if data == nil {
+			return nil
+		}
+		var URL models.URL
+		if err := json.Unmarshal(data, &URL); err != nil {
+			return err
+		}
+		if URL.MaxClicks == 0 && len(variant) == 0 {
+			return nil
+		}
+		if err := linkState(URL); err != nil {
+			return err
+		}
+		countClick(&URL, variant)
+		data, err := json.Marshal(URL)
+		if err != nil {
+			return err
+		}
+		return links.Put([]byte(shortURL), data)
+	})
+}
+
+// UpdateVariants implements the models.Storage interface within a single
+// read-write transaction.
+func (bs BoltStorage) UpdateVariants(ctx context.Context, UserID string, shortURL string, variants []models.Variant) error {
+	return bs.DB.Update(func(tx *bolt.Tx) error {
+		links := tx.Bucket(linksBucket)
+		data := links.Get([]byte(shortURL))
+		if data == nil {
+			return models.ErrNotOwned
+		}
+		var URL models.URL
+		if err := json.Unmarshal(data, &URL); err != nil {
+			return err
+		}
+		if URL.UserID != UserID || URL.IsDeleted {
+			return models.ErrNotOwned
+		}
+		URL.Variants = variants
+		data, err := json.Marshal(URL)
+		if err != nil {
+			return err
+		}
+		return links.Put([]byte(shortURL), data)
+	})
+}
+
+// GetUserURLList implements the models.Storage interface. It walks the user's
+// bucket and returns every non-deleted URL owned by UserID.
+func (bs BoltStorage) GetUserURLList(ctx context.Context, UserID string) ([]models.URLUserList, error) {
+	var URLList []models.URLUserList
+	err := bs.DB.View(func(tx *bolt.Tx) error {
+		userBucket := tx.Bucket(usersBucket).Bucket([]byte(UserID))
+		if userBucket == nil {
+			return nil
+		}
+		links := tx.Bucket(linksBucket)
+		return userBucket.ForEach(func(k, _ []byte) error {
+			data := links.Get(k)
+			if data == nil {
+				return nil
+			}
+			var URL models.URL
+			if err := json.Unmarshal(data, &URL); err != nil {
+				return err
+			}
+			if URL.IsDeleted || URL.UserID != UserID {
+				return nil
+			}
+			URLList = append(URLList, models.URLUserList{ShortURL: URL.ShortURL, OriginalURL: URL.OriginalURL})
+			return nil
+		})
+	})
+	return URLList, err
+}
+
+// DeleteBulk implements the models.Storage interface. It soft-deletes the given
+// short URLs owned by UserID and records the time of deletion in the deletions
+// bucket. URLs that do not exist or belong to another user are skipped. The whole
+// batch is applied in a single transaction.
+func (bs BoltStorage) DeleteBulk(ctx context.Context, UserID string, ShortURLs []string) error {
+	deletedAt := []byte(time.Now().UTC().Format(time.RFC3339))
+	return bs.DB.Update(func(tx *bolt.Tx) error {
+		links := tx.Bucket(linksBucket)
+		deletions := tx.Bucket(deletionsBucket)
+		for _, ShortURL := range ShortURLs {
+			data := links.Get([]byte(ShortURL))
+			if data == nil {
+				continue
+			}
+			var URL models.URL
+			if err := json.Unmarshal(data, &URL); err != nil {
+				return err
+			}
+			if URL.UserID != UserID || URL.IsDeleted {
+				continue
+			}
+			URL.IsDeleted = true
+			data, err := json.Marshal(URL)
+			if err != nil {
+				return err
+			}
+			if err = links.Put([]byte(ShortURL), data); err != nil {
+				return err
+			}
+			if err = deletions.Put([]byte(ShortURL), deletedAt); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// GetStats implements the models.Storage interface. It returns the number of
+// stored short URLs and the number of users that own at least one of them.
+func (bs BoltStorage) GetStats(ctx context.Context) (models.Statistic, error) {
+	var stat models.Statistic
+	err := bs.DB.View(func(tx *bolt.Tx) error {
+		stat.URLs = tx.Bucket(linksBucket).Stats().KeyN
+		return tx.Bucket(usersBucket).ForEach(func(_, v []byte) error {
+			// Nested buckets are reported with a nil value.
+			if v == nil {
+				stat.Users++
+			}
+			return nil
+		})
+	})
+	return stat, err
+}
+
+// ExportURLs implements the models.Exporter interface. It seeks a cursor past the
+// given short URL and returns up to limit records in key order.
+func (bs BoltStorage) ExportURLs(after string, limit int) ([]models.URL, error) {
+	var URLs []models.URL
+	err := bs.DB.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(linksBucket).Cursor()
+		k, v := c.Seek([]byte(after))
+		if k != nil && string(k) == after {
+			k, v = c.Next()
+		}
+		for ; k != nil && len(URLs) < limit; k, v = c.Next() {
+			var URL models.URL
+			if err := json.Unmarshal(v, &URL); err != nil {
+				return err
+			}
+			URLs = append(URLs, URL)
+		}
+		return nil
+	})
+	return URLs, err
+}
+
+// ImportURL implements the models.Importer interface. It overwrites the record,
+// registers it with its owner and records the deletion if the record is deleted.
+func (bs BoltStorage) ImportURL(URL *models.URL) error {
+	return bs.DB.Update(func(tx *bolt.Tx) error {
+		data, err := json.Marshal(URL)
+		if err != nil {
+			return err
+		}
+		if err = tx.Bucket(linksBucket).Put([]byte(URL.ShortURL), data); err != nil {
+			return err
+		}
+		if len(URL.UserID) > 0 {
+			userBucket, err := tx.Bucket(usersBucket).CreateBucketIfNotExists([]byte(URL.UserID))
+			if err != nil {
+				return err
+			}
+			if err = userBucket.Put([]byte(URL.ShortURL), nil); err != nil {
+				return err
+			}
+		}
+		deletions := tx.Bucket(deletionsBucket)
+		if !URL.IsDeleted {
+			return deletions.Delete([]byte(URL.ShortURL))
+		}
+		if deletions.Get([]byte(URL.ShortURL)) != nil {
+			return nil
+		}
+		return deletions.Put([]byte(URL.ShortURL), []byte(time.Now().UTC().Format(time.RFC3339)))
+	})
+}
+
+// Ping implements the models.Pinger interface. It fails once the database has been closed.
+func (bs BoltStorage) Ping(ctx context.Context) error {
+	return bs.DB.View(func(tx *bolt.Tx) error { return nil })
+}
+
+// CreateStoreBolt is a constructor that opens (or creates) the bbolt database at
+// boltStoragePath and makes sure the links, users and deletions buckets exist.
+func CreateStoreBolt(boltStoragePath string) (BoltStorage, error) {
+	bs := BoltStorage{Path: boltStoragePath}
+
+	db, err := bolt.Open(boltStoragePath, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return bs, err
+	}
+	bs.DB = db
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{linksBucket, usersBucket, deletionsBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return bs, err
+	}
+	return bs, nil
+}
+
+// Close releases the file lock and closes the underlying bbolt database.
+func (bs *BoltStorage) Close() {
+	if bs.DB != nil {
+		bs.DB.Close()
+	}
+}
@@ -0,0 +1,175 @@
+package storage
+
+import (
+	"context"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/scaranin/go-svc-short-url/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newBoltStorage opens a BoltStorage in a temporary directory holding the
+// records a and b owned by u1 and c owned by u2.
+func newBoltStorage(t *testing.T) BoltStorage {
+	t.Helper()
+	bs, err := CreateStoreBolt(filepath.Join(t.TempDir(), "links.db"))
+	require.NoError(t, err)
+	t.Cleanup(bs.Close)
+	for _, URL := range []models.URL{
+		{ShortURL: "a", OriginalURL: "https://a.example", UserID: "u1"},
+		{ShortURL: "b", OriginalURL: "https://b.example", UserID: "u1"},
+		{ShortURL: "c", OriginalURL: "https://c.example", UserID: "u2"},
+	} {
+		_, err := bs.Save(context.Background(), &URL)
+		require.NoError(t, err)
+	}
+	return bs
+}
+
+func TestBoltStorage_SaveLoad(t *testing.T) {
+	tests := []struct {
+		name     string
+		URL      models.URL
+		wantErr  error
+		shortURL string
+		want     string
+	}{
+		{
+			name:     "new URL",
+			URL:      models.URL{ShortURL: "d", OriginalURL: "https://d.example", UserID: "u1"},
+			shortURL: "d",
+			want:     "https://d.example",
+		},
+		{
+			name:     "new URL without owner",
+			URL:      models.URL{ShortURL: "e", OriginalURL: "https://e.example"},
+			shortURL: "e",
+			want:     "https://e.example",
+		},
+		{
+			name:     "conflict keeps the existing record",
+			URL:      models.URL{ShortURL: "a", OriginalURL: "https://other.example", UserID: "u2"},
+			wantErr:  models.ErrConflict,
+			shortURL: "a",
+			want:     "https://a.example",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			bs := newBoltStorage(t)
+			shortURL, err := bs.Save(ctx, &tt.URL)
+			assert.ErrorIs(t, err, tt.wantErr)
+			assert.Equal(t, tt.shortURL, shortURL)
+
+			originalURL, err := bs.Load(ctx, tt.shortURL)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, originalURL)
+		})
+	}
+
+	t.Run("missing URL", func(t *testing.T) {
+		originalURL, err := newBoltStorage(t).Load(context.Background(), "missing")
+		require.NoError(t, err)
+		assert.Empty(t, originalURL)
+	})
+
+	t.Run("reopened database", func(t *testing.T) {
+		bs := newBoltStorage(t)
+		bs.Close()
+		bs, err := CreateStoreBolt(bs.Path)
+		require.NoError(t, err)
+		defer bs.Close()
+		originalURL, err := bs.Load(context.Background(), "b")
+		require.NoError(t, err)
+		assert.Equal(t, "https://b.example", originalURL)
+	})
+}
+
+func TestBoltStorage_DeleteBulk(t *testing.T) {
+	tests := []struct {
+		name        string
+		UserID      string
+		ShortURLs   []string
+		wantDeleted []string
+	}{
+		{name: "own URLs", UserID: "u1", ShortURLs: []string{"a", "b"}, wantDeleted: []string{"a", "b"}},
+		{name: "another user's URL is skipped", UserID: "u1", ShortURLs: []string{"a", "c"}, wantDeleted: []string{"a"}},
+		{name: "missing URL is skipped", UserID: "u2", ShortURLs: []string{"missing", "c"}, wantDeleted: []string{"c"}},
+		{name: "repeated deletion", UserID: "u1", ShortURLs: []string{"a", "a"}, wantDeleted: []string{"a"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			bs := newBoltStorage(t)
+			require.NoError(t, bs.DeleteBulk(ctx, tt.UserID, tt.ShortURLs))
+
+			for _, shortURL := range []string{"a", "b", "c"} {
+				originalURL, err := bs.Load(ctx, shortURL)
+				assert.Equal(t, "https://"+shortURL+".example", originalURL)
+				if slices.Contains(tt.wantDeleted, shortURL) {
+					assert.ErrorIs(t, err, models.ErrDeleted, shortURL)
+				} else {
+					assert.NoError(t, err, shortURL)
+				}
+			}
+
+			stats, err := bs.GetStats(ctx)
+			require.NoError(t, err)
+			assert.Equal(t, 3, stats.URLs, "deleted URLs are kept")
+		})
+	}
+}
+
+func TestBoltStorage_GetUserURLList(t *testing.T) {
+	tests := []struct {
+		name    string
+		UserID  string
+		deleted []string
+		want    []models.URLUserList
+	}{
+		{
+			name:   "owner of several URLs",
+			UserID: "u1",
+			want: []models.URLUserList{
+				{ShortURL: "a", OriginalURL: "https://a.example"},
+				{ShortURL: "b", OriginalURL: "https://b.example"},
+			},
+		},
+		{
+			name:   "owner of one URL",
+			UserID: "u2",
+			want:   []models.URLUserList{{ShortURL: "c", OriginalURL: "https://c.example"}},
+		},
+		{
+			name:    "deleted URLs are left out",
+			UserID:  "u1",
+			deleted: []string{"a"},
+			want:    []models.URLUserList{{ShortURL: "b", OriginalURL: "https://b.example"}},
+		},
+		{
+			name:   "unknown user",
+			UserID: "u3",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			bs := newBoltStorage(t)
+			require.NoError(t, bs.DeleteBulk(ctx, tt.UserID, tt.deleted))
+
+			list, err := bs.GetUserURLList(ctx, tt.UserID)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, list)
+		})
+	}
+
+	t.Run("stats", func(t *testing.T) {
+		stats, err := newBoltStorage(t).GetStats(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, models.Statistic{URLs: 3, Users: 2}, stats)
+	})
+}
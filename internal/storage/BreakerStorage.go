@@ -0,0 +1,347 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgerrcode"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/scaranin/go-svc-short-url/internal/models"
+	"go.uber.org/zap"
+)
+
+// Circuit breaker states.
+const (
+	breakerClosed = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+// BreakerStorage is a circuit-breaking decorator for models.Storage. After
+// FailureThreshold consecutive failures caused by the wrapped storage being
+// unreachable, the breaker opens and calls fail fast instead of waiting for
+// connection timeouts:
+//   - Load is served from Fallback (possibly stale) or returns models.ErrUnavailable;
+//   - RecordClick and UpdateVariants return models.ErrUnavailable;
+//   - Save and DeleteBulk are appended to Spool and reported as successful;
+//   - GetUserURLList and GetStats return models.ErrUnavailable.
+//
+// After OpenTimeout a single probe is let through (half-open state). When it
+// succeeds the breaker closes and the spooled writes are replayed in order.
+// While spooled writes are pending, new writes are spooled as well, so they
+// cannot overtake older ones.
+type BreakerStorage struct {
+	// Storage is the wrapped primary storage.
+	Storage models.Storage
+	// Fallback serves cached redirects while the breaker is open. It may be nil.
+	Fallback *CachedStorage
+	// Spool queues writes while the breaker is open.
+	Spool *Spool
+	// Probe checks the primary storage in the background while the breaker is
+	// open, so it can close even without traffic. It may be nil.
+	Probe func(ctx context.Context) error
+	// FailureThreshold is the number of consecutive failures that opens the breaker.
+	FailureThreshold int
+	// OpenTimeout is how long the breaker stays open before a probe is allowed.
+	OpenTimeout time.Duration
+
+	state     *breakerState
+	replaying *atomic.Bool
+}
+
+// breakerState is the mutable state shared by copies of a BreakerStorage.
+type breakerState struct {
+	mu       sync.Mutex
+	state    int
+	failures int
+	openedAt time.Time
+}
+
+// NewBreakerStorage wraps store with a circuit breaker that spools writes to spool.
+func NewBreakerStorage(store models.Storage, fallback *CachedStorage, spool *Spool, failureThreshold int, openTimeout time.Duration) BreakerStorage {
+	return BreakerStorage{
+		Storage:          store,
+		Fallback:         fallback,
+		Spool:            spool,
+		FailureThreshold: failureThreshold,
+		OpenTimeout:      openTimeout,
+		state:            &breakerState{},
+		replaying:        &atomic.Bool{},
+	}
+}
+
+// Save implements the models.Storage interface. While the breaker is open, or
+// while older writes are still spooled, the URL is spooled and its short URL is
+// returned without an error.
+func (bs BreakerStorage) Save(ctx context.Context, URL *models.URL) (string, error) {
+	if bs.Spool.Len() > 0 || !bs.allow() {
+		return URL.ShortURL, bs.Spool.Append(SpoolEntry{Op: spoolOpSave, URL: URL})
+	}
+	shortURL, err := bs.Storage.Save(ctx, URL)
+	bs.record(ctx, err)
+	if isUnavailable(ctx, err) {
+		return URL.ShortURL, bs.Spool.Append(SpoolEntry{Op: spoolOpSave, URL: URL})
+	}
+	return shortURL, err
+}
+
+// Load implements the models.Storage interface. While the breaker is open, or
+// when the wrapped storage turns out to be unreachable, the URL is served from
+// Fallback, ignoring its TTL.
+func (bs BreakerStorage) Load(ctx context.Context, shortURL string) (string, error) {
+	URL, err := bs.LoadURL(ctx, shortURL)
+	return URL.OriginalURL, err
+}
+
+// LoadURL implements the models.Storage interface with the same fallback as Load.
+func (bs BreakerStorage) LoadURL(ctx context.Context, shortURL string) (models.URL, error) {
+	if !bs.allow() {
+		return bs.loadFallback(shortURL)
+	}
+	URL, err := bs.Storage.LoadURL(ctx, shortURL)
+	bs.record(ctx, err)
+	if isUnavailable(ctx, err) {
+		return bs.loadFallback(shortURL)
+	}
+	return URL, err
+}
+
+// loadFallback serves shortURL from Fallback or returns models.ErrUnavailable.
+func (bs BreakerStorage) loadFallback(shortURL string) (models.URL, error) {
+	if bs.Fallback != nil {
+		if URL, err, ok := bs.Fallback.Peek(shortURL); ok {
+			return URL, err
+		}
+	}
+	return models.URL{}, models.ErrUnavailable
+}
+
+// RecordClick implements the models.Storage interface. It fails fast with
+// models.ErrUnavailable while the breaker is open: a click that cannot be
+// counted must not be let through.
+func (bs BreakerStorage) RecordClick(ctx context.Context, shortURL string, variant string) error {
+	if !bs.allow() {
+		return models.ErrUnavailable
+	}
+	err := bs.Storage.RecordClick(ctx, shortURL, variant)
+	bs.record(ctx, err)
+	return err
+}
+
+// UpdateVariants implements the models.Storage interface. It fails fast with
+// models.ErrUnavailable while the breaker is open.
+func (bs BreakerStorage) UpdateVariants(ctx context.Context, UserID string, shortURL string, variants []models.Variant) error {
+	if !bs.allow() {
+		return models.ErrUnavailable
+	}
+	err := bs.Storage.UpdateVariants(ctx, UserID, shortURL, variants)
+	bs.record(ctx, err)
+	return err
+}
+
+// GetUserURLList implements the models.Storage interface. It fails fast with
+// models.ErrUnavailable while the breaker is open.
+func (bs BreakerStorage) GetUserURLList(ctx context.Context, UserID string) ([]models.URLUserList, error) {
+	if !bs.allow() {
+		return nil, models.ErrUnavailable
+	}
+	URLList, err := bs.Storage.GetUserURLList(ctx, UserID)
+	bs.record(ctx, err)
+	return URLList, err
+}
+
+// DeleteBulk implements the models.Storage interface. While the breaker is open,
+// or while older writes are still spooled, the deletion is spooled.
+func (bs BreakerStorage) DeleteBulk(ctx context.Context, UserID string, ShortURLs []string) error {
+	entry := SpoolEntry{Op: spoolOpDelete, UserID: UserID, ShortURLs: ShortURLs}
+	if bs.Spool.Len() > 0 || !bs.allow() {
+		return bs.Spool.Append(entry)
+	}
+	err := bs.Storage.DeleteBulk(ctx, UserID, ShortURLs)
+	bs.record(ctx, err)
+	if isUnavailable(ctx, err) {
+		return bs.Spool.Append(entry)
+	}
+	return err
+}
+
+// GetStats implements the models.Storage interface. It fails fast with
+// models.ErrUnavailable while the breaker is open.
+func (bs BreakerStorage) GetStats(ctx context.Context) (models.Statistic, error) {
+	if !bs.allow() {
+		return models.Statistic{}, models.ErrUnavailable
+	}
+	stat, err := bs.Storage.GetStats(ctx)
+	bs.record(ctx, err)
+	return stat, err
+}
+
+// Ping implements the models.Pinger interface. It pings the wrapped storage
+// directly, regardless of the breaker state.
+func (bs BreakerStorage) Ping(ctx context.Context) error {
+	return pingStore(ctx, bs.Storage)
+}
+
+// PendingMigrations implements the models.Migrator interface by delegating to the wrapped storage.
+func (bs BreakerStorage) PendingMigrations(ctx context.Context) (int, error) {
+	return pendingMigrations(ctx, bs.Storage)
+}
+
+// Run probes the wrapped storage every OpenTimeout while the breaker is open and
+// replays spooled writes left over from a previous run. It blocks until ctx is
+// cancelled, so it is meant to be run in its own goroutine.
+func (bs BreakerStorage) Run(ctx context.Context) {
+	if bs.OpenTimeout <= 0 {
+		return
+	}
+	ticker := time.NewTicker(bs.OpenTimeout)
+	defer ticker.Stop()
+	for {
+		if bs.Probe != nil && bs.allow() {
+			probeCtx, cancel := context.WithTimeout(ctx, bs.OpenTimeout)
+			bs.record(ctx, bs.Probe(probeCtx))
+			cancel()
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// allow reports whether a call may be passed to the wrapped storage. An open
+// breaker lets a single probe through once OpenTimeout has elapsed.
+func (bs BreakerStorage) allow() bool {
+	bs.state.mu.Lock()
+	defer bs.state.mu.Unlock()
+	switch bs.state.state {
+	case breakerOpen:
+		if time.Since(bs.state.openedAt) < bs.OpenTimeout {
+			return false
+		}
+		bs.state.state = breakerHalfOpen
+		return true
+	case breakerHalfOpen:
+		return false
+	}
+	return true
+}
+
+// record updates the breaker with the outcome of a call that was allowed
+// through. A call given up by its caller tells nothing about the storage: it
+// is neither a failure nor a success.
+func (bs BreakerStorage) record(ctx context.Context, err error) {
+	switch {
+	case callerGone(ctx, err):
+		bs.abandon()
+	case isUnavailable(ctx, err):
+		bs.failure(err)
+	default:
+		bs.success()
+	}
+}
+
+// abandon reopens a half-open breaker whose probe was given up by its caller,
+// so the next call is let through as a new probe.
+func (bs BreakerStorage) abandon() {
+	bs.state.mu.Lock()
+	defer bs.state.mu.Unlock()
+	if bs.state.state == breakerHalfOpen {
+		bs.state.state = breakerOpen
+	}
+}
+
+// success closes the breaker and starts replaying spooled writes, if any.
+func (bs BreakerStorage) success() {
+	bs.state.mu.Lock()
+	if bs.state.state != breakerClosed {
+		zap.L().Info("storage circuit breaker closed")
+	}
+	bs.state.state = breakerClosed
+	bs.state.failures = 0
+	bs.state.mu.Unlock()
+
+	if bs.Spool.Len() > 0 && bs.replaying.CompareAndSwap(false, true) {
+		go bs.replay()
+	}
+}
+
+// failure counts a failed call and opens the breaker when the threshold is
+// reached or when the half-open probe fails.
+func (bs BreakerStorage) failure(err error) {
+	bs.state.mu.Lock()
+	defer bs.state.mu.Unlock()
+	bs.state.failures++
+	if bs.state.state == breakerHalfOpen || (bs.state.state == breakerClosed && bs.state.failures >= bs.FailureThreshold) {
+		zap.L().Warn("storage circuit breaker opened", zap.Error(err))
+		bs.state.state = breakerOpen
+		bs.state.openedAt = time.Now()
+	}
+}
+
+// replay applies the spooled writes to the wrapped storage. A write rejected by
+// the storage itself (for example a duplicate URL) is dropped; replay stops at
+// the first write that fails because the storage is unreachable again.
+// It runs detached from the requests whose writes were spooled, so it uses a
+// background context.
+func (bs BreakerStorage) replay() {
+	defer bs.replaying.Store(false)
+	ctx := context.Background()
+	applied, err := bs.Spool.Replay(func(entry SpoolEntry) error {
+		var err error
+		switch entry.Op {
+		case spoolOpSave:
+			_, err = bs.Storage.Save(ctx, entry.URL)
+		case spoolOpDelete:
+			err = bs.Storage.DeleteBulk(ctx, entry.UserID, entry.ShortURLs)
+		}
+		if isUnavailable(ctx, err) {
+			return err
+		}
+		if err != nil {
+			zap.L().Warn("spooled write dropped", zap.String("op", entry.Op), zap.Error(err))
+		}
+		return nil
+	})
+	if applied > 0 {
+		zap.L().Info("replayed spooled writes", zap.Int("count", applied))
+	}
+	if err != nil {
+		bs.failure(err)
+	}
+}
+
+// callerGone reports whether err is the cancellation or deadline of ctx, that
+// is the caller gave up rather than the storage failing.
+func callerGone(ctx context.Context, err error) bool {
+	return ctx.Err() != nil && (errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded))
+}
+
+// isUnavailable reports whether err means the storage could not be reached, as
+// opposed to a regular outcome such as a missing row, a constraint violation,
+// a link that may not be followed any more or a call given up by the caller
+// of ctx.
+func isUnavailable(ctx context.Context, err error) bool {
+	if err == nil ||
+		callerGone(ctx, err) ||
+		errors.Is(err, pgx.ErrNoRows) ||
+		errors.Is(err, models.ErrNotFound) ||
+		errors.Is(err, models.ErrDeleted) ||
+		errors.Is(err, models.ErrConflict) ||
+		errors.Is(err, models.ErrClicksExhausted) ||
+		errors.Is(err, models.ErrNotOwned) {
+		return false
+	}
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgerrcode.IsConnectionException(pgErr.Code) ||
+			pgerrcode.IsOperatorIntervention(pgErr.Code) ||
+			pgerrcode.IsInsufficientResources(pgErr.Code)
+	}
+	return true
+}
@@ -0,0 +1,190 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/scaranin/go-svc-short-url/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// flakyStorage wraps an in-memory FileStorageJSON and fails every call while down is set.
+type flakyStorage struct {
+	FileStorageJSON
+	down *atomic.Bool
+}
+
+var errConnRefused = errors.New("dial tcp: connection refused")
+
+func (s flakyStorage) Save(ctx context.Context, URL *models.URL) (string, error) {
+	if s.down.Load() {
+		return "", errConnRefused
+	}
+	return s.FileStorageJSON.Save(ctx, URL)
+}
+
+func (s flakyStorage) LoadURL(ctx context.Context, shortURL string) (models.URL, error) {
+	if s.down.Load() {
+		return models.URL{}, errConnRefused
+	}
+	return s.FileStorageJSON.LoadURL(ctx, shortURL)
+}
+
+func (s flakyStorage) DeleteBulk(ctx context.Context, UserID string, ShortURLs []string) error {
+	if s.down.Load() {
+		return errConnRefused
+	}
+	return s.FileStorageJSON.DeleteBulk(ctx, UserID, ShortURLs)
+}
+
+func TestBreakerStorage(t *testing.T) {
+	ctx := context.Background()
+	fs, err := CreateStoreFile("")
+	require.NoError(t, err)
+	inner := flakyStorage{FileStorageJSON: fs, down: &atomic.Bool{}}
+	cache := NewCachedStorage(inner, 10, time.Millisecond, time.Millisecond)
+	spool, err := OpenSpool(filepath.Join(t.TempDir(), "spool.jsonl"))
+	require.NoError(t, err)
+	defer spool.Close()
+	bs := NewBreakerStorage(cache, &cache, spool, 2, 50*time.Millisecond)
+
+	_, err = bs.Save(ctx, &models.URL{ShortURL: "a", OriginalURL: "https://a.example", UserID: "u1"})
+	require.NoError(t, err)
+	_, err = bs.Load(ctx, "a")
+	require.NoError(t, err)
+
+	inner.down.Store(true)
+	time.Sleep(2 * time.Millisecond) // let the cached entry expire
+	for i := 0; i < 2; i++ {
+		originalURL, err := bs.Load(ctx, "a")
+		require.NoError(t, err)
+		assert.Equal(t, "https://a.example", originalURL, "stale cached URL must be served while the storage is down")
+	}
+	_, err = bs.Load(ctx, "unknown")
+	assert.ErrorIs(t, err, models.ErrUnavailable)
+	assert.Equal(t, breakerOpen, bs.state.state)
+
+	_, err = bs.Save(ctx, &models.URL{ShortURL: "b", OriginalURL: "https://b.example", UserID: "u1"})
+	require.NoError(t, err)
+	require.NoError(t, bs.DeleteBulk(ctx, "u1", []string{"a"}))
+	assert.Equal(t, 2, spool.Len())
+
+	inner.down.Store(false)
+	time.Sleep(60 * time.Millisecond)
+	_, err = bs.Load(ctx, "unknown")
+	require.NoError(t, err, "the half-open probe must close the breaker")
+	require.Eventually(t, func() bool { return spool.Len() == 0 }, time.Second, 5*time.Millisecond)
+
+	originalURL, err := fs.Load(ctx, "b")
+	require.NoError(t, err)
+	assert.Equal(t, "https://b.example", originalURL)
+	_, err = fs.Load(ctx, "a")
+	assert.ErrorIs(t, err, models.ErrDeleted)
+}
+
+func TestBreakerStorageExhausted(t *testing.T) {
+	ctx := context.Background()
+	bolt, err := CreateStoreBolt(filepath.Join(t.TempDir(), "links.db"))
+	require.NoError(t, err)
+	defer bolt.Close()
+	spool, err := OpenSpool(filepath.Join(t.TempDir(), "spool.jsonl"))
+	require.NoError(t, err)
+	defer spool.Close()
+	bs := NewBreakerStorage(bolt, nil, spool, 3, time.Minute)
+
+	_, err = bs.Save(ctx, &models.URL{ShortURL: "once", OriginalURL: "https://once.example", LinkOptions: models.LinkOptions{MaxClicks: 1}})
+	require.NoError(t, err)
+	_, err = bs.Save(ctx, &models.URL{ShortURL: "healthy", OriginalURL: "https://healthy.example", UserID: "u1"})
+	require.NoError(t, err)
+	require.NoError(t, bs.RecordClick(ctx, "once", ""))
+
+	for i := 0; i < 5; i++ {
+		_, err = bs.LoadURL(ctx, "once")
+		assert.ErrorIs(t, err, models.ErrClicksExhausted)
+		assert.ErrorIs(t, bs.RecordClick(ctx, "once", ""), models.ErrClicksExhausted)
+		assert.ErrorIs(t, bs.UpdateVariants(ctx, "intruder", "healthy", nil), models.ErrNotOwned)
+	}
+	assert.Equal(t, breakerClosed, bs.state.state, "exhausted links are not an outage")
+
+	originalURL, err := bs.Load(ctx, "healthy")
+	require.NoError(t, err)
+	assert.Equal(t, "https://healthy.example", originalURL)
+	_, err = bs.Save(ctx, &models.URL{ShortURL: "new", OriginalURL: "https://new.example"})
+	require.NoError(t, err)
+	assert.Zero(t, spool.Len(), "writes are not spooled")
+}
+
+// hangingStorage wraps an in-memory FileStorageJSON and blocks every call until
+// its context is done, like a query cancelled by the client.
+type hangingStorage struct {
+	FileStorageJSON
+}
+
+func (s hangingStorage) Save(ctx context.Context, URL *models.URL) (string, error) {
+	<-ctx.Done()
+	return "", ctx.Err()
+}
+
+func (s hangingStorage) LoadURL(ctx context.Context, shortURL string) (models.URL, error) {
+	<-ctx.Done()
+	return models.URL{}, ctx.Err()
+}
+
+func TestBreakerStorageCancelled(t *testing.T) {
+	tests := []struct {
+		name    string
+		ctx     func() (context.Context, context.CancelFunc)
+		wantErr error
+	}{
+		{
+			name: "cancelled",
+			ctx: func() (context.Context, context.CancelFunc) {
+				ctx, cancel := context.WithCancel(context.Background())
+				cancel()
+				return ctx, cancel
+			},
+			wantErr: context.Canceled,
+		},
+		{
+			name: "deadline exceeded",
+			ctx: func() (context.Context, context.CancelFunc) {
+				return context.WithTimeout(context.Background(), time.Millisecond)
+			},
+			wantErr: context.DeadlineExceeded,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs, err := CreateStoreFile("")
+			require.NoError(t, err)
+			spool, err := OpenSpool(filepath.Join(t.TempDir(), "spool.jsonl"))
+			require.NoError(t, err)
+			defer spool.Close()
+			bs := NewBreakerStorage(hangingStorage{FileStorageJSON: fs}, nil, spool, 2, time.Minute)
+
+			for i := 0; i < 5; i++ {
+				ctx, cancel := tt.ctx()
+				_, err := bs.LoadURL(ctx, "a")
+				assert.ErrorIs(t, err, tt.wantErr)
+				_, err = bs.Save(ctx, &models.URL{ShortURL: "a", OriginalURL: "https://a.example"})
+				assert.ErrorIs(t, err, tt.wantErr)
+				cancel()
+			}
+			assert.Equal(t, breakerClosed, bs.state.state, "requests given up by the client are not an outage")
+			assert.Zero(t, spool.Len(), "writes given up by the client are not spooled")
+
+			bs.state.state, bs.state.openedAt = breakerOpen, time.Now().Add(-time.Minute)
+			ctx, cancel := tt.ctx()
+			defer cancel()
+			_, err = bs.LoadURL(ctx, "a")
+			assert.ErrorIs(t, err, tt.wantErr)
+			assert.Equal(t, breakerOpen, bs.state.state, "a probe given up by the client is retried by the next call")
+			assert.True(t, bs.allow())
+		})
+	}
+}
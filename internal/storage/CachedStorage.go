@@ -0,0 +1,287 @@
+package storage
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/scaranin/go-svc-short-url/internal/metrics"
+	"github.com/scaranin/go-svc-short-url/internal/models"
+)
+
+// CacheStats is a snapshot of the counters collected by CachedStorage.
+type CacheStats struct {
+	// Hits is the number of Load calls answered from a cached mapping.
+	Hits uint64 `json:"hits"`
+	// NegativeHits is the number of Load calls answered from a cached miss.
+	NegativeHits uint64 `json:"negative_hits"`
+	// Misses is the number of Load calls passed through to the underlying storage.
+	Misses uint64 `json:"misses"`
+	// Evictions is the number of entries dropped to respect the size bound.
+	Evictions uint64 `json:"evictions"`
+	// Size is the current number of cached entries.
+	Size int `json:"size"`
+}
+
+// HitRatio returns the share of Load calls answered from the cache, including
+// cached misses, or 0 if nothing has been loaded yet.
+func (s CacheStats) HitRatio() float64 {
+	total := s.Hits + s.NegativeHits + s.Misses
+	if total == 0 {
+		return 0
+	}
+	return float64(s.Hits+s.NegativeHits) / float64(total)
+}
+
+// cacheEntry is a single cached result of Storage.LoadURL.
+type cacheEntry struct {
+	shortURL  string
+	URL       models.URL
+	err       error
+	negative  bool
+	expiresAt time.Time
+}
+
+// CachedStorage is a read-through decorator for models.Storage that keeps hot
+// short→original mappings in a size-bounded LRU cache with a TTL. Lookups of
+// unknown short URLs are cached as well (negative caching) with their own,
+// usually shorter, TTL. Entries are invalidated when the URL is saved or deleted
+// through the decorator, and CachedStorage implements Invalidator so changes made
+// by other instances can be applied too; all other calls are passed to the
+// wrapped storage.
+type CachedStorage struct {
+	// Storage is the wrapped storage that serves cache misses and all writes.
+	Storage models.Storage
+	// Size is the maximum number of cached entries.
+	Size int
+	// TTL is how long a found mapping stays cached.
+	TTL time.Duration
+	// NegativeTTL is how long a miss stays cached.
+	NegativeTTL time.Duration
+
+	mu      *sync.Mutex
+	lru     *list.List
+	entries map[string]*list.Element
+	stats   *cacheCounters
+	// gen is bumped on every invalidation, so a Load that raced with a write
+	// does not cache the stale result it read before the write.
+	gen *atomic.Uint64
+}
+
+// cacheCounters holds the atomic counters behind CacheStats.
+type cacheCounters struct {
+	hits, negativeHits, misses, evictions atomic.Uint64
+}
+
+// NewCachedStorage wraps store with an LRU cache holding up to size entries.
+func NewCachedStorage(store models.Storage, size int, ttl time.Duration, negativeTTL time.Duration) CachedStorage {
+	return CachedStorage{
+		Storage:     store,
+		Size:        size,
+		TTL:         ttl,
+		NegativeTTL: negativeTTL,
+		mu:          &sync.Mutex{},
+		lru:         list.New(),
+		entries:     make(map[string]*list.Element),
+		stats:       &cacheCounters{},
+		gen:         &atomic.Uint64{},
+	}
+}
+
+// Save implements the models.Storage interface. It passes the call to the wrapped
+// storage and drops any cached entry for the short URL, including a cached miss.
+func (cs CachedStorage) Save(ctx context.Context, URL *models.URL) (string, error) {
+	shortURL, err := cs.Storage.Save(ctx, URL)
+	cs.Invalidate(URL.ShortURL)
+	return shortURL, err
+}
+
+// Load implements the models.Storage interface. It answers from the cache when a
+// fresh entry exists, otherwise it loads from the wrapped storage and caches the
+// result: found and deleted URLs for TTL, unknown short URLs for NegativeTTL.
+// Errors other than "not found" and models.ErrDeleted are never cached, and
+// neither are click-limited URLs, whose click count changes on every redirect.
+func (cs CachedStorage) Load(ctx context.Context, shortURL string) (string, error) {
+	URL, err := cs.LoadURL(ctx, shortURL)
+	return URL.OriginalURL, err
+}
+
+// LoadURL implements the models.Storage interface. It caches whole records the
+// same way Load caches original URLs; Load is served from the same entries.
+func (cs CachedStorage) LoadURL(ctx context.Context, shortURL string) (models.URL, error) {
+	if entry, ok := cs.get(shortURL); ok {
+		if entry.negative {
+			cs.stats.negativeHits.Add(1)
+		} else {
+			cs.stats.hits.Add(1)
+		}
+		return entry.URL, entry.err
+	}
+	cs.stats.misses.Add(1)
+
+	gen := cs.gen.Load()
+	URL, err := cs.Storage.LoadURL(ctx, shortURL)
+	switch {
+	case errors.Is(err, models.ErrNotFound), err == nil && len(URL.OriginalURL) == 0:
+		cs.put(&cacheEntry{shortURL: shortURL, URL: URL, err: err, negative: true}, cs.NegativeTTL, gen)
+	case URL.MaxClicks > 0:
+	case err == nil, errors.Is(err, models.ErrDeleted):
+		cs.put(&cacheEntry{shortURL: shortURL, URL: URL, err: err}, cs.TTL, gen)
+	}
+	return URL, err
+}
+
+// RecordClick implements the models.Storage interface by delegating to the
+// wrapped storage. Click-limited URLs are never cached, so there is nothing
+// to invalidate; the variant counts of cached URLs may lag by up to TTL.
+func (cs CachedStorage) RecordClick(ctx context.Context, shortURL string, variant string) error {
+	return cs.Storage.RecordClick(ctx, shortURL, variant)
+}
+
+// UpdateVariants implements the models.Storage interface. It passes the call
+// to the wrapped storage and invalidates the short URL.
+func (cs CachedStorage) UpdateVariants(ctx context.Context, UserID string, shortURL string, variants []models.Variant) error {
+	err := cs.Storage.UpdateVariants(ctx, UserID, shortURL, variants)
+	cs.Invalidate(shortURL)
+	return err
+}
+
+// GetUserURLList implements the models.Storage interface by delegating to the wrapped storage.
+func (cs CachedStorage) GetUserURLList(ctx context.Context, UserID string) ([]models.URLUserList, error) {
+	return cs.Storage.GetUserURLList(ctx, UserID)
+}
+
+// DeleteBulk implements the models.Storage interface. It passes the call to the
+// wrapped storage and invalidates the affected short URLs.
+func (cs CachedStorage) DeleteBulk(ctx context.Context, UserID string, ShortURLs []string) error {
+	err := cs.Storage.DeleteBulk(ctx, UserID, ShortURLs)
+	cs.Invalidate(ShortURLs...)
+	return err
+}
+
+// GetStats implements the models.Storage interface by delegating to the wrapped storage.
+func (cs CachedStorage) GetStats(ctx context.Context) (models.Statistic, error) {
+	return cs.Storage.GetStats(ctx)
+}
+
+// Ping implements the models.Pinger interface by delegating to the wrapped storage.
+func (cs CachedStorage) Ping(ctx context.Context) error {
+	return pingStore(ctx, cs.Storage)
+}
+
+// PendingMigrations implements the models.Migrator interface by delegating to the wrapped storage.
+func (cs CachedStorage) PendingMigrations(ctx context.Context) (int, error) {
+	return pendingMigrations(ctx, cs.Storage)
+}
+
+// Invalidate drops the cached entries for the given short URLs.
+func (cs CachedStorage) Invalidate(shortURLs ...string) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	cs.gen.Add(1)
+	for _, shortURL := range shortURLs {
+		if elem, ok := cs.entries[shortURL]; ok {
+			cs.lru.Remove(elem)
+			delete(cs.entries, shortURL)
+		}
+	}
+}
+
+// Purge drops all cached entries.
+func (cs CachedStorage) Purge() {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	cs.gen.Add(1)
+	cs.lru.Init()
+	clear(cs.entries)
+}
+
+// CacheStats returns a snapshot of the cache counters.
+func (cs CachedStorage) CacheStats() CacheStats {
+	cs.mu.Lock()
+	size := cs.lru.Len()
+	cs.mu.Unlock()
+	return CacheStats{
+		Hits:         cs.stats.hits.Load(),
+		NegativeHits: cs.stats.negativeHits.Load(),
+		Misses:       cs.stats.misses.Load(),
+		Evictions:    cs.stats.evictions.Load(),
+		Size:         size,
+	}
+}
+
+// Sample returns the cache counters in the form exported by metrics.CacheCollector.
+func (cs CachedStorage) Sample() metrics.CacheSample {
+	stats := cs.CacheStats()
+	return metrics.CacheSample{
+		Hits:         stats.Hits,
+		NegativeHits: stats.NegativeHits,
+		Misses:       stats.Misses,
+		Evictions:    stats.Evictions,
+		Size:         stats.Size,
+		HitRatio:     stats.HitRatio(),
+	}
+}
+
+// Peek returns the cached result for shortURL without consulting the wrapped
+// storage, even if the entry has expired. It is meant for serving stale data
+// while the wrapped storage is unavailable.
+func (cs CachedStorage) Peek(shortURL string) (models.URL, error, bool) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	elem, ok := cs.entries[shortURL]
+	if !ok {
+		return models.URL{}, nil, false
+	}
+	entry := elem.Value.(*cacheEntry)
+	return entry.URL, entry.err, true
+}
+
+// get returns a fresh entry for shortURL and marks it as recently used.
+// Expired entries are kept until they are reloaded or evicted, so Peek can
+// still serve them.
+func (cs CachedStorage) get(shortURL string) (*cacheEntry, bool) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	elem, ok := cs.entries[shortURL]
+	if !ok {
+		return nil, false
+	}
+	entry := elem.Value.(*cacheEntry)
+	if time.Now().After(entry.expiresAt) {
+		return nil, false
+	}
+	cs.lru.MoveToFront(elem)
+	return entry, true
+}
+
+// put stores entry for ttl, evicting the least recently used entries if the
+// cache is full. A non-positive ttl disables caching of the entry. The entry is
+// dropped if the cache has been invalidated since generation gen was read.
+func (cs CachedStorage) put(entry *cacheEntry, ttl time.Duration, gen uint64) {
+	if ttl <= 0 || cs.Size <= 0 {
+		return
+	}
+	entry.expiresAt = time.Now().Add(ttl)
+
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	if cs.gen.Load() != gen {
+		return
+	}
+	if elem, ok := cs.entries[entry.shortURL]; ok {
+		elem.Value = entry
+		cs.lru.MoveToFront(elem)
+		return
+	}
+	cs.entries[entry.shortURL] = cs.lru.PushFront(entry)
+	for cs.lru.Len() > cs.Size {
+		oldest := cs.lru.Back()
+		cs.lru.Remove(oldest)
+		delete(cs.entries, oldest.Value.(*cacheEntry).shortURL)
+		cs.stats.evictions.Add(1)
+	}
+}
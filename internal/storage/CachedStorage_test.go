@@ -0,0 +1,176 @@
+package storage
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/scaranin/go-svc-short-url/internal/metrics"
+	"github.com/scaranin/go-svc-short-url/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countingStorage wraps an in-memory FileStorageJSON and counts Load calls.
+type countingStorage struct {
+	FileStorageJSON
+	loads *int
+}
+
+func (s countingStorage) LoadURL(ctx context.Context, shortURL string) (models.URL, error) {
+	*s.loads++
+	return s.FileStorageJSON.LoadURL(ctx, shortURL)
+}
+
+func newCountingStorage(t testing.TB) countingStorage {
+	fs, err := CreateStoreFile("")
+	require.NoError(t, err)
+	return countingStorage{FileStorageJSON: fs, loads: new(int)}
+}
+
+func TestCachedStorage_Load(t *testing.T) {
+	ctx := context.Background()
+	inner := newCountingStorage(t)
+	cs := NewCachedStorage(inner, 2, time.Minute, time.Minute)
+
+	_, err := cs.Save(ctx, &models.URL{ShortURL: "a", OriginalURL: "https://a.example", UserID: "u1"})
+	require.NoError(t, err)
+
+	for i := 0; i < 3; i++ {
+		originalURL, err := cs.Load(ctx, "a")
+		require.NoError(t, err)
+		assert.Equal(t, "https://a.example", originalURL)
+	}
+	assert.Equal(t, 1, *inner.loads, "repeated loads must be served from the cache")
+
+	for i := 0; i < 3; i++ {
+		originalURL, err := cs.Load(ctx, "missing")
+		require.NoError(t, err)
+		assert.Empty(t, originalURL)
+	}
+	assert.Equal(t, 2, *inner.loads, "misses must be cached too")
+
+	_, err = cs.Save(ctx, &models.URL{ShortURL: "missing", OriginalURL: "https://m.example", UserID: "u1"})
+	require.NoError(t, err)
+	originalURL, err := cs.Load(ctx, "missing")
+	require.NoError(t, err)
+	assert.Equal(t, "https://m.example", originalURL, "save must invalidate a cached miss")
+
+	require.NoError(t, cs.DeleteBulk(ctx, "u1", []string{"a"}))
+	_, err = cs.Load(ctx, "a")
+	assert.ErrorIs(t, err, models.ErrDeleted, "delete must invalidate the cached mapping")
+
+	stats := cs.CacheStats()
+	assert.Equal(t, uint64(2), stats.Hits)
+	assert.Equal(t, uint64(2), stats.NegativeHits)
+	assert.Equal(t, uint64(4), stats.Misses)
+	assert.InDelta(t, 0.5, stats.HitRatio(), 1e-9)
+}
+
+func TestCachedStorage_EvictionAndTTL(t *testing.T) {
+	ctx := context.Background()
+	inner := newCountingStorage(t)
+	cs := NewCachedStorage(inner, 2, 50*time.Millisecond, time.Minute)
+	for _, shortURL := range []string{"a", "b", "c"} {
+		_, err := cs.Save(ctx, &models.URL{ShortURL: shortURL, OriginalURL: "https://" + shortURL + ".example"})
+		require.NoError(t, err)
+		_, err = cs.Load(ctx, shortURL)
+		require.NoError(t, err)
+	}
+
+	stats := cs.CacheStats()
+	assert.Equal(t, 2, stats.Size)
+	assert.Equal(t, uint64(1), stats.Evictions)
+
+	_, _ = cs.Load(ctx, "a")
+	assert.Equal(t, 4, *inner.loads, "the least recently used entry must be evicted")
+
+	time.Sleep(60 * time.Millisecond)
+	_, _ = cs.Load(ctx, "c")
+	assert.Equal(t, 5, *inner.loads, "expired entries must be reloaded")
+}
+
+func TestCachedStorage_Metrics(t *testing.T) {
+	ctx := context.Background()
+	cs := NewCachedStorage(newCountingStorage(t), 2, time.Minute, time.Minute)
+	_, err := cs.Save(ctx, &models.URL{ShortURL: "a", OriginalURL: "https://a.example"})
+	require.NoError(t, err)
+	for _, shortURL := range []string{"a", "a", "a", "missing"} {
+		_, err := cs.Load(ctx, shortURL)
+		require.NoError(t, err)
+	}
+
+	registry := prometheus.NewPedanticRegistry()
+	require.NoError(t, registry.Register(metrics.NewCacheCollector(cs.Sample)))
+	families, err := registry.Gather()
+	require.NoError(t, err)
+	values := make(map[string]float64)
+	for _, family := range families {
+		for _, metric := range family.GetMetric() {
+			name := family.GetName()
+			for _, label := range metric.GetLabel() {
+				name += "/" + label.GetValue()
+			}
+			values[name] = metric.GetCounter().GetValue() + metric.GetGauge().GetValue()
+		}
+	}
+	assert.Equal(t, map[string]float64{
+		"shortener_cache_lookups_total/hit":          2,
+		"shortener_cache_lookups_total/negative_hit": 0,
+		"shortener_cache_lookups_total/miss":         2,
+		"shortener_cache_evictions_total":            0,
+		"shortener_cache_entries":                    2,
+		"shortener_cache_hit_ratio":                  0.5,
+	}, values)
+}
+
+// benchmarkDSN returns the database used by the DBStorage benchmarks or skips them.
+func benchmarkDSN(b *testing.B) string {
+	dsn := os.Getenv("DATABASE_DSN")
+	if len(dsn) == 0 {
+		b.Skip("DATABASE_DSN is not set")
+	}
+	return dsn
+}
+
+// seedBenchmarkURLs saves n URLs and returns their short identifiers.
+func seedBenchmarkURLs(b *testing.B, store models.Storage, n int) []string {
+	ctx := context.Background()
+	shortURLs := make([]string, n)
+	for i := range shortURLs {
+		shortURLs[i] = "bench-" + strconv.Itoa(i)
+		_, _ = store.Save(ctx, &models.URL{ShortURL: shortURLs[i], OriginalURL: "https://bench.example/" + strconv.Itoa(i)})
+	}
+	return shortURLs
+}
+
+func BenchmarkDBStorage_Load(b *testing.B) {
+	ctx := context.Background()
+	dbStore, err := CreateStoreDB(benchmarkDSN(b))
+	require.NoError(b, err)
+	defer dbStore.Close()
+	shortURLs := seedBenchmarkURLs(b, dbStore, 100)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, _ = dbStore.Load(ctx, shortURLs[i%len(shortURLs)])
+	}
+}
+
+func BenchmarkCachedStorage_Load(b *testing.B) {
+	ctx := context.Background()
+	dbStore, err := CreateStoreDB(benchmarkDSN(b))
+	require.NoError(b, err)
+	defer dbStore.Close()
+	cs := NewCachedStorage(dbStore, 1000, time.Minute, time.Minute)
+	shortURLs := seedBenchmarkURLs(b, cs, 100)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, _ = cs.Load(ctx, shortURLs[i%len(shortURLs)])
+	}
+	b.ReportMetric(cs.CacheStats().HitRatio(), "hit-ratio")
+}
@@ -0,0 +1,100 @@
+package storage
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.uber.org/zap"
+)
+
+const (
+	// changesChannel is the PostgreSQL NOTIFY channel that carries MAP_URL changes.
+	// Each payload has the form "<op>:<short_url>", where op is "save", "update" or "delete".
+	changesChannel = "map_url_changes"
+	// listenMinBackoff is the delay before the first reconnect attempt.
+	listenMinBackoff = 500 * time.Millisecond
+	// listenMaxBackoff caps the delay between reconnect attempts.
+	listenMaxBackoff = 30 * time.Second
+)
+
+// Invalidator is implemented by caches that can drop entries on external changes.
+type Invalidator interface {
+	// Invalidate drops the entries for the given short URLs.
+	Invalidate(shortURLs ...string)
+	// Purge drops all entries.
+	Purge()
+}
+
+// execer is the subset of pgxpool.Pool and pgx.Tx used to send notifications.
+type execer interface {
+	Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)
+}
+
+// notifyChanged broadcasts a change of the given short URLs on changesChannel.
+// When exec is a transaction, the notifications are delivered on commit.
+func notifyChanged(ctx context.Context, exec execer, op string, shortURLs []string) error {
+	_, err := exec.Exec(ctx, "SELECT pg_notify($1::text, $2::text || ':' || s) FROM unnest($3::text[]) AS s",
+		changesChannel, op, shortURLs,
+	)
+	return err
+}
+
+// ListenInvalidations keeps a dedicated pool connection subscribed to changesChannel
+// and evicts the short URLs reported by other instances from target. It blocks until
+// ctx is cancelled, so it is meant to be run in its own goroutine.
+//
+// If the connection is lost, the listener reconnects with exponential backoff.
+// Notifications sent while it was disconnected are lost, so target is purged
+// every time the subscription is (re)established.
+func ListenInvalidations(ctx context.Context, pool *pgxpool.Pool, target Invalidator) {
+	backoff := listenMinBackoff
+	for {
+		err := listen(ctx, pool, target, func() { backoff = listenMinBackoff })
+		if ctx.Err() != nil {
+			return
+		}
+		zap.L().Warn("invalidation listener failed, reconnecting", zap.Error(err), zap.Duration("backoff", backoff))
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, listenMaxBackoff)
+	}
+}
+
+// listen subscribes a single connection to changesChannel and dispatches
+// notifications to target until the connection fails or ctx is cancelled.
+// onSubscribed is called once the subscription is active.
+func listen(ctx context.Context, pool *pgxpool.Pool, target Invalidator, onSubscribed func()) error {
+	conn, err := pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	if _, err = conn.Exec(ctx, "LISTEN "+changesChannel); err != nil {
+		conn.Conn().Close(context.Background())
+		return err
+	}
+	target.Purge()
+	onSubscribed()
+
+	for {
+		notification, err := conn.Conn().WaitForNotification(ctx)
+		if err != nil {
+			// Close the connection so the pool discards it instead of reusing
+			// a connection that is still subscribed or in an unknown state.
+			conn.Conn().Close(context.Background())
+			return err
+		}
+		_, shortURL, ok := strings.Cut(notification.Payload, ":")
+		if ok {
+			target.Invalidate(shortURL)
+		}
+	}
+}
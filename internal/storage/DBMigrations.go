@@ -0,0 +1,102 @@
+package storage
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// dbMigrations are the schema changes of `MAP_URL`, applied in order by
+// CreateDBScheme. The version of a migration is its index plus one and is
+// recorded in `schema_migrations`, so migrations must only ever be appended.
+// The first migrations use IF NOT EXISTS because they predate the
+// `schema_migrations` table and may already have been applied.
+var dbMigrations = []string{
+	`CREATE TABLE IF NOT EXISTS MAP_URL (
+		"correlation_id" TEXT,
+		"short_url" TEXT,
+		"original_url" TEXT,
+		"user_id" TEXT,
+		"is_deleted" BOOL
+	)`,
+	`CREATE UNIQUE INDEX IF NOT EXISTS idx_original_url ON MAP_URL(original_url)`,
+	`ALTER TABLE MAP_URL ADD COLUMN canonical_url TEXT`,
+	// Rows written before canonicalization are their own canonical form.
+	`UPDATE MAP_URL SET canonical_url = original_url WHERE canonical_url IS NULL`,
+	`CREATE UNIQUE INDEX idx_canonical_url ON MAP_URL(canonical_url)`,
+	`ALTER TABLE MAP_URL ADD COLUMN redirect_status INT NOT NULL DEFAULT 0`,
+	`ALTER TABLE MAP_URL ADD COLUMN forward_query BOOL NOT NULL DEFAULT false`,
+	`ALTER TABLE MAP_URL ADD COLUMN title TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE MAP_URL ADD COLUMN description TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE MAP_URL ADD COLUMN always_preview BOOL NOT NULL DEFAULT false`,
+	`ALTER TABLE MAP_URL ADD COLUMN password_hash TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE MAP_URL ADD COLUMN max_clicks INT NOT NULL DEFAULT 0`,
+	`ALTER TABLE MAP_URL ADD COLUMN clicks INT NOT NULL DEFAULT 0`,
+	`ALTER TABLE MAP_URL ADD COLUMN not_before TIMESTAMPTZ`,
+	`ALTER TABLE MAP_URL ADD COLUMN expires_at TIMESTAMPTZ`,
+	`ALTER TABLE MAP_URL ADD COLUMN targets JSONB`,
+	`ALTER TABLE MAP_URL ADD COLUMN variants JSONB`,
+	`CREATE TABLE variant_clicks (
+		"short_url" TEXT NOT NULL,
+		"variant" TEXT NOT NULL,
+		"clicks" BIGINT NOT NULL DEFAULT 0,
+		PRIMARY KEY (short_url, variant)
+	)`,
+}
+
+// migrationsLockID is the advisory lock key that serializes CreateDBScheme
+// across instances starting at the same time.
+const migrationsLockID = 0x5f75726c
+
+// CreateDBScheme brings the database schema up to date. It applies the
+// migrations from dbMigrations that are not recorded in `schema_migrations`
+// yet, each in its own transaction. Concurrent callers are serialized with an
+// advisory lock, so it is safe to run on every start of every instance.
+func (dbStore DBStorage) CreateDBScheme(ctx context.Context) error {
+	_, err := dbStore.PGXPool.Exec(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		"version" INT PRIMARY KEY,
+		"applied_at" TIMESTAMPTZ NOT NULL DEFAULT now()
+	)`)
+	if err != nil {
+		return err
+	}
+
+	conn, err := dbStore.PGXPool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+	if _, err = conn.Exec(ctx, "SELECT pg_advisory_lock($1)", migrationsLockID); err != nil {
+		return err
+	}
+	defer conn.Exec(context.Background(), "SELECT pg_advisory_unlock($1)", migrationsLockID)
+
+	var applied int
+	if err = conn.QueryRow(ctx, "SELECT coalesce(max(version), 0) FROM schema_migrations").Scan(&applied); err != nil {
+		return err
+	}
+	for version := applied + 1; version <= len(dbMigrations); version++ {
+		err = pgx.BeginFunc(ctx, conn, func(tx pgx.Tx) error {
+			if _, err := tx.Exec(ctx, dbMigrations[version-1]); err != nil {
+				return err
+			}
+			_, err := tx.Exec(ctx, "INSERT INTO schema_migrations (version) VALUES ($1)", version)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PendingMigrations implements the models.Migrator interface. It returns the
+// number of migrations from dbMigrations not recorded in `schema_migrations`.
+func (dbStore DBStorage) PendingMigrations(ctx context.Context) (int, error) {
+	var applied int
+	err := dbStore.PGXPool.QueryRow(ctx, "SELECT coalesce(max(version), 0) FROM schema_migrations").Scan(&applied)
+	if err != nil {
+		return len(dbMigrations), err
+	}
+	return max(len(dbMigrations)-applied, 0), nil
+}
@@ -0,0 +1,99 @@
+package storage
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// recentWrites remembers which users and short URLs were written recently, so
+// reads that must observe those writes can be routed to the primary until the
+// replicas have had time to catch up.
+type recentWrites struct {
+	mu        sync.Mutex
+	window    time.Duration
+	users     map[string]time.Time
+	shortURLs map[string]time.Time
+	lastPrune time.Time
+}
+
+// newRecentWrites creates a tracker that remembers writes for window.
+func newRecentWrites(window time.Duration) *recentWrites {
+	return &recentWrites{
+		window:    window,
+		users:     make(map[string]time.Time),
+		shortURLs: make(map[string]time.Time),
+		lastPrune: time.Now(),
+	}
+}
+
+// mark records a write by userID affecting the given short URLs.
+// It is a no-op on a nil tracker.
+func (rw *recentWrites) mark(userID string, shortURLs ...string) {
+	if rw == nil {
+		return
+	}
+	now := time.Now()
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+	if len(userID) > 0 {
+		rw.users[userID] = now
+	}
+	for _, shortURL := range shortURLs {
+		rw.shortURLs[shortURL] = now
+	}
+
+	if now.Sub(rw.lastPrune) < rw.window {
+		return
+	}
+	for key, at := range rw.users {
+		if now.Sub(at) >= rw.window {
+			delete(rw.users, key)
+		}
+	}
+	for key, at := range rw.shortURLs {
+		if now.Sub(at) >= rw.window {
+			delete(rw.shortURLs, key)
+		}
+	}
+	rw.lastPrune = now
+}
+
+// recent reports whether userID or shortURL was written within the window.
+// Empty arguments are ignored.
+func (rw *recentWrites) recent(userID string, shortURL string) bool {
+	now := time.Now()
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+	if at, ok := rw.users[userID]; ok && len(userID) > 0 && now.Sub(at) < rw.window {
+		return true
+	}
+	if at, ok := rw.shortURLs[shortURL]; ok && len(shortURL) > 0 && now.Sub(at) < rw.window {
+		return true
+	}
+	return false
+}
+
+// reader picks the pool for a read on behalf of userID and/or shortURL. It
+// returns the primary if there are no replicas or if either key was written
+// within ReplicaLagWindow, and otherwise rotates over the replicas.
+func (dbStore DBStorage) reader(userID string, shortURL string) *pgxpool.Pool {
+	if len(dbStore.Replicas) == 0 || dbStore.writes.recent(userID, shortURL) {
+		return dbStore.PGXPool
+	}
+	n := dbStore.nextReplica.Add(1)
+	return dbStore.Replicas[int(n%uint32(len(dbStore.Replicas)))]
+}
+
+// onReader runs read on the pool chosen by reader. If a replica turns out to be
+// unreachable, the read is repeated on the primary.
+func (dbStore DBStorage) onReader(ctx context.Context, userID string, shortURL string, read func(pool *pgxpool.Pool) error) error {
+	pool := dbStore.reader(userID, shortURL)
+	err := read(pool)
+	if pool != dbStore.PGXPool && isUnavailable(ctx, err) {
+		err = read(dbStore.PGXPool)
+	}
+	return err
+}
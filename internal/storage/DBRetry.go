@@ -0,0 +1,56 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"time"
+
+	"github.com/jackc/pgerrcode"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// retryMaxDelay caps the backoff between two attempts.
+const retryMaxDelay = 2 * time.Second
+
+// withRetry runs op up to attempts times while it fails with a transient error,
+// sleeping with exponential backoff and full jitter between attempts. It must
+// only be used for idempotent operations.
+func withRetry(ctx context.Context, attempts int, baseDelay time.Duration, op func() error) error {
+	var err error
+	for attempt := 0; ; attempt++ {
+		err = op()
+		if err == nil || attempt+1 >= attempts || !isRetryable(err) {
+			return err
+		}
+
+		backoff := min(baseDelay<<attempt, retryMaxDelay)
+		delay := time.Duration(rand.Int64N(int64(backoff) + 1))
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+	}
+}
+
+// isRetryable reports whether err is a transient failure worth retrying: a
+// failed connection, a serialization failure or deadlock, a server that is
+// shutting down or starting up, or an error pgconn knows happened before
+// anything was sent to the server.
+func isRetryable(err error) bool {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch pgErr.Code {
+		case pgerrcode.SerializationFailure, pgerrcode.DeadlockDetected,
+			pgerrcode.AdminShutdown, pgerrcode.CrashShutdown, pgerrcode.CannotConnectNow:
+			return true
+		}
+		return pgerrcode.IsConnectionException(pgErr.Code)
+	}
+	var connectErr *pgconn.ConnectError
+	if errors.As(err, &connectErr) {
+		return true
+	}
+	return pgconn.SafeToRetry(err)
+}
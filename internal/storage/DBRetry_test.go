@@ -0,0 +1,40 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgerrcode"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/scaranin/go-svc-short-url/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithRetry(t *testing.T) {
+	serialization := &pgconn.PgError{Code: pgerrcode.SerializationFailure}
+	tests := []struct {
+		name     string
+		attempts int
+		errs     []error
+		wantErr  error
+		wantRuns int
+	}{
+		{name: "success", attempts: 3, errs: []error{nil}, wantRuns: 1},
+		{name: "transient then success", attempts: 3, errs: []error{serialization, serialization, nil}, wantRuns: 3},
+		{name: "attempts exhausted", attempts: 2, errs: []error{serialization, serialization, nil}, wantErr: serialization, wantRuns: 2},
+		{name: "permanent error", attempts: 3, errs: []error{models.ErrDeleted, nil}, wantErr: models.ErrDeleted, wantRuns: 1},
+		{name: "retries disabled", attempts: -1, errs: []error{serialization, nil}, wantErr: serialization, wantRuns: 1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			runs := 0
+			err := withRetry(context.Background(), test.attempts, time.Millisecond, func() error {
+				runs++
+				return test.errs[runs-1]
+			})
+			assert.Equal(t, test.wantErr, err)
+			assert.Equal(t, test.wantRuns, runs)
+		})
+	}
+}
@@ -3,105 +3,277 @@ package storage
 import (
 	"context"
 	"errors"
-	"fmt"
+	"strconv"
+	"sync/atomic"
+	"time"
 
 	"github.com/jackc/pgerrcode"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/scaranin/go-svc-short-url/internal/logger"
 	"github.com/scaranin/go-svc-short-url/internal/models"
+	"go.uber.org/zap"
 )
 
 // DBStorageInterface defines the contract for a database-backed storage system.
 // It is intended to be implemented by structs that interact with a database,
 // but it is currently not fully utilized as the concrete type DBStorage is returned directly.
 type DBStorageInterface interface {
-	Save(URL *models.URL) (string, error)
-	Load(shortURL string) (string, error)
+	Save(ctx context.Context, URL *models.URL) (string, error)
+	Load(ctx context.Context, shortURL string) (string, error)
 	Ping(ctx context.Context) error
-	GetUserURLList(UserID string) ([]models.URLUserList, error)
+	GetUserURLList(ctx context.Context, UserID string) ([]models.URLUserList, error)
 	Close()
 }
 
 // DBStorage provides a PostgreSQL-backed implementation of the models.Storage interface.
-// It manages a connection pool to the database for all storage operations.
+// It manages a connection pool to the primary database for all writes and,
+// optionally, pools to read replicas that serve Load, GetUserURLList and GetStats.
 type DBStorage struct {
 	// DSN is the Data Source Name for the PostgreSQL connection.
 	DSN string
 	// PGXPool is the active connection pool to the database.
 	PGXPool *pgxpool.Pool
+	// Replicas are connection pools to read replicas of the database.
+	Replicas []*pgxpool.Pool
+	// ReplicaLagWindow is how long reads that depend on a write are kept on the
+	// primary after that write, to hide replication lag.
+	ReplicaLagWindow time.Duration
+	// RetryAttempts is the number of attempts made for idempotent reads that
+	// fail with a transient error.
+	RetryAttempts int
+	// RetryBaseDelay is the backoff before the second attempt; it doubles with
+	// every further attempt and is randomized with full jitter.
+	RetryBaseDelay time.Duration
+
+	writes      *recentWrites
+	nextReplica *atomic.Uint32
+}
+
+// DBOptions holds optional settings for CreateStoreDBWithOptions.
+type DBOptions struct {
+	// ReplicaDSNs are the Data Source Names of read replicas.
+	ReplicaDSNs []string
+	// ReplicaLagWindow is how long reads are kept on the primary after a write
+	// by the same user or to the same short URL.
+	ReplicaLagWindow time.Duration
+	// MaxConns is the maximum size of each pool. Zero keeps the pgxpool default.
+	MaxConns int32
+	// MinConns is the number of connections each pool keeps open.
+	MinConns int32
+	// MaxConnLifetime is how long a connection is reused before it is closed.
+	// Zero keeps the pgxpool default.
+	MaxConnLifetime time.Duration
+	// HealthCheckPeriod is how often idle connections are checked.
+	// Zero keeps the pgxpool default.
+	HealthCheckPeriod time.Duration
+	// StatementTimeout aborts statements running longer than this on the server.
+	// Zero disables the timeout.
+	StatementTimeout time.Duration
+	// RetryAttempts is the number of attempts for idempotent reads. Values below
+	// one mean a single attempt.
+	RetryAttempts int
+	// RetryBaseDelay is the initial backoff between read attempts.
+	RetryBaseDelay time.Duration
+}
+
+// poolConfig builds the pgxpool configuration for DSN with the pool settings from opts.
+func (opts DBOptions) poolConfig(DSN string) (*pgxpool.Config, error) {
+	cfg, err := pgxpool.ParseConfig(DSN)
+	if err != nil {
+		return nil, err
+	}
+	cfg.ConnConfig.Tracer = queryTracer{}
+	if opts.MaxConns > 0 {
+		cfg.MaxConns = opts.MaxConns
+	}
+	if opts.MinConns > 0 {
+		cfg.MinConns = opts.MinConns
+	}
+	if opts.MaxConnLifetime > 0 {
+		cfg.MaxConnLifetime = opts.MaxConnLifetime
+	}
+	if opts.HealthCheckPeriod > 0 {
+		cfg.HealthCheckPeriod = opts.HealthCheckPeriod
+	}
+	if opts.StatementTimeout > 0 {
+		cfg.ConnConfig.RuntimeParams["statement_timeout"] = strconv.FormatInt(opts.StatementTimeout.Milliseconds(), 10)
+	}
+	return cfg, nil
 }
 
 // Save inserts a new URL record into the `MAP_URL` table.
 // It includes the user's ID and sets the `is_deleted` flag to false.
-// It handles unique constraint violations on `original_url` by returning the
-// conflicting short URL and a specific `pgconn.PgError`, allowing the caller
-// to manage conflicts (e.g., by returning an HTTP 409 status).
-func (dbStore DBStorage) Save(URL *models.URL) (string, error) {
-	ctx := context.Background()
-	_, err := dbStore.PGXPool.Exec(ctx, "INSERT INTO MAP_URL(correlation_id, short_url, original_url, user_id, is_deleted) VALUES (@P_CORR_ID, @P_SHORT_URL, @P_ORIGINAL_URL, @P_USER_ID, false)",
-		pgx.NamedArgs{"P_CORR_ID": URL.CorrelationID, "P_SHORT_URL": URL.ShortURL, "P_ORIGINAL_URL": URL.OriginalURL, "P_USER_ID": URL.UserID},
+// It handles unique constraint violations on `original_url` or
+// `canonical_url` by returning the short URL of the existing record and a
+// specific `pgconn.PgError`, allowing the caller to manage conflicts (e.g., by
+// returning an HTTP 409 status). A record without a canonical URL, such as a
+// write spooled by an older version, is its own canonical form.
+// A successful insert is broadcast on the changes channel, so other instances
+// drop a cached miss for the new short URL.
+func (dbStore DBStorage) Save(ctx context.Context, URL *models.URL) (_ string, err error) {
+	ctx, span := startSpan(ctx, "DBStorage.Save")
+	defer func() { endSpan(span, err) }()
+	_, err = dbStore.PGXPool.Exec(ctx, `INSERT INTO MAP_URL(correlation_id, short_url, original_url, canonical_url, user_id, is_deleted,
+			redirect_status, forward_query, title, description, always_preview, password_hash, max_clicks, clicks, not_before, expires_at, targets, variants)
+		VALUES (@P_CORR_ID, @P_SHORT_URL, @P_ORIGINAL_URL, coalesce(nullif(@P_CANONICAL_URL, ''), @P_ORIGINAL_URL), @P_USER_ID, false,
+			@P_REDIRECT_STATUS, @P_FORWARD_QUERY, @P_TITLE, @P_DESCRIPTION, @P_ALWAYS_PREVIEW, @P_PASSWORD_HASH, @P_MAX_CLICKS, @P_CLICKS, @P_NOT_BEFORE, @P_EXPIRES_AT, @P_TARGETS, @P_VARIANTS)`,
+		linkOptionArgs(URL, pgx.NamedArgs{"P_CORR_ID": URL.CorrelationID, "P_SHORT_URL": URL.ShortURL, "P_ORIGINAL_URL": URL.OriginalURL, "P_CANONICAL_URL": URL.CanonicalURL, "P_USER_ID": URL.UserID}),
 	)
 	if pgErr, ok := err.(*pgconn.PgError); ok {
 		if pgErr.Code == pgerrcode.UniqueViolation {
-			return URL.ShortURL, pgErr
+			return dbStore.existingShortURL(ctx, URL), pgErr
+		}
+	}
+	if err == nil {
+		dbStore.writes.mark(URL.UserID, URL.ShortURL)
+		if notifyErr := notifyChanged(ctx, dbStore.PGXPool, "save", []string{URL.ShortURL}); notifyErr != nil {
+			logger.FromContext(ctx).Warn("change notification failed", zap.Error(notifyErr))
 		}
 	}
 	return URL.ShortURL, err
 }
 
-// Load retrieves the original URL from the database.
+// existingShortURL returns the short URL of the record that made URL violate
+// a unique index, or URL.ShortURL if it cannot be found.
+func (dbStore DBStorage) existingShortURL(ctx context.Context, URL *models.URL) string {
+	canonicalURL := URL.CanonicalURL
+	if len(canonicalURL) == 0 {
+		canonicalURL = URL.OriginalURL
+	}
+	var shortURL string
+	err := dbStore.PGXPool.QueryRow(ctx, "select short_url from MAP_URL WHERE canonical_url = @P_CANONICAL_URL OR original_url = @P_ORIGINAL_URL LIMIT 1",
+		pgx.NamedArgs{"P_CANONICAL_URL": canonicalURL, "P_ORIGINAL_URL": URL.OriginalURL},
+	).Scan(&shortURL)
+	if err != nil {
+		return URL.ShortURL
+	}
+	return shortURL
+}
+
+// Load retrieves the original URL from a replica, or from the primary if the
+// short URL was written within ReplicaLagWindow. Transient failures are retried.
 // It also checks if the URL has been marked as deleted. If the `is_deleted` flag
-// is true, it returns a specific sentinel error `errors.New("ROW_IS_DELETED")`,
+// is true, it returns the sentinel error `models.ErrDeleted`,
 // which allows the caller (handler) to return an HTTP 410 Gone status.
-func (dbStore DBStorage) Load(shortURL string) (string, error) {
-	ctx := context.Background()
-	row := dbStore.PGXPool.QueryRow(ctx, "select original_url, is_deleted from MAP_URL WHERE short_url = @P_SHORT_URL",
-		pgx.NamedArgs{"P_SHORT_URL": shortURL},
-	)
+func (dbStore DBStorage) Load(ctx context.Context, shortURL string) (string, error) {
+	URL, err := dbStore.LoadURL(ctx, shortURL)
+	return URL.OriginalURL, err
+}
 
-	var originalURL string
-	isDeleted := false
-	err := row.Scan(&originalURL, &isDeleted)
-	if err != nil {
-		return originalURL, err
+// LoadURL works like Load but returns the whole record, including its link options.
+// An unknown short URL yields models.ErrNotFound.
+func (dbStore DBStorage) LoadURL(ctx context.Context, shortURL string) (_ models.URL, err error) {
+	ctx, span := startSpan(ctx, "DBStorage.Load")
+	defer func() { endSpan(span, err) }()
+	URL := models.URL{ShortURL: shortURL}
+	err = dbStore.retry(ctx, func() error {
+		return dbStore.onReader(ctx, "", shortURL, func(pool *pgxpool.Pool) error {
+			row := pool.QueryRow(ctx, `select original_url, coalesce(canonical_url, original_url), coalesce(user_id, ''), coalesce(is_deleted, false), `+linkOptionColumns+`
+				from MAP_URL WHERE short_url = @P_SHORT_URL`,
+				pgx.NamedArgs{"P_SHORT_URL": shortURL},
+			)
+			return row.Scan(append([]any{&URL.OriginalURL, &URL.CanonicalURL, &URL.UserID, &URL.IsDeleted}, linkOptionDest(&URL)...)...)
+		})
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return URL, models.ErrNotFound
 	}
-	if isDeleted {
-		err = errors.New("ROW_IS_DELETED")
+	if err != nil {
+		return URL, err
 	}
-	return originalURL, err
+	return URL, linkState(URL)
 }
 
-// Ping verifies the connection to the database is active.
-func (dbStore DBStorage) Ping(ctx context.Context) error {
-	return dbStore.PGXPool.Ping(ctx)
+// RecordClick implements the models.Storage interface with a conditional
+// update on the primary, so concurrent redirects cannot exceed max_clicks.
+// The click of a variant is added to `variant_clicks` in the same
+// transaction. A URL without max_clicks is not counted.
+func (dbStore DBStorage) RecordClick(ctx context.Context, shortURL string, variant string) (err error) {
+	ctx, span := startSpan(ctx, "DBStorage.RecordClick")
+	defer func() { endSpan(span, err) }()
+	args := pgx.NamedArgs{"P_SHORT_URL": shortURL, "P_VARIANT": variant}
+	var maxClicks int
+	err = pgx.BeginFunc(ctx, dbStore.PGXPool, func(tx pgx.Tx) error {
+		err := tx.QueryRow(ctx, `UPDATE MAP_URL SET clicks = clicks + CASE WHEN max_clicks > 0 THEN 1 ELSE 0 END
+			WHERE short_url = @P_SHORT_URL AND NOT coalesce(is_deleted, false) AND (max_clicks = 0 OR clicks < max_clicks)
+			RETURNING max_clicks`, args,
+		).Scan(&maxClicks)
+		if err != nil || len(variant) == 0 {
+			return err
+		}
+		_, err = tx.Exec(ctx, `INSERT INTO variant_clicks(short_url, variant, clicks) VALUES (@P_SHORT_URL, @P_VARIANT, 1)
+			ON CONFLICT (short_url, variant) DO UPDATE SET clicks = variant_clicks.clicks + 1`, args)
+		return err
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.ErrClicksExhausted
+	}
+	if err == nil && maxClicks > 0 {
+		dbStore.writes.mark("", shortURL)
+	}
+	return err
 }
 
-// GetUserURLList fetches all non-deleted URLs associated with a specific UserID.
-// It queries the database and populates a slice of `models.URLUserList`.
-func (dbStore DBStorage) GetUserURLList(UserID string) ([]models.URLUserList, error) {
-	ctx := context.Background()
-	rows, err := dbStore.PGXPool.Query(ctx, "select short_url, original_url from MAP_URL WHERE user_id = @P_USER_ID",
-		pgx.NamedArgs{"P_USER_ID": UserID},
+// UpdateVariants implements the models.Storage interface. It replaces the
+// variants of a non-deleted short URL owned by UserID and broadcasts the
+// change on the changes channel.
+func (dbStore DBStorage) UpdateVariants(ctx context.Context, UserID string, shortURL string, variants []models.Variant) (err error) {
+	ctx, span := startSpan(ctx, "DBStorage.UpdateVariants")
+	defer func() { endSpan(span, err) }()
+	tag, err := dbStore.PGXPool.Exec(ctx, `UPDATE MAP_URL SET variants = @P_VARIANTS
+		WHERE short_url = @P_SHORT_URL AND user_id = @P_USER_ID AND NOT coalesce(is_deleted, false)`,
+		pgx.NamedArgs{"P_SHORT_URL": shortURL, "P_USER_ID": UserID, "P_VARIANTS": variants},
 	)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	defer rows.Close()
+	if tag.RowsAffected() == 0 {
+		return models.ErrNotOwned
+	}
+	dbStore.writes.mark(UserID, shortURL)
+	return notifyChanged(ctx, dbStore.PGXPool, "update", []string{shortURL})
+}
 
+// Ping implements the models.Pinger interface. It verifies the connection to
+// the primary database is active.
+func (dbStore DBStorage) Ping(ctx context.Context) error {
+	return dbStore.PGXPool.Ping(ctx)
+}
+
+// GetUserURLList fetches all non-deleted URLs associated with a specific UserID.
+// It queries a replica, or the primary if the user wrote within ReplicaLagWindow,
+// and populates a slice of `models.URLUserList`. Transient failures are retried.
+func (dbStore DBStorage) GetUserURLList(ctx context.Context, UserID string) (_ []models.URLUserList, err error) {
+	ctx, span := startSpan(ctx, "DBStorage.GetUserURLList")
+	defer func() { endSpan(span, err) }()
 	var URLlist []models.URLUserList
+	err = dbStore.retry(ctx, func() error {
+		return dbStore.onReader(ctx, UserID, "", func(pool *pgxpool.Pool) error {
+			URLlist = nil
+			rows, err := pool.Query(ctx, "select short_url, original_url from MAP_URL WHERE user_id = @P_USER_ID",
+				pgx.NamedArgs{"P_USER_ID": UserID},
+			)
+			if err != nil {
+				return err
+			}
+			defer rows.Close()
 
-	for rows.Next() {
-		var URLlistItem models.URLUserList
+			for rows.Next() {
+				var URLlistItem models.URLUserList
 
-		err = rows.Scan(&URLlistItem.ShortURL, &URLlistItem.OriginalURL)
-		if err != nil {
-			return nil, err
-		}
-		URLlist = append(URLlist, URLlistItem)
-	}
+				err = rows.Scan(&URLlistItem.ShortURL, &URLlistItem.OriginalURL)
+				if err != nil {
+					return err
+				}
+				URLlist = append(URLlist, URLlistItem)
+			}
 
-	if err = rows.Err(); err != nil {
+			return rows.Err()
+		})
+	})
+	if err != nil {
 		return nil, err
 	}
 
@@ -112,8 +284,10 @@ func (dbStore DBStorage) GetUserURLList(UserID string) ([]models.URLUserList, er
 // It sets the `is_deleted` flag to true for the given short URLs. The entire
 // operation is performed within a single database transaction for atomicity: either
 // all URLs are marked for deletion, or none are if an error occurs.
-func (dbStore DBStorage) DeleteBulk(UserID string, ShortURLs []string) error {
-	ctx := context.Background()
+// The deletions are broadcast on the changes channel when the transaction commits.
+func (dbStore DBStorage) DeleteBulk(ctx context.Context, UserID string, ShortURLs []string) (err error) {
+	ctx, span := startSpan(ctx, "DBStorage.DeleteBulk")
+	defer func() { endSpan(span, err) }()
 	tx, err := dbStore.PGXPool.Begin(ctx)
 	if err != nil {
 		return err
@@ -125,69 +299,162 @@ func (dbStore DBStorage) DeleteBulk(UserID string, ShortURLs []string) error {
 	}
 
 	for _, ShortURL := range ShortURLs {
-		fmt.Println(ShortURL, UserID)
 		_, err := tx.Exec(ctx, "SetIsDeleted", ShortURL, UserID)
 		if err != nil {
 			return err
 		}
 	}
 
-	return tx.Commit(ctx)
+	if err = notifyChanged(ctx, tx, "delete", ShortURLs); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return err
+	}
+	dbStore.writes.mark(UserID, ShortURLs...)
+	return nil
 }
 
 // GetStats retrieves storage statistics from the database, including the total number of users
-// and the number of unique short URLs.
+// and the number of unique short URLs. Statistics tolerate replication lag, so they
+// are always read from a replica when one is configured. Transient failures are retried.
 //
 // Returns:
 //   - models.Statistic: a struct containing count Users and URLs
 //   - error: an error
-func (dbStore DBStorage) GetStats() (models.Statistic, error) {
-	ctx := context.Background()
+func (dbStore DBStorage) GetStats(ctx context.Context) (_ models.Statistic, err error) {
+	ctx, span := startSpan(ctx, "DBStorage.GetStats")
+	defer func() { endSpan(span, err) }()
 	sqlStmt := `SELECT 
     (SELECT COUNT(user_id) FROM users) AS users_count,
     (SELECT COUNT(distinct short_url) FROM map_url) AS map_url_count`
-	row := dbStore.PGXPool.QueryRow(ctx, sqlStmt)
-
 	var stat models.Statistic
-
-	err := row.Scan(&stat.Users, &stat.URLs)
+	err = dbStore.retry(ctx, func() error {
+		return dbStore.onReader(ctx, "", "", func(pool *pgxpool.Pool) error {
+			return pool.QueryRow(ctx, sqlStmt).Scan(&stat.Users, &stat.URLs)
+		})
+	})
 	return stat, err
 }
 
-// CreateDBScheme sets up the necessary database schema.
-// It creates the `MAP_URL` table and a `UNIQUE INDEX` on `original_url`.
-// The method is idempotent, meaning it can be run multiple times without causing
-// errors if the schema already exists, as it checks for `DuplicateTable` errors.
-func (dbStore DBStorage) CreateDBScheme(ctx context.Context) error {
-	_, err := dbStore.PGXPool.Exec(ctx, `CREATE TABLE MAP_URL (
-		"correlation_id" TEXT,
-        "short_url" TEXT,
-		"original_url" TEXT,
-		"user_id" TEXT,
-		"is_deleted" BOOL
-      )`)
-	if pgErr, ok := err.(*pgconn.PgError); ok {
-		if pgErr.Code == pgerrcode.DuplicateTable {
-			err = nil
+// ExportURLs implements the models.Exporter interface. It pages through `MAP_URL`
+// in short URL order, returning deleted rows as well.
+func (dbStore DBStorage) ExportURLs(after string, limit int) ([]models.URL, error) {
+	ctx := context.Background()
+	rows, err := dbStore.PGXPool.Query(ctx, `select coalesce(correlation_id, ''), short_url, original_url, coalesce(canonical_url, original_url), coalesce(user_id, ''), coalesce(is_deleted, false),
+		`+linkOptionColumns+`
+		from MAP_URL WHERE short_url > @P_AFTER ORDER BY short_url LIMIT @P_LIMIT`,
+		pgx.NamedArgs{"P_AFTER": after, "P_LIMIT": limit},
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var URLs []models.URL
+	for rows.Next() {
+		var URL models.URL
+		err = rows.Scan(append([]any{&URL.CorrelationID, &URL.ShortURL, &URL.OriginalURL, &URL.CanonicalURL, &URL.UserID, &URL.IsDeleted}, linkOptionDest(&URL)...)...)
+		if err != nil {
+			return nil, err
 		}
+		URLs = append(URLs, URL)
 	}
-	if err == nil {
-		_, err = dbStore.PGXPool.Exec(ctx, `CREATE UNIQUE INDEX idx_original_url ON MAP_URL(original_url)`)
-		if pgErr, ok := err.(*pgconn.PgError); ok {
-			if pgErr.Code == pgerrcode.DuplicateTable {
-				err = nil
-			}
+	return URLs, rows.Err()
+}
+
+// ImportURL implements the models.Importer interface. It inserts the record or,
+// if the original URL is already present, overwrites its owner and deletion flag.
+// A record whose canonical URL belongs to another original URL is already
+// present in another spelling and is skipped.
+// The change is broadcast on the changes channel.
+func (dbStore DBStorage) ImportURL(URL *models.URL) error {
+	ctx := context.Background()
+	_, err := dbStore.PGXPool.Exec(ctx, `INSERT INTO MAP_URL(correlation_id, short_url, original_url, canonical_url, user_id, is_deleted,
+			redirect_status, forward_query, title, description, always_preview, password_hash, max_clicks, clicks, not_before, expires_at, targets, variants)
+		VALUES (@P_CORR_ID, @P_SHORT_URL, @P_ORIGINAL_URL, coalesce(nullif(@P_CANONICAL_URL, ''), @P_ORIGINAL_URL), @P_USER_ID, @P_IS_DELETED,
+			@P_REDIRECT_STATUS, @P_FORWARD_QUERY, @P_TITLE, @P_DESCRIPTION, @P_ALWAYS_PREVIEW, @P_PASSWORD_HASH, @P_MAX_CLICKS, @P_CLICKS, @P_NOT_BEFORE, @P_EXPIRES_AT, @P_TARGETS, @P_VARIANTS)
+		ON CONFLICT (original_url) DO UPDATE SET short_url = EXCLUDED.short_url, canonical_url = EXCLUDED.canonical_url,
+			user_id = EXCLUDED.user_id, is_deleted = EXCLUDED.is_deleted,
+			redirect_status = EXCLUDED.redirect_status, forward_query = EXCLUDED.forward_query,
+			title = EXCLUDED.title, description = EXCLUDED.description, always_preview = EXCLUDED.always_preview,
+			password_hash = EXCLUDED.password_hash, max_clicks = EXCLUDED.max_clicks, clicks = EXCLUDED.clicks,
+			not_before = EXCLUDED.not_before, expires_at = EXCLUDED.expires_at, targets = EXCLUDED.targets, variants = EXCLUDED.variants`,
+		linkOptionArgs(URL, pgx.NamedArgs{"P_CORR_ID": URL.CorrelationID, "P_SHORT_URL": URL.ShortURL, "P_ORIGINAL_URL": URL.OriginalURL, "P_CANONICAL_URL": URL.CanonicalURL, "P_USER_ID": URL.UserID, "P_IS_DELETED": URL.IsDeleted}),
+	)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == pgerrcode.UniqueViolation && pgErr.ConstraintName == "idx_canonical_url" {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for variant, clicks := range URL.VariantClicks {
+		_, err = dbStore.PGXPool.Exec(ctx, `INSERT INTO variant_clicks(short_url, variant, clicks) VALUES (@P_SHORT_URL, @P_VARIANT, @P_CLICKS)
+			ON CONFLICT (short_url, variant) DO UPDATE SET clicks = EXCLUDED.clicks`,
+			pgx.NamedArgs{"P_SHORT_URL": URL.ShortURL, "P_VARIANT": variant, "P_CLICKS": clicks},
+		)
+		if err != nil {
+			return err
 		}
 	}
-	return err
+	dbStore.writes.mark(URL.UserID, URL.ShortURL)
+	return notifyChanged(ctx, dbStore.PGXPool, "save", []string{URL.ShortURL})
+}
+
+// linkOptionColumns are the `MAP_URL` columns holding models.LinkOptions, the
+// password hash and the click counts, in the order of linkOptionDest. The
+// clicks of the variants are aggregated from `variant_clicks`.
+const linkOptionColumns = `redirect_status, forward_query, title, description, always_preview, password_hash, max_clicks, clicks, not_before, expires_at, targets, variants,
+	(SELECT jsonb_object_agg(variant, clicks) FROM variant_clicks WHERE variant_clicks.short_url = MAP_URL.short_url)`
+
+// linkOptionDest returns the scan destinations of linkOptionColumns in URL.
+func linkOptionDest(URL *models.URL) []any {
+	return []any{&URL.RedirectStatus, &URL.ForwardQuery, &URL.Title, &URL.Description, &URL.AlwaysPreview, &URL.PasswordHash, &URL.MaxClicks, &URL.Clicks, &URL.NotBefore, &URL.ExpiresAt, &URL.Targets, &URL.Variants, &URL.VariantClicks}
+}
+
+// linkOptionArgs adds the link options of URL to the named arguments args.
+func linkOptionArgs(URL *models.URL, args pgx.NamedArgs) pgx.NamedArgs {
+	args["P_REDIRECT_STATUS"] = URL.RedirectStatus
+	args["P_FORWARD_QUERY"] = URL.ForwardQuery
+	args["P_TITLE"] = URL.Title
+	args["P_DESCRIPTION"] = URL.Description
+	args["P_ALWAYS_PREVIEW"] = URL.AlwaysPreview
+	args["P_PASSWORD_HASH"] = URL.PasswordHash
+	args["P_MAX_CLICKS"] = URL.MaxClicks
+	args["P_CLICKS"] = URL.Clicks
+	args["P_NOT_BEFORE"] = URL.NotBefore
+	args["P_EXPIRES_AT"] = URL.ExpiresAt
+	args["P_TARGETS"] = URL.Targets
+	args["P_VARIANTS"] = URL.Variants
+	return args
 }
 
 // CreateStoreDB is a factory function that initializes and returns a new DBStorage instance.
-// It establishes a connection pool, pings the database, and ensures the schema is created.
+// It establishes a connection pool, pings the database, and applies pending schema migrations.
 func CreateStoreDB(DSN string) (DBStorage, error) {
-	var dbStore DBStorage
+	return CreateStoreDBWithOptions(DSN, DBOptions{})
+}
+
+// CreateStoreDBWithOptions works like CreateStoreDB, applies the pool and retry
+// settings from opts and additionally connects to the read replicas listed in
+// opts. Replicas are created lazily by pgxpool, so an unreachable replica does
+// not prevent startup; reads fall back to the primary.
+func CreateStoreDBWithOptions(DSN string, opts DBOptions) (DBStorage, error) {
+	dbStore := DBStorage{
+		DSN:              DSN,
+		ReplicaLagWindow: opts.ReplicaLagWindow,
+		RetryAttempts:    opts.RetryAttempts,
+		RetryBaseDelay:   opts.RetryBaseDelay,
+		nextReplica:      &atomic.Uint32{},
+	}
 	ctx := context.Background()
-	pool, err := pgxpool.New(ctx, DSN)
+	poolConfig, err := opts.poolConfig(DSN)
+	if err != nil {
+		return dbStore, err
+	}
+	pool, err := pgxpool.NewWithConfig(ctx, poolConfig)
 	if err != nil {
 		return dbStore, err
 	}
@@ -202,12 +469,37 @@ func CreateStoreDB(DSN string) (DBStorage, error) {
 	if err != nil {
 		return dbStore, err
 	}
+
+	for _, replicaDSN := range opts.ReplicaDSNs {
+		poolConfig, err := opts.poolConfig(replicaDSN)
+		if err != nil {
+			dbStore.Close()
+			return dbStore, err
+		}
+		replica, err := pgxpool.NewWithConfig(ctx, poolConfig)
+		if err != nil {
+			dbStore.Close()
+			return dbStore, err
+		}
+		dbStore.Replicas = append(dbStore.Replicas, replica)
+	}
+	if len(dbStore.Replicas) > 0 {
+		dbStore.writes = newRecentWrites(opts.ReplicaLagWindow)
+	}
 	return dbStore, err
 }
 
-// Close gracefully closes the database connection pool.
+// retry runs an idempotent read with the configured retry policy.
+func (dbStore DBStorage) retry(ctx context.Context, op func() error) error {
+	return withRetry(ctx, dbStore.RetryAttempts, dbStore.RetryBaseDelay, op)
+}
+
+// Close gracefully closes the database connection pools.
 func (dbStore *DBStorage) Close() {
 	if dbStore.PGXPool != nil {
 		dbStore.PGXPool.Close()
 	}
+	for _, replica := range dbStore.Replicas {
+		replica.Close()
+	}
 }
@@ -0,0 +1,60 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/jackc/pgerrcode"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/scaranin/go-svc-short-url/internal/models"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer starts the spans of the storage package.
+var tracer = otel.Tracer("github.com/scaranin/go-svc-short-url/internal/storage")
+
+// startSpan starts a span named name as a child of the span in ctx.
+func startSpan(ctx context.Context, name string) (context.Context, trace.Span) {
+	return tracer.Start(ctx, name, trace.WithAttributes(semconv.DBSystemPostgreSQL))
+}
+
+// endSpan records err on span, unless it is a regular outcome such as a missing
+// row, a deleted URL or an already shortened URL, and ends the span.
+func endSpan(span trace.Span, err error) {
+	var pgErr *pgconn.PgError
+	regular := errors.Is(err, pgx.ErrNoRows) || errors.Is(err, models.ErrNotFound) || errors.Is(err, models.ErrDeleted) || errors.Is(err, models.ErrConflict) ||
+		(errors.As(err, &pgErr) && pgErr.Code == pgerrcode.UniqueViolation)
+	if err != nil && !regular {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// queryTracer is a pgx.QueryTracer that wraps every SQL statement in a client
+// span, so traces show the individual Postgres round trips.
+type queryTracer struct{}
+
+// TraceQueryStart implements the pgx.QueryTracer interface.
+func (queryTracer) TraceQueryStart(ctx context.Context, conn *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	operation, _, _ := strings.Cut(strings.TrimSpace(data.SQL), " ")
+	ctx, _ = tracer.Start(ctx, "postgres "+strings.ToUpper(operation),
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.DBSystemPostgreSQL,
+			semconv.DBQueryText(data.SQL),
+			semconv.ServerAddress(conn.Config().Host),
+		),
+	)
+	return ctx
+}
+
+// TraceQueryEnd implements the pgx.QueryTracer interface.
+func (queryTracer) TraceQueryEnd(ctx context.Context, conn *pgx.Conn, data pgx.TraceQueryEndData) {
+	endSpan(trace.SpanFromContext(ctx), data.Err)
+}
@@ -1,59 +1,168 @@
 package storage
 
 import (
+	"context"
 	"io"
-	"log"
+	"maps"
+	"sort"
+	"sync"
 
 	"github.com/scaranin/go-svc-short-url/internal/models"
+	"go.uber.org/zap"
 )
 
 // FileStorageJSON provides an implementation of the models.Storage interface that
 // uses a JSON file for persistence and an in-memory map for fast lookups.
 // It can also be configured to operate in a purely in-memory mode.
+//
+// The file is an append-only log of URL records: updates such as deletions are
+// written as a new copy of the record, and the latest copy wins when the file is
+// read back on startup.
 type FileStorageJSON struct {
 	// Producer handles writing new URL entries to the persistence file.
 	Producer *models.Producer
 	// Consumer handles reading URL entries from the persistence file during startup.
 	Consumer *models.Consumer
-	// URLMap serves as a cache or the primary in-memory store for all URL lookups.
-	URLMap map[string]string
+	// URLMap serves as a cache or the primary in-memory store for all URL records,
+	// keyed by short URL.
+	URLMap map[string]models.URL
 	// INMemory is a flag that, when true, disables all file writing operations,
 	// making the storage ephemeral.
 	INMemory bool
+
+	mu *sync.RWMutex
 }
 
 // Save implements the models.Storage interface. It writes the URL to the
 // persistence file (if persistence is enabled) and always adds the URL to the
-// internal in-memory map for immediate availability.
-func (fs FileStorageJSON) Save(URL *models.URL) (string, error) {
+// internal in-memory map for immediate availability. If the short URL already
+// exists, it keeps the existing record and returns the short URL with
+// models.ErrConflict.
+func (fs FileStorageJSON) Save(ctx context.Context, URL *models.URL) (string, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if _, ok := fs.URLMap[URL.ShortURL]; ok {
+		return URL.ShortURL, models.ErrConflict
+	}
+	return URL.ShortURL, fs.put(URL)
+}
+
+// put writes the record to the file and the in-memory map. The caller must hold fs.mu.
+func (fs FileStorageJSON) put(URL *models.URL) error {
 	var err error
 	if !fs.INMemory {
 		err = fs.Producer.AddURL(URL)
 	}
-	fs.URLMap[URL.ShortURL] = URL.OriginalURL
-	return URL.ShortURL, err
+	fs.URLMap[URL.ShortURL] = *URL
+	return err
 }
 
 // Load implements the models.Storage interface. It retrieves the original URL
 // by looking it up in the internal in-memory map. It returns an empty string
-// if the short URL is not found.
-func (fs FileStorageJSON) Load(shortURL string) (string, error) {
-	originalURL := fs.URLMap[shortURL]
-	return originalURL, nil
+// if the short URL is not found and models.ErrDeleted if it has been deleted.
+func (fs FileStorageJSON) Load(ctx context.Context, shortURL string) (string, error) {
+	URL, err := fs.LoadURL(ctx, shortURL)
+	return URL.OriginalURL, err
+}
+
+// LoadURL implements the models.Storage interface. It returns the record from
+// the in-memory map, or a zero record if the short URL is not found.
+func (fs FileStorageJSON) LoadURL(ctx context.Context, shortURL string) (models.URL, error) {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+	URL := fs.URLMap[shortURL]
+	return URL, linkState(URL)
+}
+
+// RecordClick implements the models.Storage interface. The click counts are
+// checked and incremented under the lock, and the updated record is appended
+// to the file.
+func (fs FileStorageJSON) RecordClick(ctx context.Context, shortURL string, variant string) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	URL, ok := fs.URLMap[shortURL]
+	if !ok || (URL.MaxClicks == 0 && len(variant) == 0) {
+		return nil
+	}
+	if err := linkState(URL); err != nil {
+		return err
+	}
+	countClick(&URL, variant)
+	return fs.put(&URL)
+}
+
+// UpdateVariants implements the models.Storage interface. The updated record
+// is appended to the file.
+func (fs FileStorageJSON) UpdateVariants(ctx context.Context, UserID string, shortURL string, variants []models.Variant) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	URL, ok := fs.URLMap[shortURL]
+	if !ok || URL.UserID != UserID || URL.IsDeleted {
+		return models.ErrNotOwned
+	}
+	URL.Variants = variants
+	return fs.put(&URL)
+}
+
+// countClick adds a redirect to variant to the click counts of URL. The
+// variant counts are copied first, as the map may be shared with readers.
+func countClick(URL *models.URL, variant string) {
+	if URL.MaxClicks > 0 {
+		URL.Clicks++
+	}
+	if len(variant) > 0 {
+		URL.VariantClicks = maps.Clone(URL.VariantClicks)
+		if URL.VariantClicks == nil {
+			URL.VariantClicks = make(map[string]int)
+		}
+		URL.VariantClicks[variant]++
+	}
+}
+
+// linkState returns the error Load reports for URL: models.ErrDeleted for a
+// deleted URL and models.ErrClicksExhausted for one that may not be followed
+// any more.
+func linkState(URL models.URL) error {
+	switch {
+	case URL.IsDeleted:
+		return models.ErrDeleted
+	case URL.Exhausted():
+		return models.ErrClicksExhausted
+	}
+	return nil
 }
 
-// GetUserURLList is a stub implementation to satisfy the models.Storage interface.
-// This file-based storage type does not support user-specific data,
-// so it always returns an empty list and no error.
-func (fs FileStorageJSON) GetUserURLList(UserID string) ([]models.URLUserList, error) {
+// GetUserURLList implements the models.Storage interface. It returns every
+// non-deleted URL owned by UserID. Records written before owners were persisted
+// have no owner and are never returned.
+func (fs FileStorageJSON) GetUserURLList(ctx context.Context, UserID string) ([]models.URLUserList, error) {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
 	var URLList []models.URLUserList
+	for _, URL := range fs.URLMap {
+		if URL.UserID == UserID && !URL.IsDeleted {
+			URLList = append(URLList, models.URLUserList{ShortURL: URL.ShortURL, OriginalURL: URL.OriginalURL})
+		}
+	}
 	return URLList, nil
 }
 
-// DeleteBulk is a stub implementation to satisfy the models.Storage interface.
-// In this file-based storage, URLs are not marked as deleted. This method is
-// a no-op (no operation) and always returns nil.
-func (fs FileStorageJSON) DeleteBulk(UserID string, ShortURLs []string) error {
+// DeleteBulk implements the models.Storage interface. It marks the given short
+// URLs owned by UserID as deleted and appends the updated records to the file.
+// URLs that do not exist or belong to another user are skipped.
+func (fs FileStorageJSON) DeleteBulk(ctx context.Context, UserID string, ShortURLs []string) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	for _, ShortURL := range ShortURLs {
+		URL, ok := fs.URLMap[ShortURL]
+		if !ok || URL.UserID != UserID || URL.IsDeleted {
+			continue
+		}
+		URL.IsDeleted = true
+		if err := fs.put(&URL); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
@@ -62,26 +171,66 @@ func (fs FileStorageJSON) DeleteBulk(UserID string, ShortURLs []string) error {
 //
 // Returns:
 //   - models.Statistic: a struct containing Users (number of users) and URLs (number of URLs)
-func (fs FileStorageJSON) GetStats() (models.Statistic, error) {
+func (fs FileStorageJSON) GetStats(ctx context.Context) (models.Statistic, error) {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
 	var stat models.Statistic
 	stat.Users = 0
 	stat.URLs = len(fs.URLMap)
 	return stat, nil
 }
 
+// ExportURLs implements the models.Exporter interface. It returns up to limit
+// records, including deleted ones, whose short URL sorts after the given one.
+func (fs FileStorageJSON) ExportURLs(after string, limit int) ([]models.URL, error) {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+	keys := make([]string, 0, len(fs.URLMap))
+	for key := range fs.URLMap {
+		if key > after {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	if len(keys) > limit {
+		keys = keys[:limit]
+	}
+
+	URLs := make([]models.URL, 0, len(keys))
+	for _, key := range keys {
+		URLs = append(URLs, fs.URLMap[key])
+	}
+	return URLs, nil
+}
+
+// ImportURL implements the models.Importer interface. It stores the record as is,
+// overwriting any existing record with the same short URL.
+func (fs FileStorageJSON) ImportURL(URL *models.URL) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	return fs.put(URL)
+}
+
+// Ping implements the models.Pinger interface. The records are held in memory,
+// so the storage is always reachable.
+func (fs FileStorageJSON) Ping(ctx context.Context) error {
+	return nil
+}
+
 // GetDataFromFile reads all URL records from the provided consumer and populates an in-memory map.
 // It is a helper function used during initialization to load existing data from a file.
-func GetDataFromFile(consumer *models.Consumer) map[string]string {
-	urlMap := make(map[string]string)
+// When a short URL occurs several times, the last record wins.
+func GetDataFromFile(consumer *models.Consumer) map[string]models.URL {
+	urlMap := make(map[string]models.URL)
 	for {
 		mURL, err := consumer.GetURL()
 		if err == io.EOF {
 			break
 		}
 		if err != nil {
-			log.Fatal(err)
+			zap.L().Fatal("read storage file", zap.Error(err))
 		}
-		urlMap[mURL.ShortURL] = mURL.OriginalURL
+		urlMap[mURL.ShortURL] = *mURL
 	}
 	return urlMap
 }
@@ -92,7 +241,8 @@ func GetDataFromFile(consumer *models.Consumer) map[string]string {
 // and then calls GetDataFromFile to pre-load all existing data into the in-memory map.
 func CreateStoreFile(fileStoragePath string) (FileStorageJSON, error) {
 	var fs FileStorageJSON
-	fs.URLMap = make(map[string]string)
+	fs.URLMap = make(map[string]models.URL)
+	fs.mu = &sync.RWMutex{}
 
 	if len(fileStoragePath) == 0 {
 		fs.INMemory = true
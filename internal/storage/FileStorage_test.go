@@ -0,0 +1,51 @@
+package storage
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/scaranin/go-svc-short-url/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileStorage_SaveConflict(t *testing.T) {
+	tests := []struct {
+		name     string
+		existing models.URL
+	}{
+		{
+			name:     "password",
+			existing: models.URL{ShortURL: "protected", OriginalURL: "https://protected.example", UserID: "u1", PasswordHash: "$2a$10$hash"},
+		},
+		{
+			name:     "clicks",
+			existing: models.URL{ShortURL: "limited", OriginalURL: "https://limited.example", UserID: "u1", Clicks: 1, LinkOptions: models.LinkOptions{MaxClicks: 1}},
+		},
+		{
+			name:     "deleted",
+			existing: models.URL{ShortURL: "deleted", OriginalURL: "https://deleted.example", UserID: "u1", IsDeleted: true},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			path := filepath.Join(t.TempDir(), "links.json")
+			fs, err := CreateStoreFile(path)
+			require.NoError(t, err)
+			require.NoError(t, fs.ImportURL(&tt.existing))
+
+			shortURL, err := fs.Save(ctx, &models.URL{ShortURL: tt.existing.ShortURL, OriginalURL: tt.existing.OriginalURL, UserID: "u2"})
+			assert.ErrorIs(t, err, models.ErrConflict)
+			assert.Equal(t, tt.existing.ShortURL, shortURL)
+			assert.Equal(t, tt.existing, fs.URLMap[tt.existing.ShortURL], "the existing record is kept")
+			fs.Close()
+
+			reopened, err := CreateStoreFile(path)
+			require.NoError(t, err)
+			defer reopened.Close()
+			assert.Equal(t, tt.existing, reopened.URLMap[tt.existing.ShortURL], "the existing record is kept in the file")
+		})
+	}
+}
@@ -0,0 +1,24 @@
+package storage
+
+import (
+	"context"
+
+	"github.com/scaranin/go-svc-short-url/internal/models"
+)
+
+// pingStore pings store if it implements models.Pinger and succeeds otherwise.
+func pingStore(ctx context.Context, store models.Storage) error {
+	if pinger, ok := store.(models.Pinger); ok {
+		return pinger.Ping(ctx)
+	}
+	return nil
+}
+
+// pendingMigrations asks store for its pending migrations if it implements
+// models.Migrator and reports none otherwise.
+func pendingMigrations(ctx context.Context, store models.Storage) (int, error) {
+	if migrator, ok := store.(models.Migrator); ok {
+		return migrator.PendingMigrations(ctx)
+	}
+	return 0, nil
+}
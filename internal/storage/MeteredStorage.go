@@ -0,0 +1,112 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/scaranin/go-svc-short-url/internal/metrics"
+	"github.com/scaranin/go-svc-short-url/internal/models"
+)
+
+// MeteredStorage is a decorator for models.Storage that records the latency of
+// every call in metrics.StorageDuration, labelled with Backend. It is meant to
+// wrap a concrete backend, below any cache, so the metrics show the cost of
+// the backend itself.
+type MeteredStorage struct {
+	// Storage is the wrapped backend.
+	Storage models.Storage
+	// Backend is the value of the "backend" label, e.g. "postgres" or "bolt".
+	Backend string
+}
+
+// NewMeteredStorage wraps store and labels its metrics with backend.
+func NewMeteredStorage(store models.Storage, backend string) MeteredStorage {
+	return MeteredStorage{Storage: store, Backend: backend}
+}
+
+// observe records the latency of operation started at start.
+// A missing row, a deleted URL or an exhausted one is a regular outcome, not
+// an error.
+func (ms MeteredStorage) observe(operation string, start time.Time, err error) {
+	result := "ok"
+	if err != nil && !errors.Is(err, models.ErrNotFound) && !errors.Is(err, models.ErrDeleted) && !errors.Is(err, models.ErrClicksExhausted) && !errors.Is(err, models.ErrNotOwned) {
+		result = "error"
+	}
+	metrics.StorageDuration.WithLabelValues(ms.Backend, operation, result).Observe(time.Since(start).Seconds())
+}
+
+// Save implements the models.Storage interface.
+func (ms MeteredStorage) Save(ctx context.Context, URL *models.URL) (string, error) {
+	start := time.Now()
+	shortURL, err := ms.Storage.Save(ctx, URL)
+	ms.observe("save", start, err)
+	return shortURL, err
+}
+
+// Load implements the models.Storage interface.
+func (ms MeteredStorage) Load(ctx context.Context, shortURL string) (string, error) {
+	URL, err := ms.LoadURL(ctx, shortURL)
+	return URL.OriginalURL, err
+}
+
+// LoadURL implements the models.Storage interface. It is measured as "load".
+func (ms MeteredStorage) LoadURL(ctx context.Context, shortURL string) (models.URL, error) {
+	start := time.Now()
+	URL, err := ms.Storage.LoadURL(ctx, shortURL)
+	ms.observe("load", start, err)
+	return URL, err
+}
+
+// RecordClick implements the models.Storage interface.
+func (ms MeteredStorage) RecordClick(ctx context.Context, shortURL string, variant string) error {
+	start := time.Now()
+	err := ms.Storage.RecordClick(ctx, shortURL, variant)
+	ms.observe("record_click", start, err)
+	return err
+}
+
+// UpdateVariants implements the models.Storage interface.
+func (ms MeteredStorage) UpdateVariants(ctx context.Context, UserID string, shortURL string, variants []models.Variant) error {
+	start := time.Now()
+	err := ms.Storage.UpdateVariants(ctx, UserID, shortURL, variants)
+	ms.observe("update_variants", start, err)
+	return err
+}
+
+// GetUserURLList implements the models.Storage interface.
+func (ms MeteredStorage) GetUserURLList(ctx context.Context, UserID string) ([]models.URLUserList, error) {
+	start := time.Now()
+	URLList, err := ms.Storage.GetUserURLList(ctx, UserID)
+	ms.observe("get_user_urls", start, err)
+	return URLList, err
+}
+
+// DeleteBulk implements the models.Storage interface.
+func (ms MeteredStorage) DeleteBulk(ctx context.Context, UserID string, ShortURLs []string) error {
+	start := time.Now()
+	err := ms.Storage.DeleteBulk(ctx, UserID, ShortURLs)
+	ms.observe("delete_bulk", start, err)
+	return err
+}
+
+// GetStats implements the models.Storage interface.
+func (ms MeteredStorage) GetStats(ctx context.Context) (models.Statistic, error) {
+	start := time.Now()
+	stat, err := ms.Storage.GetStats(ctx)
+	ms.observe("get_stats", start, err)
+	return stat, err
+}
+
+// Ping implements the models.Pinger interface.
+func (ms MeteredStorage) Ping(ctx context.Context) error {
+	start := time.Now()
+	err := pingStore(ctx, ms.Storage)
+	ms.observe("ping", start, err)
+	return err
+}
+
+// PendingMigrations implements the models.Migrator interface by delegating to the wrapped storage.
+func (ms MeteredStorage) PendingMigrations(ctx context.Context) (int, error) {
+	return pendingMigrations(ctx, ms.Storage)
+}
@@ -0,0 +1,95 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/scaranin/go-svc-short-url/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecordClick(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "links.json")
+	fs, err := CreateStoreFile(path)
+	require.NoError(t, err)
+	bolt, err := CreateStoreBolt(filepath.Join(t.TempDir(), "links.db"))
+	require.NoError(t, err)
+	defer bolt.Close()
+
+	backends := map[string]models.Storage{
+		"file":   fs,
+		"bolt":   bolt,
+		"cached": NewCachedStorage(NewMeteredStorage(fs, "file"), 10, time.Minute, time.Minute),
+	}
+	for name, store := range backends {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			limited := models.URL{ShortURL: name + "-limited", OriginalURL: "https://" + name + ".example/limited", LinkOptions: models.LinkOptions{MaxClicks: 3}}
+			unlimited := models.URL{ShortURL: name + "-unlimited", OriginalURL: "https://" + name + ".example/unlimited"}
+			for _, URL := range []models.URL{limited, unlimited} {
+				_, err := store.Save(ctx, &URL)
+				require.NoError(t, err)
+			}
+
+			var allowed atomic.Int32
+			var wg sync.WaitGroup
+			for i := 0; i < 10; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					err := store.RecordClick(ctx, limited.ShortURL, "")
+					if err == nil {
+						allowed.Add(1)
+						return
+					}
+					assert.True(t, errors.Is(err, models.ErrClicksExhausted), err)
+				}()
+			}
+			wg.Wait()
+			assert.Equal(t, int32(3), allowed.Load(), "no more redirects than max_clicks")
+
+			URL, err := store.LoadURL(ctx, limited.ShortURL)
+			assert.ErrorIs(t, err, models.ErrClicksExhausted)
+			assert.Equal(t, 3, URL.Clicks)
+
+			require.NoError(t, store.RecordClick(ctx, unlimited.ShortURL, ""))
+			URL, err = store.LoadURL(ctx, unlimited.ShortURL)
+			require.NoError(t, err)
+			assert.Zero(t, URL.Clicks, "links without max_clicks are not counted")
+
+			split := models.URL{ShortURL: name + "-split", OriginalURL: "https://" + name + ".example/split"}
+			_, err = store.Save(ctx, &split)
+			require.NoError(t, err)
+			for i := 0; i < 10; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					variant := "a"
+					if i%5 == 0 {
+						variant = "b"
+					}
+					assert.NoError(t, store.RecordClick(ctx, split.ShortURL, variant))
+				}()
+			}
+			wg.Wait()
+			URL, err = store.LoadURL(ctx, split.ShortURL)
+			require.NoError(t, err)
+			assert.Equal(t, map[string]int{"a": 8, "b": 2}, URL.VariantClicks)
+			assert.Zero(t, URL.Clicks, "variant clicks do not count against max_clicks")
+		})
+	}
+
+	reopened, err := CreateStoreFile(path)
+	require.NoError(t, err)
+	_, err = reopened.LoadURL(context.Background(), "file-limited")
+	assert.ErrorIs(t, err, models.ErrClicksExhausted, "the click count is persisted")
+	URL, err := reopened.LoadURL(context.Background(), "file-split")
+	require.NoError(t, err)
+	assert.Equal(t, 8, URL.VariantClicks["a"], "the variant clicks are persisted")
+}
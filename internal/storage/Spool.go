@@ -0,0 +1,177 @@
+package storage
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/scaranin/go-svc-short-url/internal/models"
+)
+
+const (
+	// spoolOpSave marks a spooled Storage.Save call.
+	spoolOpSave = "save"
+	// spoolOpDelete marks a spooled Storage.DeleteBulk call.
+	spoolOpDelete = "delete"
+)
+
+// SpoolEntry is a single write queued while the primary storage is unavailable.
+type SpoolEntry struct {
+	// Op is the spooled operation, "save" or "delete".
+	Op string `json:"op"`
+	// URL is the saved record for "save" entries.
+	URL *models.URL `json:"url,omitempty"`
+	// UserID is the owner of the deleted URLs for "delete" entries.
+	UserID string `json:"user_id,omitempty"`
+	// ShortURLs are the deleted short URLs for "delete" entries.
+	ShortURLs []string `json:"short_urls,omitempty"`
+}
+
+// Spool is an append-only JSON lines file of writes waiting to be replayed
+// against the primary storage. Entries survive a restart and are replayed in order.
+type Spool struct {
+	path    string
+	mu      sync.Mutex
+	file    *os.File
+	encoder *json.Encoder
+	pending int
+}
+
+// OpenSpool opens (or creates) the spool file at path and counts the entries
+// left over from a previous run.
+func OpenSpool(path string) (*Spool, error) {
+	entries, err := readSpool(path)
+	if err != nil {
+		return nil, err
+	}
+	s := &Spool{path: path, pending: len(entries)}
+	if err = s.open(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// open opens the spool file for appending.
+func (s *Spool) open() error {
+	file, err := os.OpenFile(s.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0666)
+	if err != nil {
+		return err
+	}
+	s.file = file
+	s.encoder = json.NewEncoder(file)
+	return nil
+}
+
+// Append writes the entry to the end of the spool.
+func (s *Spool) Append(entry SpoolEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.encoder.Encode(entry); err != nil {
+		return err
+	}
+	s.pending++
+	return s.file.Sync()
+}
+
+// Len returns the number of entries waiting to be replayed.
+func (s *Spool) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.pending
+}
+
+// Replay applies the spooled entries in order. It stops at the first entry for
+// which apply fails, keeps that entry and the ones after it in the spool, and
+// returns the error. Appends are blocked while the replay is running, so no
+// write can overtake the spooled ones. It returns the number of applied entries.
+func (s *Spool) Replay(apply func(SpoolEntry) error) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries, err := readSpool(s.path)
+	if err != nil {
+		return 0, err
+	}
+
+	applied := 0
+	var applyErr error
+	for _, entry := range entries {
+		if applyErr = apply(entry); applyErr != nil {
+			break
+		}
+		applied++
+	}
+	if applied == 0 {
+		return 0, applyErr
+	}
+
+	if err = s.rewrite(entries[applied:]); err != nil {
+		return applied, err
+	}
+	return applied, applyErr
+}
+
+// rewrite atomically replaces the spool file with the given entries and reopens
+// it for appending. The caller must hold s.mu.
+func (s *Spool) rewrite(entries []SpoolEntry) error {
+	tmp := s.path + ".tmp"
+	file, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(file)
+	for _, entry := range entries {
+		if err = encoder.Encode(entry); err != nil {
+			file.Close()
+			return err
+		}
+	}
+	if err = file.Close(); err != nil {
+		return err
+	}
+
+	s.file.Close()
+	if err = os.Rename(tmp, s.path); err != nil {
+		return errors.Join(err, s.open())
+	}
+	s.pending = len(entries)
+	return s.open()
+}
+
+// Close closes the spool file.
+func (s *Spool) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.file.Close()
+}
+
+// readSpool reads all entries from the spool file at path. A missing file is empty.
+func readSpool(path string) ([]SpoolEntry, error) {
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var entries []SpoolEntry
+	decoder := json.NewDecoder(bufio.NewReader(file))
+	for {
+		var entry SpoolEntry
+		err = decoder.Decode(&entry)
+		// A truncated last entry is left by a crash in the middle of Append;
+		// the write was never acknowledged, so it is dropped.
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return entries, nil
+		}
+		if err != nil {
+			return entries, err
+		}
+		entries = append(entries, entry)
+	}
+}
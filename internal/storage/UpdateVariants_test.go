@@ -0,0 +1,55 @@
+package storage
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/scaranin/go-svc-short-url/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpdateVariants(t *testing.T) {
+	fs, err := CreateStoreFile("")
+	require.NoError(t, err)
+	bolt, err := CreateStoreBolt(filepath.Join(t.TempDir(), "links.db"))
+	require.NoError(t, err)
+	defer bolt.Close()
+
+	backends := map[string]models.Storage{
+		"file":   fs,
+		"bolt":   bolt,
+		"cached": NewCachedStorage(NewMeteredStorage(fs, "file"), 10, time.Minute, time.Minute),
+	}
+	for name, store := range backends {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			URL := models.URL{ShortURL: name + "-split", OriginalURL: "https://" + name + ".example/split", UserID: "owner",
+				LinkOptions: models.LinkOptions{Variants: []models.Variant{
+					{Name: "a", URL: "https://a.example/", Weight: 50},
+					{Name: "b", URL: "https://b.example/", Weight: 50},
+				}},
+			}
+			_, err := store.Save(ctx, &URL)
+			require.NoError(t, err)
+			require.NoError(t, store.RecordClick(ctx, URL.ShortURL, "a"))
+			_, err = store.LoadURL(ctx, URL.ShortURL)
+			require.NoError(t, err)
+
+			updated := []models.Variant{
+				{Name: "a", URL: "https://a.example/", Weight: 90},
+				{Name: "b", URL: "https://b.example/", Weight: 10},
+			}
+			assert.ErrorIs(t, store.UpdateVariants(ctx, "intruder", URL.ShortURL, updated), models.ErrNotOwned)
+			assert.ErrorIs(t, store.UpdateVariants(ctx, "owner", name+"-missing", updated), models.ErrNotOwned)
+			require.NoError(t, store.UpdateVariants(ctx, "owner", URL.ShortURL, updated))
+
+			loaded, err := store.LoadURL(ctx, URL.ShortURL)
+			require.NoError(t, err)
+			assert.Equal(t, updated, loaded.Variants)
+			assert.Equal(t, map[string]int{"a": 1}, loaded.VariantClicks, "the clicks are kept")
+		})
+	}
+}
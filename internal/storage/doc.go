@@ -3,9 +3,17 @@ Package storage provides the concrete implementations of the `models.Storage` in
 
 It contains different storage backends that can be used by the application:
   - `DBStorage`: A persistence layer using a PostgreSQL database. It handles database
-    connections, schema creation, and all CRUD operations.
+    connections, schema creation, and all CRUD operations. Every operation and
+    every SQL statement is traced as an OpenTelemetry span.
   - `FileStorageJSON`: A persistence layer that uses a local JSON file for storage,
     backed by an in-memory map for fast lookups.
+  - `BoltStorage`: A persistence layer on an embedded bbolt B-tree key-value store,
+    with separate buckets for links, users and deletions. It suits single-node
+    deployments that need durable storage without a database server.
+
+The backends can be wrapped in decorators: `MeteredStorage` records operation
+latencies, `CachedStorage` caches redirects and `BreakerStorage` keeps the
+service usable while the database is down.
 
 The choice of which storage to use is determined by the application's configuration.
 */
@@ -0,0 +1,12 @@
+/*
+Package targeting picks the destination of a short link from the device and
+the language of the client.
+
+A link may carry ordered `Rule`s, each naming a platform, a language or both,
+and the URL to send matching clients to. `ParseClient` derives the platform
+from the User-Agent header and the preferred language from Accept-Language;
+`Select` returns the URL of the first rule the client matches, so the original
+URL of the link stays the fallback for everyone else.
+*/
+
+package targeting
@@ -0,0 +1,177 @@
+package targeting
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Platforms recognized in User-Agent headers.
+const (
+	PlatformIOS      = "ios"
+	PlatformAndroid  = "android"
+	PlatformWindows  = "windows"
+	PlatformMacOS    = "macos"
+	PlatformLinux    = "linux"
+	PlatformChromeOS = "chromeos"
+)
+
+// Platform groups a rule may name instead of a single platform.
+const (
+	// PlatformMobile matches iOS, Android and other mobile devices.
+	PlatformMobile = "mobile"
+	// PlatformDesktop matches Windows, macOS, Linux and ChromeOS.
+	PlatformDesktop = "desktop"
+)
+
+// MaxRules limits the number of rules of a link.
+const MaxRules = 20
+
+// Rule sends the clients matching all of its conditions to URL. An empty
+// condition matches every client.
+type Rule struct {
+	// Platform is a platform such as "ios" or "android", or one of the groups
+	// "mobile" and "desktop".
+	Platform string `json:"platform,omitempty"`
+	// Language is a language tag such as "de" or "pt-BR". A primary tag also
+	// matches its regional variants, so "de" matches "de-AT".
+	Language string `json:"language,omitempty"`
+	// URL is the destination of the matching clients.
+	URL string `json:"url"`
+}
+
+// Client is what the rules are matched against.
+type Client struct {
+	// Platform is the platform of the client, or empty if it is not known.
+	Platform string
+	// Mobile reports whether the client is a mobile device.
+	Mobile bool
+	// Language is the most preferred language of the client, lower-cased, or
+	// empty if it sent none.
+	Language string
+}
+
+// ParseClient describes the client sending the given User-Agent and
+// Accept-Language headers.
+func ParseClient(userAgent, acceptLanguage string) Client {
+	platform := PlatformOf(userAgent)
+	return Client{
+		Platform: platform,
+		Mobile:   platform == PlatformIOS || platform == PlatformAndroid || strings.Contains(userAgent, "Mobile"),
+		Language: PreferredLanguage(acceptLanguage),
+	}
+}
+
+// PlatformOf returns the platform named in userAgent, or an empty string if it
+// is not recognized. iPadOS in desktop mode identifies itself as macOS and is
+// reported as such.
+func PlatformOf(userAgent string) string {
+	switch {
+	case strings.Contains(userAgent, "iPhone"), strings.Contains(userAgent, "iPad"), strings.Contains(userAgent, "iPod"):
+		return PlatformIOS
+	case strings.Contains(userAgent, "Android"):
+		return PlatformAndroid
+	case strings.Contains(userAgent, "Windows"):
+		return PlatformWindows
+	case strings.Contains(userAgent, "CrOS"):
+		return PlatformChromeOS
+	case strings.Contains(userAgent, "Macintosh"), strings.Contains(userAgent, "Mac OS X"):
+		return PlatformMacOS
+	case strings.Contains(userAgent, "Linux"), strings.Contains(userAgent, "X11"):
+		return PlatformLinux
+	}
+	return ""
+}
+
+// PreferredLanguage returns the language with the highest quality in an
+// Accept-Language header, the first one on a tie. The wildcard and languages
+// with quality zero are ignored.
+func PreferredLanguage(acceptLanguage string) string {
+	var best string
+	bestQ := 0.0
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag, params, _ := strings.Cut(part, ";")
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if len(tag) == 0 || tag == "*" {
+			continue
+		}
+		q := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+		if q > bestQ {
+			best, bestQ = tag, q
+		}
+	}
+	return best
+}
+
+// Select returns the URL of the first rule in rules that client matches.
+func Select(rules []Rule, client Client) (string, bool) {
+	for _, rule := range rules {
+		if rule.Matches(client) {
+			return rule.URL, true
+		}
+	}
+	return "", false
+}
+
+// Matches reports whether client meets the conditions of the rule.
+func (rule Rule) Matches(client Client) bool {
+	return matchPlatform(rule.Platform, client) && matchLanguage(rule.Language, client.Language)
+}
+
+// matchPlatform reports whether client runs on platform.
+func matchPlatform(platform string, client Client) bool {
+	switch platform {
+	case "":
+		return true
+	case PlatformMobile:
+		return client.Mobile
+	case PlatformDesktop:
+		return !client.Mobile && len(client.Platform) > 0
+	}
+	return platform == client.Platform
+}
+
+// matchLanguage reports whether the language tag language matches tag.
+func matchLanguage(language, tag string) bool {
+	if len(language) == 0 {
+		return true
+	}
+	language = strings.ToLower(language)
+	return tag == language || strings.HasPrefix(tag, language+"-")
+}
+
+// Validate checks the rules of a link: each needs a URL and at least one
+// known condition.
+func Validate(rules []Rule) error {
+	if len(rules) > MaxRules {
+		return fmt.Errorf("at most %d targets are allowed", MaxRules)
+	}
+	for i, rule := range rules {
+		if len(rule.URL) == 0 {
+			return fmt.Errorf("target %d has no url", i)
+		}
+		if len(rule.Platform) == 0 && len(rule.Language) == 0 {
+			return fmt.Errorf("target %d has neither platform nor language", i)
+		}
+		if len(rule.Platform) > 0 && !knownPlatform(rule.Platform) {
+			return fmt.Errorf("target %d: platform %q is not one of ios, android, windows, macos, linux, chromeos, mobile, desktop", i, rule.Platform)
+		}
+	}
+	return nil
+}
+
+// knownPlatform reports whether a rule may name platform.
+func knownPlatform(platform string) bool {
+	switch platform {
+	case PlatformIOS, PlatformAndroid, PlatformWindows, PlatformMacOS, PlatformLinux, PlatformChromeOS, PlatformMobile, PlatformDesktop:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,90 @@
+package targeting
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPlatformOf(t *testing.T) {
+	tests := []struct {
+		name      string
+		userAgent string
+		platform  string
+		mobile    bool
+	}{
+		{name: "iPhone Safari", userAgent: "Mozilla/5.0 (iPhone; CPU iPhone OS 17_4 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.4 Mobile/15E148 Safari/604.1", platform: PlatformIOS, mobile: true},
+		{name: "iPad Safari", userAgent: "Mozilla/5.0 (iPad; CPU OS 16_6 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/16.6 Mobile/15E148 Safari/604.1", platform: PlatformIOS, mobile: true},
+		{name: "iPhone Chrome", userAgent: "Mozilla/5.0 (iPhone; CPU iPhone OS 17_4 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) CriOS/123.0.6312.52 Mobile/15E148 Safari/604.1", platform: PlatformIOS, mobile: true},
+		{name: "Android Chrome", userAgent: "Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.6367.82 Mobile Safari/537.36", platform: PlatformAndroid, mobile: true},
+		{name: "Android Firefox", userAgent: "Mozilla/5.0 (Android 14; Mobile; rv:125.0) Gecko/125.0 Firefox/125.0", platform: PlatformAndroid, mobile: true},
+		{name: "Samsung tablet", userAgent: "Mozilla/5.0 (Linux; Android 13; SM-X710) AppleWebKit/537.36 (KHTML, like Gecko) SamsungBrowser/24.0 Chrome/117.0.0.0 Safari/537.36", platform: PlatformAndroid, mobile: true},
+		{name: "Windows Edge", userAgent: "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36 Edg/124.0.2478.67", platform: PlatformWindows},
+		{name: "macOS Safari", userAgent: "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.4 Safari/605.1.15", platform: PlatformMacOS},
+		{name: "Linux Firefox", userAgent: "Mozilla/5.0 (X11; Linux x86_64; rv:125.0) Gecko/20100101 Firefox/125.0", platform: PlatformLinux},
+		{name: "ChromeOS", userAgent: "Mozilla/5.0 (X11; CrOS x86_64 14541.0.0) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36", platform: PlatformChromeOS},
+		{name: "curl", userAgent: "curl/8.5.0", platform: ""},
+		{name: "empty", userAgent: "", platform: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.platform, PlatformOf(tt.userAgent))
+			assert.Equal(t, tt.mobile, ParseClient(tt.userAgent, "").Mobile)
+		})
+	}
+}
+
+func TestPreferredLanguage(t *testing.T) {
+	tests := []struct {
+		header string
+		want   string
+	}{
+		{header: "de-AT,de;q=0.9,en;q=0.8", want: "de-at"},
+		{header: "en;q=0.5, fr", want: "fr"},
+		{header: "*, es;q=0.1", want: "es"},
+		{header: "pt-BR;q=0, it;q=0.3", want: "it"},
+		{header: "ja;q=bad", want: ""},
+		{header: "", want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.header, func(t *testing.T) {
+			assert.Equal(t, tt.want, PreferredLanguage(tt.header))
+		})
+	}
+}
+
+func TestSelect(t *testing.T) {
+	rules := []Rule{
+		{Platform: PlatformIOS, URL: "https://apps.apple.com/app/id1"},
+		{Platform: PlatformAndroid, URL: "https://play.google.com/store/apps/details?id=app"},
+		{Platform: PlatformDesktop, Language: "de", URL: "https://example.com/de"},
+	}
+	tests := []struct {
+		name   string
+		client Client
+		want   string
+		ok     bool
+	}{
+		{name: "iOS", client: ParseClient("Mozilla/5.0 (iPhone; CPU iPhone OS 17_4 like Mac OS X)", "de"), want: "https://apps.apple.com/app/id1", ok: true},
+		{name: "Android", client: ParseClient("Mozilla/5.0 (Linux; Android 14; Pixel 8)", ""), want: "https://play.google.com/store/apps/details?id=app", ok: true},
+		{name: "German desktop", client: ParseClient("Mozilla/5.0 (Windows NT 10.0; Win64; x64)", "de-CH,en;q=0.5"), want: "https://example.com/de", ok: true},
+		{name: "English desktop falls back", client: ParseClient("Mozilla/5.0 (Windows NT 10.0; Win64; x64)", "en-US,de;q=0.5")},
+		{name: "unknown client falls back", client: ParseClient("curl/8.5.0", "de")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := Select(rules, tt.client)
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	assert.NoError(t, Validate(nil))
+	assert.NoError(t, Validate([]Rule{{Platform: PlatformMobile, URL: "https://m.example.com"}, {Language: "fr", URL: "https://example.fr"}}))
+	assert.Error(t, Validate([]Rule{{Platform: PlatformIOS}}), "no url")
+	assert.Error(t, Validate([]Rule{{URL: "https://example.com"}}), "no condition")
+	assert.Error(t, Validate([]Rule{{Platform: "symbian", URL: "https://example.com"}}), "unknown platform")
+	assert.Error(t, Validate(make([]Rule, MaxRules+1)), "too many rules")
+}
@@ -0,0 +1,15 @@
+/*
+Package tracing configures OpenTelemetry tracing for the service.
+
+`Setup` installs the global tracer provider and the W3C trace context
+propagator. Spans are exported over OTLP/HTTP to a collector, or written as
+JSON to stdout or a file for local testing. With no exporter configured spans
+are still created, so incoming trace context is propagated, but nothing is
+exported.
+
+The server span of each request is started by the `middleware` package; the
+`handlers` and `storage` packages add child spans down to the individual
+Postgres queries.
+*/
+
+package tracing
@@ -0,0 +1,101 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+// Supported values of Options.Exporter.
+const (
+	// ExporterNone disables span export.
+	ExporterNone = "none"
+	// ExporterOTLP exports spans over OTLP/HTTP.
+	ExporterOTLP = "otlp"
+	// ExporterStdout writes spans as JSON to stdout or to Options.File.
+	ExporterStdout = "stdout"
+)
+
+// Options configure Setup.
+type Options struct {
+	// ServiceName is reported as the service.name resource attribute.
+	ServiceName string
+	// ServiceVersion is reported as the service.version resource attribute.
+	ServiceVersion string
+	// Exporter selects the span exporter: "otlp", "stdout" or "none". An empty
+	// value is the same as "none".
+	Exporter string
+	// OTLPEndpoint is the host:port of the OTLP/HTTP collector. When empty the
+	// standard OTEL_EXPORTER_OTLP_* environment variables apply.
+	OTLPEndpoint string
+	// File is where the stdout exporter writes spans. When empty it writes to stdout.
+	File string
+}
+
+// Setup installs the global tracer provider and propagator described by opts.
+// The returned function flushes pending spans and releases the exporter; it
+// must be called before the process exits.
+func Setup(ctx context.Context, opts Options) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
+	var (
+		exporter sdktrace.SpanExporter
+		closer   io.Closer
+		err      error
+	)
+	switch opts.Exporter {
+	case "", ExporterNone:
+		return func(context.Context) error { return nil }, nil
+	case ExporterOTLP:
+		var clientOpts []otlptracehttp.Option
+		if len(opts.OTLPEndpoint) > 0 {
+			clientOpts = append(clientOpts, otlptracehttp.WithEndpoint(opts.OTLPEndpoint), otlptracehttp.WithInsecure())
+		}
+		exporter, err = otlptracehttp.New(ctx, clientOpts...)
+	case ExporterStdout:
+		var w io.Writer = os.Stdout
+		if len(opts.File) > 0 {
+			file, openErr := os.OpenFile(opts.File, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0666)
+			if openErr != nil {
+				return nil, openErr
+			}
+			w, closer = file, file
+		}
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(w))
+	default:
+		return nil, fmt.Errorf("unknown trace exporter %q", opts.Exporter)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	res := resource.NewWithAttributes(semconv.SchemaURL,
+		semconv.ServiceName(opts.ServiceName),
+		semconv.ServiceVersion(opts.ServiceVersion),
+	)
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(provider)
+
+	return func(ctx context.Context) error {
+		err := provider.Shutdown(ctx)
+		if closer != nil {
+			closer.Close()
+		}
+		return err
+	}, nil
+}
@@ -0,0 +1,12 @@
+/*
+Package urlnorm canonicalizes URLs before they are shortened.
+
+Short URLs are derived from a hash of the URL, so spellings of the same address
+such as `HTTP://Example.com`, `http://example.com/` and `http://example.com:80`
+must be reduced to one canonical form first; otherwise each would get its own
+short URL and bypass the uniqueness check of the storage. `Normalize` applies
+the normalizations of RFC 3986 section 6.2.2 that never change the resource a
+URL refers to, plus the optional rules of a `Policy`.
+*/
+
+package urlnorm
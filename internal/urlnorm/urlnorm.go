@@ -0,0 +1,180 @@
+package urlnorm
+
+import (
+	"net"
+	"net/url"
+	"strings"
+)
+
+// Trailing slash policies of Policy.TrailingSlash.
+const (
+	// TrailingSlashKeep leaves the trailing slash of a path as it is.
+	TrailingSlashKeep = "keep"
+	// TrailingSlashStrip removes the trailing slash of any path except the root.
+	TrailingSlashStrip = "strip"
+)
+
+// defaultPorts are the ports omitted from canonical URLs, by scheme.
+var defaultPorts = map[string]string{
+	"http":  "80",
+	"https": "443",
+}
+
+// Policy holds the configurable rules of Normalize.
+type Policy struct {
+	// TrailingSlash is TrailingSlashKeep or TrailingSlashStrip. Empty means keep.
+	TrailingSlash string
+	// StripParams are query parameters removed from the URL, such as tracking
+	// parameters. A name ending in "*" matches every parameter with that prefix,
+	// for example "utm_*".
+	StripParams []string
+}
+
+// Normalize returns the canonical form of rawURL:
+//   - the scheme and host are lower-cased and a trailing dot is removed from the host;
+//   - the default port of the scheme is removed;
+//   - an empty path becomes "/";
+//   - percent-encoded unreserved characters are decoded and the remaining
+//     escapes use upper-case hex digits;
+//   - an empty query or fragment is removed;
+//   - the trailing slash and query parameters are handled as set in p.
+//
+// URLs without a host are returned as they are.
+func Normalize(rawURL string, p Policy) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+	if len(u.Host) == 0 {
+		return rawURL, nil
+	}
+
+	scheme := strings.ToLower(u.Scheme)
+	var b strings.Builder
+	b.WriteString(scheme)
+	b.WriteString("://")
+	if u.User != nil {
+		b.WriteString(u.User.String())
+		b.WriteByte('@')
+	}
+	b.WriteString(normalizeHost(u.Hostname(), u.Port(), scheme))
+
+	path := normalizeEscapes(u.EscapedPath())
+	if len(path) == 0 {
+		path = "/"
+	}
+	if p.TrailingSlash == TrailingSlashStrip && path != "/" {
+		path = strings.TrimSuffix(path, "/")
+	}
+	b.WriteString(path)
+
+	if query := normalizeQuery(u.RawQuery, p.StripParams); len(query) > 0 {
+		b.WriteByte('?')
+		b.WriteString(query)
+	}
+	if fragment := normalizeEscapes(u.EscapedFragment()); len(fragment) > 0 {
+		b.WriteByte('#')
+		b.WriteString(fragment)
+	}
+	return b.String(), nil
+}
+
+// normalizeHost lower-cases host and joins it with port unless port is the
+// default port of scheme.
+func normalizeHost(host string, port string, scheme string) string {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if port == defaultPorts[scheme] {
+		port = ""
+	}
+	if len(port) > 0 {
+		return net.JoinHostPort(host, port)
+	}
+	if strings.Contains(host, ":") {
+		return "[" + host + "]"
+	}
+	return host
+}
+
+// normalizeQuery drops empty and stripped parameters from rawQuery, keeping
+// the order of the others, and normalizes their escapes.
+func normalizeQuery(rawQuery string, strip []string) string {
+	if len(rawQuery) == 0 {
+		return ""
+	}
+	var kept []string
+	for _, param := range strings.Split(rawQuery, "&") {
+		if len(param) == 0 {
+			continue
+		}
+		name, _, _ := strings.Cut(param, "=")
+		if unescaped, err := url.QueryUnescape(name); err == nil {
+			name = unescaped
+		}
+		if stripped(name, strip) {
+			continue
+		}
+		kept = append(kept, normalizeEscapes(param))
+	}
+	return strings.Join(kept, "&")
+}
+
+// stripped reports whether the parameter name matches one of the patterns.
+func stripped(name string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+			if strings.HasPrefix(name, prefix) {
+				return true
+			}
+		} else if name == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeEscapes decodes percent-encoded unreserved characters in s and
+// upper-cases the hex digits of the other escapes.
+func normalizeEscapes(s string) string {
+	if !strings.Contains(s, "%") {
+		return s
+	}
+	var b strings.Builder
+	b.Grow(len(s))
+	for i := 0; i < len(s); i++ {
+		if s[i] != '%' || i+2 >= len(s) || !isHex(s[i+1]) || !isHex(s[i+2]) {
+			b.WriteByte(s[i])
+			continue
+		}
+		c := unhex(s[i+1])<<4 | unhex(s[i+2])
+		if isUnreserved(c) {
+			b.WriteByte(c)
+		} else {
+			b.WriteByte('%')
+			b.WriteString(strings.ToUpper(s[i+1 : i+3]))
+		}
+		i += 2
+	}
+	return b.String()
+}
+
+// isUnreserved reports whether c is an unreserved character of RFC 3986.
+func isUnreserved(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' ||
+		c == '-' || c == '.' || c == '_' || c == '~'
+}
+
+// isHex reports whether c is a hexadecimal digit.
+func isHex(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
+
+// unhex returns the value of the hexadecimal digit c.
+func unhex(c byte) byte {
+	switch {
+	case '0' <= c && c <= '9':
+		return c - '0'
+	case 'a' <= c && c <= 'f':
+		return c - 'a' + 10
+	}
+	return c - 'A' + 10
+}
@@ -0,0 +1,57 @@
+package urlnorm
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalize(t *testing.T) {
+	tracking := Policy{StripParams: []string{"utm_*", "fbclid"}}
+	strip := Policy{TrailingSlash: TrailingSlashStrip}
+
+	tests := []struct {
+		name   string
+		policy Policy
+		rawURL string
+		want   string
+	}{
+		{name: "scheme and host case", rawURL: "HTTP://Example.COM", want: "http://example.com/"},
+		{name: "root slash", rawURL: "http://example.com/", want: "http://example.com/"},
+		{name: "default http port", rawURL: "http://example.com:80", want: "http://example.com/"},
+		{name: "default https port", rawURL: "https://example.com:443/a", want: "https://example.com/a"},
+		{name: "other port", rawURL: "https://example.com:8443/a", want: "https://example.com:8443/a"},
+		{name: "trailing dot", rawURL: "http://example.com./a", want: "http://example.com/a"},
+		{name: "ipv6 host", rawURL: "http://[::1]:80/", want: "http://[::1]/"},
+		{name: "path case kept", rawURL: "http://example.com/Path/To", want: "http://example.com/Path/To"},
+		{name: "unreserved escapes decoded", rawURL: "http://example.com/%7Euser/%61bc", want: "http://example.com/~user/abc"},
+		{name: "reserved escapes upper-cased", rawURL: "http://example.com/a%2fb?q=%e2%82%ac", want: "http://example.com/a%2Fb?q=%E2%82%AC"},
+		{name: "trailing slash kept", rawURL: "http://example.com/a/", want: "http://example.com/a/"},
+		{name: "trailing slash stripped", policy: strip, rawURL: "http://example.com/a/", want: "http://example.com/a"},
+		{name: "root slash not stripped", policy: strip, rawURL: "http://example.com/", want: "http://example.com/"},
+		{name: "empty query and fragment", rawURL: "http://example.com/a?#", want: "http://example.com/a"},
+		{name: "query order kept", rawURL: "http://example.com/?b=2&a=1", want: "http://example.com/?b=2&a=1"},
+		{name: "tracking kept by default", rawURL: "http://example.com/?utm_source=x&id=1", want: "http://example.com/?utm_source=x&id=1"},
+		{name: "tracking stripped", policy: tracking, rawURL: "http://example.com/?utm_source=x&id=1&fbclid=y&utm_medium=z", want: "http://example.com/?id=1"},
+		{name: "only tracking", policy: tracking, rawURL: "http://example.com/a?utm_source=x#top", want: "http://example.com/a#top"},
+		{name: "userinfo kept", rawURL: "http://User@Example.com/", want: "http://User@example.com/"},
+		{name: "no host", rawURL: "mailto:someone@example.com", want: "mailto:someone@example.com"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Normalize(tt.rawURL, tt.policy)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+
+			again, err := Normalize(got, tt.policy)
+			require.NoError(t, err)
+			assert.Equal(t, got, again, "normalization must be idempotent")
+		})
+	}
+}
+
+func TestNormalizeMalformed(t *testing.T) {
+	_, err := Normalize("http://exa mple.com/", Policy{})
+	assert.Error(t, err)
+}